@@ -64,3 +64,56 @@ func (td *ThrottleDevice) String() string {
 func (td *ThrottleDevice) StringName(name string) string {
 	return fmt.Sprintf("%d:%d %s=%d", td.Major, td.Minor, name, td.Rate)
 }
+
+// IOWeightDevice struct holds a `major:minor weight` pair for cgroup v2
+// io.weight.
+type IOWeightDevice struct {
+	BlockIODevice
+	// Weight is the IO weight for the device, range is from 1 to 10000
+	Weight uint64 `json:"weight"`
+}
+
+// NewIOWeightDevice returns a configured IOWeightDevice pointer
+func NewIOWeightDevice(major, minor int64, weight uint64) *IOWeightDevice {
+	wd := &IOWeightDevice{}
+	wd.Major = major
+	wd.Minor = minor
+	wd.Weight = weight
+	return wd
+}
+
+// String formats the struct to be writable to the cgroup specific file
+func (wd *IOWeightDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, wd.Weight)
+}
+
+// BFQString formats the struct to be writable to io.bfq.weight, with the
+// weight converted to the BFQ range (see [ConvertIOWeightToBFQWeight]).
+func (wd *IOWeightDevice) BFQString() string {
+	return fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, ConvertIOWeightToBFQWeight(wd.Weight))
+}
+
+// IOLatencyDevice struct holds a `major:minor target` pair for cgroup v2
+// io.latency.
+type IOLatencyDevice struct {
+	BlockIODevice
+	// Target is the IO latency target for the device, in microseconds
+	Target uint64 `json:"target"`
+}
+
+// NewIOLatencyDevice returns a configured IOLatencyDevice pointer
+func NewIOLatencyDevice(major, minor int64, target uint64) *IOLatencyDevice {
+	ld := &IOLatencyDevice{}
+	ld.Major = major
+	ld.Minor = minor
+	ld.Target = target
+	return ld
+}
+
+// String formats the struct to be writable to the cgroup specific file
+func (ld *IOLatencyDevice) String() string {
+	if ld.Target == 0 {
+		return fmt.Sprintf("%d:%d target=max", ld.Major, ld.Minor)
+	}
+	return fmt.Sprintf("%d:%d target=%d", ld.Major, ld.Minor, ld.Target)
+}
@@ -4,6 +4,21 @@ type HugepageLimit struct {
 	// which type of hugepage to limit.
 	Pagesize string `json:"page_size"`
 
-	// usage limit for hugepage.
+	// usage limit for hugepage (the page fault limit, hugetlb.<size>.max
+	// or hugetlb.<size>.limit_in_bytes).
 	Limit uint64 `json:"limit"`
+
+	// reservation limit for hugepage (hugetlb.<size>.rsvd.max or
+	// hugetlb.<size>.rsvd.limit_in_bytes). If nil, Limit is used, if
+	// the kernel supports reservation limits.
+	RsvdLimit *uint64 `json:"rsvd_limit,omitempty"`
+}
+
+// ReservationLimit returns the reservation limit to be set: RsvdLimit if
+// set, otherwise Limit.
+func (l *HugepageLimit) ReservationLimit() uint64 {
+	if l.RsvdLimit != nil {
+		return *l.RsvdLimit
+	}
+	return l.Limit
 }
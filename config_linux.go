@@ -39,6 +39,18 @@ type Cgroup struct {
 	// Ignored unless systemd is used for managing cgroups.
 	SystemdProps []systemdDbus.Property `json:"-"`
 
+	// SystemdProperties are additional systemd unit properties which,
+	// unlike SystemdProps, can be serialized, and are validated by
+	// systemd cgroup managers before being used.
+	// Ignored unless systemd is used for managing cgroups.
+	SystemdProperties []SystemdProperty `json:"systemd_properties,omitempty"`
+
+	// Service, if set, tells systemd cgroup managers to create a
+	// transient service unit which runs the specified process, rather
+	// than a scope unit.
+	// Ignored unless systemd is used for managing cgroups.
+	Service *Service `json:"service,omitempty"`
+
 	// Rootless tells if rootless cgroups should be used.
 	Rootless bool `json:"Rootless,omitempty"`
 
@@ -50,6 +62,29 @@ type Cgroup struct {
 	OwnerUID *int `json:"owner_uid,omitempty"`
 }
 
+// Service holds the settings of a process started by systemd as a
+// transient service unit (see systemd.service(5) and systemd.exec(5)).
+type Service struct {
+	// ExecStart is the command to run: the absolute path to the
+	// executable, followed by the arguments (including argv[0]).
+	ExecStart []string `json:"exec_start"`
+
+	// Restart is the restart policy, such as "no" (the default),
+	// "on-failure", or "always".
+	Restart string `json:"restart,omitempty"`
+
+	// Environment is the list of environment variables to set,
+	// in the KEY=VALUE form.
+	Environment []string `json:"environment,omitempty"`
+
+	// User and Group to run the process as (names or numeric IDs).
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+
+	// WorkingDirectory is the working directory of the process.
+	WorkingDirectory string `json:"working_directory,omitempty"`
+}
+
 type Resources struct {
 	// Devices is the set of access rules for devices in the container.
 	Devices []*devices.Rule `json:"devices,omitempty"`
@@ -63,6 +98,18 @@ type Resources struct {
 	// Total memory usage (memory+swap); use -1 for unlimited swap.
 	MemorySwap int64 `json:"memory_swap,omitempty"`
 
+	// Swap usage throttle limit (in bytes); use -1 for unlimited, and 0
+	// to throttle all swap-out (cgroup v2 only, Linux 5.8+).
+	MemorySwapHigh *int64 `json:"memory_swap_high,omitempty"`
+
+	// Zswap pool size limit (in bytes); use -1 for unlimited, and 0 to
+	// disable zswap (cgroup v2 only, Linux 5.19+).
+	MemoryZswapMax *int64 `json:"memory_zswap_max,omitempty"`
+
+	// Whether to allow writeback of pages from zswap to swap (cgroup v2
+	// only, Linux 6.8+).
+	MemoryZswapWriteback *bool `json:"memory_zswap_writeback,omitempty"`
+
 	// CPU shares (relative weight vs. other containers).
 	CpuShares uint64 `json:"cpu_shares,omitempty"` //nolint:revive // Suppress "var-naming: struct field CpuShares should be CPUShares".
 
@@ -114,6 +161,15 @@ type Resources struct {
 	// IO write rate limit per cgroup per device, IO per second.
 	BlkioThrottleWriteIOPSDevice []*ThrottleDevice `json:"blkio_throttle_write_iops_device,omitempty"`
 
+	// IO weight per cgroup per device, range is from 1 to 10000 (cgroup v2
+	// only). It is written to io.weight (used by iocost), and, converted
+	// to the BFQ range, to io.bfq.weight (if BFQ is available).
+	IOWeightDevice []*IOWeightDevice `json:"io_weight_device,omitempty"`
+
+	// IO latency target per cgroup per device, in microseconds (cgroup
+	// v2 only). A target of 0 removes it.
+	IOLatencyDevice []*IOLatencyDevice `json:"io_latency_device,omitempty"`
+
 	// Freeze value for the process.
 	Freezer FreezerState `json:"freezer,omitempty"`
 
@@ -166,4 +222,16 @@ type Resources struct {
 	// if the new memory limits (Memory and MemorySwap) being set are lower
 	// than the current memory usage, and reject if so.
 	MemoryCheckBeforeUpdate bool `json:"memory_check_before_update,omitempty"`
+
+	// RollbackOnError is a flag for cgroupfs managers (fs and fs2) to
+	// save the cgroup files about to be modified by Set, and restore
+	// them (in reverse order) if a write fails, so that Set either
+	// applies all the resources, or none of them. In the latter case,
+	// Set returns a [*RollbackError].
+	//
+	// Device rules, freezer state, and cgroup core files (cgroup.*) set
+	// via Unified are not rolled back. Systemd managers, which can not
+	// roll back unit properties, reject the flag with an
+	// [*UnsupportedError].
+	RollbackOnError bool `json:"-"`
 }
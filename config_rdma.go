@@ -1,6 +1,16 @@
 package cgroups
 
+import "math"
+
+// RdmaUnlimited is the [LinuxRdma] and [RdmaEntry] limit value meaning
+// no limit ("max" in rdma.max).
+const RdmaUnlimited uint32 = math.MaxUint32
+
 // LinuxRdma for Linux cgroup 'rdma' resource management (Linux 4.11)
+//
+// When updating, a nil field leaves the current limit as is, and
+// [RdmaUnlimited] removes it. A device entry with both fields nil
+// removes all the limits for the device.
 type LinuxRdma struct {
 	// Maximum number of HCA handles that can be opened. Default is "no limit".
 	HcaHandles *uint32 `json:"hca_handles,omitempty"`
@@ -0,0 +1,116 @@
+package cgroups
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SystemdProperty is an additional systemd unit property, in a form which
+// (unlike [github.com/coreos/go-systemd/v22/dbus.Property]) can be
+// serialized. Systemd cgroup managers check it against the list of known
+// properties, and convert it to a D-Bus property.
+type SystemdProperty struct {
+	// Name is the property name, as in D-Bus API (e.g. "TasksMax").
+	Name string
+	// Value is the property value, of one of the following types
+	// (with D-Bus signature in parenthesis): bool (b), int32 (i),
+	// uint64 (t), string (s), []string (as), or []byte (ay).
+	Value any
+}
+
+// systemdPropertyJSON is the JSON representation of SystemdProperty.
+type systemdPropertyJSON struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// SystemdPropertySignature returns D-Bus signature of a value of
+// [SystemdProperty], or an empty string if the type is not supported.
+func SystemdPropertySignature(v any) string {
+	switch v.(type) {
+	case bool:
+		return "b"
+	case int32:
+		return "i"
+	case uint64:
+		return "t"
+	case string:
+		return "s"
+	case []string:
+		return "as"
+	case []byte:
+		return "ay"
+	}
+	return ""
+}
+
+func (p SystemdProperty) MarshalJSON() ([]byte, error) {
+	sig := SystemdPropertySignature(p.Value)
+	if sig == "" {
+		return nil, fmt.Errorf("systemd property %s: unsupported value type %T", p.Name, p.Value)
+	}
+	v := p.Value
+	if b, ok := v.([]byte); ok {
+		// Encode as an array of numbers rather than base64, for clarity.
+		a := make([]uint16, len(b))
+		for i := range b {
+			a[i] = uint16(b[i])
+		}
+		v = a
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(systemdPropertyJSON{Name: p.Name, Type: sig, Value: value})
+}
+
+func (p *SystemdProperty) UnmarshalJSON(data []byte) error {
+	var j systemdPropertyJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	var (
+		v   any
+		err error
+	)
+	switch j.Type {
+	case "b":
+		v, err = decodeJSON[bool](j.Value)
+	case "i":
+		v, err = decodeJSON[int32](j.Value)
+	case "t":
+		v, err = decodeJSON[uint64](j.Value)
+	case "s":
+		v, err = decodeJSON[string](j.Value)
+	case "as":
+		v, err = decodeJSON[[]string](j.Value)
+	case "ay":
+		// An array of numbers (see MarshalJSON).
+		var a []uint16
+		a, err = decodeJSON[[]uint16](j.Value)
+		b := make([]byte, len(a))
+		for i := range a {
+			if a[i] > 0xff {
+				err = fmt.Errorf("byte value %d out of range", a[i])
+				break
+			}
+			b[i] = byte(a[i])
+		}
+		v = b
+	default:
+		return fmt.Errorf("systemd property %s: unsupported type %q", j.Name, j.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("systemd property %s: %w", j.Name, err)
+	}
+	p.Name, p.Value = j.Name, v
+	return nil
+}
+
+func decodeJSON[T any](data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,43 @@
+package cgroups
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSystemdPropertyJSON(t *testing.T) {
+	props := []SystemdProperty{
+		{Name: "Delegate", Value: true},
+		{Name: "KillSignal", Value: int32(9)},
+		{Name: "TasksMax", Value: uint64(1 << 40)},
+		{Name: "Description", Value: "test"},
+		{Name: "After", Value: []string{"a.service", "b.service"}},
+		{Name: "AllowedCPUs", Value: []byte{0x0f, 0xff}},
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []SystemdProperty
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, props) {
+		t.Errorf("expected %+v, got %+v (JSON: %s)", props, got, data)
+	}
+
+	if _, err := json.Marshal(SystemdProperty{Name: "CPUWeight", Value: 100}); err == nil {
+		t.Error("expected an error for int value")
+	}
+	for _, data := range []string{
+		`{"name":"TasksMax","type":"x","value":1}`,
+		`{"name":"TasksMax","type":"t","value":-1}`,
+		`{"name":"AllowedCPUs","type":"ay","value":[256]}`,
+	} {
+		var p SystemdProperty
+		if err := json.Unmarshal([]byte(data), &p); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
@@ -24,6 +24,37 @@ const (
 
 // deviceFilter returns eBPF device filter program and its license string.
 func deviceFilter(rules []*devices.Rule) (asm.Instructions, string, error) {
+	cleanRules, defaultAllow, err := normalizeRules(rules)
+	if err != nil {
+		return nil, "", err
+	}
+	insts, err := linearProgram(cleanRules, defaultAllow)
+	if err != nil {
+		return nil, "", err
+	}
+	return insts, license, nil
+}
+
+// linearProgram generates the program of the linear device filter for a
+// normalized ruleset (see normalizeRules).
+func linearProgram(cleanRules []*devices.Rule, defaultAllow bool) (asm.Instructions, error) {
+	p := &program{
+		defaultAllow: defaultAllow,
+	}
+	p.init()
+
+	for _, rule := range cleanRules {
+		if err := p.appendRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	return p.finalize(), nil
+}
+
+// normalizeRules returns the minimum ruleset for the device rules we are
+// given (with the leading wildcard rule, if any, removed), and whether
+// the resulting filter should allow access by default.
+func normalizeRules(rules []*devices.Rule) ([]*devices.Rule, bool, error) {
 	// Generate the minimum ruleset for the device rules we are given. While we
 	// don't care about minimum transitions in cgroupv2, using the emulator
 	// gives us a guarantee that the behaviour of devices filtering is the same
@@ -32,39 +63,34 @@ func deviceFilter(rules []*devices.Rule) (asm.Instructions, string, error) {
 	emu := new(emulator)
 	for _, rule := range rules {
 		if err := emu.Apply(*rule); err != nil {
-			return nil, "", err
+			return nil, false, err
 		}
 	}
-	cleanRules, err := emu.Rules()
+	emuRules, err := emu.Rules()
 	if err != nil {
-		return nil, "", err
-	}
-
-	p := &program{
-		defaultAllow: emu.IsBlacklist(),
+		return nil, false, err
 	}
-	p.init()
 
-	for idx, rule := range cleanRules {
+	defaultAllow := emu.IsBlacklist()
+	cleanRules := make([]*devices.Rule, 0, len(emuRules))
+	for idx, rule := range emuRules {
 		if rule.Type == devices.WildcardDevice {
 			// We can safely skip over wildcard entries because there should
 			// only be one (at most) at the very start to instruct cgroupv1 to
 			// go into allow-list mode. However we do double-check this here.
-			if idx != 0 || rule.Allow != emu.IsBlacklist() {
-				return nil, "", fmt.Errorf("[internal error] emulated cgroupv2 devices ruleset had bad wildcard at idx %v (%s)", idx, rule.CgroupString())
+			if idx != 0 || rule.Allow != defaultAllow {
+				return nil, false, fmt.Errorf("[internal error] emulated cgroupv2 devices ruleset had bad wildcard at idx %v (%s)", idx, rule.CgroupString())
 			}
 			continue
 		}
-		if rule.Allow == p.defaultAllow {
+		if rule.Allow == defaultAllow {
 			// There should be no rules which have an action equal to the
 			// default action, the emulator removes those.
-			return nil, "", fmt.Errorf("[internal error] emulated cgroupv2 devices ruleset had no-op rule at idx %v (%s)", idx, rule.CgroupString())
-		}
-		if err := p.appendRule(rule); err != nil {
-			return nil, "", err
+			return nil, false, fmt.Errorf("[internal error] emulated cgroupv2 devices ruleset had no-op rule at idx %v (%s)", idx, rule.CgroupString())
 		}
+		cleanRules = append(cleanRules, rule)
 	}
-	return p.finalize(), license, nil
+	return cleanRules, defaultAllow, nil
 }
 
 type program struct {
@@ -109,37 +135,12 @@ func (p *program) appendRule(rule *devices.Rule) error {
 		return errors.New("the program is finalized")
 	}
 
-	var bpfType int32
-	switch rule.Type {
-	case devices.CharDevice:
-		bpfType = int32(unix.BPF_DEVCG_DEV_CHAR)
-	case devices.BlockDevice:
-		bpfType = int32(unix.BPF_DEVCG_DEV_BLOCK)
-	default:
-		// We do not permit 'a', nor any other types we don't know about.
-		return fmt.Errorf("invalid type %q", string(rule.Type))
-	}
-	if rule.Major > math.MaxUint32 {
-		return fmt.Errorf("invalid major %d", rule.Major)
-	}
-	if rule.Minor > math.MaxUint32 {
-		return fmt.Errorf("invalid minor %d", rule.Major)
+	bpfType, bpfAccess, err := bpfRuleParams(rule)
+	if err != nil {
+		return err
 	}
 	hasMajor := rule.Major >= 0 // if not specified in OCI json, major is set to -1
 	hasMinor := rule.Minor >= 0
-	bpfAccess := int32(0)
-	for _, r := range rule.Permissions {
-		switch r {
-		case 'r':
-			bpfAccess |= unix.BPF_DEVCG_ACC_READ
-		case 'w':
-			bpfAccess |= unix.BPF_DEVCG_ACC_WRITE
-		case 'm':
-			bpfAccess |= unix.BPF_DEVCG_ACC_MKNOD
-		default:
-			return fmt.Errorf("unknown device access %v", r)
-		}
-	}
 	// If the access is rwm, skip the check.
 	hasAccess := bpfAccess != (unix.BPF_DEVCG_ACC_READ | unix.BPF_DEVCG_ACC_WRITE | unix.BPF_DEVCG_ACC_MKNOD)
 
@@ -179,6 +180,41 @@ func (p *program) appendRule(rule *devices.Rule) error {
 	return nil
 }
 
+// bpfRuleParams validates the rule and returns its BPF_DEVCG_DEV_* type
+// and BPF_DEVCG_ACC_* access mask.
+func bpfRuleParams(rule *devices.Rule) (int32, int32, error) {
+	var bpfType int32
+	switch rule.Type {
+	case devices.CharDevice:
+		bpfType = int32(unix.BPF_DEVCG_DEV_CHAR)
+	case devices.BlockDevice:
+		bpfType = int32(unix.BPF_DEVCG_DEV_BLOCK)
+	default:
+		// We do not permit 'a', nor any other types we don't know about.
+		return 0, 0, fmt.Errorf("invalid type %q", string(rule.Type))
+	}
+	if rule.Major > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("invalid major %d", rule.Major)
+	}
+	if rule.Minor > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("invalid minor %d", rule.Minor)
+	}
+	bpfAccess := int32(0)
+	for _, r := range rule.Permissions {
+		switch r {
+		case 'r':
+			bpfAccess |= unix.BPF_DEVCG_ACC_READ
+		case 'w':
+			bpfAccess |= unix.BPF_DEVCG_ACC_WRITE
+		case 'm':
+			bpfAccess |= unix.BPF_DEVCG_ACC_MKNOD
+		default:
+			return 0, 0, fmt.Errorf("unknown device access %v", r)
+		}
+	}
+	return bpfType, bpfAccess, nil
+}
+
 func (p *program) finalize() asm.Instructions {
 	var v int32
 	if p.defaultAllow {
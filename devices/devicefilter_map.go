@@ -0,0 +1,183 @@
+package devices
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cilium/ebpf/asm"
+	devices "github.com/opencontainers/cgroups/devices/config"
+)
+
+// mapFilterThreshold is the number of normalized device rules (see
+// normalizeRules) above which setV2 uses a map-driven device filter (see
+// deviceFilterMaps) rather than a program with one instruction block per
+// rule. Large linear programs are slow to verify and may hit the kernel
+// instruction limits.
+const mapFilterThreshold = 64
+
+// Names of the maps used by the map-driven device filter. The maps are
+// looked up in this order, and the first entry found whose permissions
+// include the requested access decides the outcome.
+const (
+	mapExact    = "dev_exact"     // (type, major, minor)
+	mapAnyMinor = "dev_any_minor" // (type, major, *)
+	mapAnyMajor = "dev_any_major" // (type, *, minor)
+	mapAny      = "dev_any"       // (type, *, *)
+)
+
+var deviceMapNames = [...]string{mapExact, mapAnyMinor, mapAnyMajor, mapAny}
+
+// deviceMapKey is the key of every device filter map. Fields which are
+// wildcards for a given map are always zero.
+type deviceMapKey struct {
+	Type  uint32
+	Major uint32
+	Minor uint32
+}
+
+// deviceMaps holds the contents of the maps used by the map-driven device
+// filter, indexed by map name. Values are BPF_DEVCG_ACC_* access masks.
+type deviceMaps map[string]map[deviceMapKey]uint32
+
+// deviceFilterMaps returns a map-driven eBPF device filter program, the
+// contents of the maps it references, and its license string.
+//
+// Unlike deviceFilter, the size of the program does not depend on the
+// number of rules. The rules are normalized by the emulator in the same
+// way, so both filters accept and deny exactly the same accesses.
+func deviceFilterMaps(rules []*devices.Rule) (asm.Instructions, deviceMaps, string, error) {
+	cleanRules, defaultAllow, err := normalizeRules(rules)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	insts, maps, err := mapFilter(cleanRules, defaultAllow)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return insts, maps, license, nil
+}
+
+// buildDeviceFilter returns the device filter program setV2 loads for
+// rules, the contents of the maps it references (nil for the linear
+// filter), and its license string. The filter is chosen by the size of
+// the normalized ruleset, which is what the linear program grows with,
+// rather than by the number of rules given (which may contain duplicates,
+// or rules overridden by later ones).
+func buildDeviceFilter(rules []*devices.Rule) (asm.Instructions, deviceMaps, string, error) {
+	cleanRules, defaultAllow, err := normalizeRules(rules)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var (
+		insts asm.Instructions
+		maps  deviceMaps
+	)
+	if len(cleanRules) > mapFilterThreshold {
+		insts, maps, err = mapFilter(cleanRules, defaultAllow)
+	} else {
+		insts, err = linearProgram(cleanRules, defaultAllow)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return insts, maps, license, nil
+}
+
+// mapFilter generates the program and the map contents of the map-driven
+// device filter for a normalized ruleset (see normalizeRules).
+func mapFilter(cleanRules []*devices.Rule, defaultAllow bool) (asm.Instructions, deviceMaps, error) {
+	maps := make(deviceMaps, len(deviceMapNames))
+	for _, name := range deviceMapNames {
+		maps[name] = make(map[deviceMapKey]uint32)
+	}
+	for _, rule := range cleanRules {
+		bpfType, bpfAccess, err := bpfRuleParams(rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := deviceMapKey{Type: uint32(bpfType)}
+		var name string
+		switch {
+		case rule.Major >= 0 && rule.Minor >= 0:
+			name = mapExact
+			key.Major, key.Minor = uint32(rule.Major), uint32(rule.Minor)
+		case rule.Major >= 0:
+			name = mapAnyMinor
+			key.Major = uint32(rule.Major)
+		case rule.Minor >= 0:
+			name = mapAnyMajor
+			key.Minor = uint32(rule.Minor)
+		default:
+			name = mapAny
+		}
+		// The emulator merges rules with the same match, so there can't
+		// be any duplicates (and merging their permissions here would
+		// change the semantics of the filter).
+		if _, ok := maps[name][key]; ok {
+			return nil, nil, fmt.Errorf("[internal error] emulated cgroupv2 devices ruleset had duplicate rule (%s)", rule.CgroupString())
+		}
+		maps[name][key] = uint32(bpfAccess)
+	}
+
+	return mapProgram(!defaultAllow), maps, nil
+}
+
+// mapProgram generates the fixed program used by the map-driven device
+// filter. For every map, it looks up the key built from the device being
+// accessed, and returns match if the permissions stored in the map cover
+// the requested access. If there is no such entry in any of the maps, the
+// opposite of match is returned.
+func mapProgram(match bool) asm.Instructions {
+	p := &program{defaultAllow: !match}
+	p.init()
+
+	// Registers R1-R5 are clobbered by helper calls, so move the
+	// parameters to callee-saved registers.
+	p.insts = append(p.insts,
+		asm.Mov.Reg(asm.R6, asm.R3), // access
+		asm.Mov.Reg(asm.R7, asm.R4), // major
+		asm.Mov.Reg(asm.R8, asm.R5), // minor
+		asm.Mov.Reg(asm.R9, asm.R2), // type
+	)
+
+	// The key (struct deviceMapKey) is stored on the stack at R10-16.
+	const keyOff = -16
+	for _, name := range deviceMapNames {
+		var (
+			blockSym     = "block-" + strconv.Itoa(p.blockID)
+			nextBlockSym = "block-" + strconv.Itoa(p.blockID+1)
+			first        = len(p.insts)
+		)
+		p.insts = append(p.insts,
+			asm.StoreMem(asm.RFP, keyOff, asm.R9, asm.Word),
+		)
+		if name == mapExact || name == mapAnyMinor {
+			p.insts = append(p.insts, asm.StoreMem(asm.RFP, keyOff+4, asm.R7, asm.Word))
+		} else {
+			p.insts = append(p.insts, asm.StoreImm(asm.RFP, keyOff+4, 0, asm.Word))
+		}
+		if name == mapExact || name == mapAnyMajor {
+			p.insts = append(p.insts, asm.StoreMem(asm.RFP, keyOff+8, asm.R8, asm.Word))
+		} else {
+			p.insts = append(p.insts, asm.StoreImm(asm.RFP, keyOff+8, 0, asm.Word))
+		}
+		p.insts = append(p.insts,
+			// R0 <- map_lookup_elem(map, R10-16)
+			asm.LoadMapPtr(asm.R1, 0).WithReference(name),
+			asm.Mov.Reg(asm.R2, asm.RFP),
+			asm.Add.Imm(asm.R2, keyOff),
+			asm.FnMapLookupElem.Call(),
+			// if (R0 == NULL) goto next
+			asm.JEq.Imm(asm.R0, 0, nextBlockSym),
+			// if (*R0 & access != access) goto next
+			asm.LoadMem(asm.R1, asm.R0, 0, asm.Word),
+			asm.And.Reg32(asm.R1, asm.R6),
+			asm.JNE.Reg(asm.R1, asm.R6, nextBlockSym),
+		)
+		p.insts = append(p.insts, acceptBlock(match)...)
+		p.insts[first] = p.insts[first].WithSymbol(blockSym)
+		p.blockID++
+	}
+
+	return p.finalize()
+}
@@ -0,0 +1,322 @@
+package devices
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+	devices "github.com/opencontainers/cgroups/devices/config"
+	"golang.org/x/sys/unix"
+)
+
+// Pointer values used by runFilter. The upper bits tell which memory
+// region a pointer refers to, and the lower bits are the offset.
+const (
+	ptrCtx   = 1 << 40
+	ptrStack = 2 << 40
+	ptrValue = 3 << 40
+	ptrMap   = 4 << 40
+	ptrMask  = 0xff << 40
+)
+
+// runFilter is a minimal interpreter for the subset of eBPF generated by
+// deviceFilter and deviceFilterMaps. It returns the value of R0 upon exit.
+func runFilter(t *testing.T, insts asm.Instructions, maps deviceMaps, typ, access, major, minor uint32) uint64 {
+	t.Helper()
+
+	syms := make(map[string]int)
+	for i, ins := range insts {
+		if sym := ins.Symbol(); sym != "" {
+			syms[sym] = i
+		}
+	}
+
+	var (
+		regs   [asm.R10 + 1]uint64
+		ctx    = [3]uint32{typ | access<<16, major, minor}
+		stack  = make(map[uint64]uint32)
+		values []uint32
+	)
+	regs[asm.R1] = ptrCtx
+	regs[asm.RFP] = ptrStack | 512
+
+	load := func(addr uint64) uint32 {
+		off := addr &^ ptrMask
+		switch addr & ptrMask {
+		case ptrCtx:
+			return ctx[off/4]
+		case ptrStack:
+			v, ok := stack[off]
+			if !ok {
+				t.Fatalf("read of uninitialized stack at %d", off)
+			}
+			return v
+		case ptrValue:
+			return values[off]
+		}
+		t.Fatalf("invalid load from %#x", addr)
+		return 0
+	}
+	store := func(addr uint64, v uint32) {
+		if addr&ptrMask != ptrStack {
+			t.Fatalf("invalid store to %#x", addr)
+		}
+		stack[addr&^ptrMask] = v
+	}
+
+	for pc, steps := 0, 0; ; steps++ {
+		if pc >= len(insts) || steps > 10000 {
+			t.Fatalf("program ran away (pc %d, steps %d)", pc, steps)
+		}
+		ins := insts[pc]
+		pc++
+
+		switch class := ins.OpCode.Class(); class {
+		case asm.LdXClass:
+			regs[ins.Dst] = uint64(load(regs[ins.Src] + uint64(ins.Offset)))
+		case asm.StXClass:
+			store(regs[ins.Dst]+uint64(ins.Offset), uint32(regs[ins.Src]))
+		case asm.StClass:
+			store(regs[ins.Dst]+uint64(ins.Offset), uint32(ins.Constant))
+		case asm.LdClass:
+			if !ins.IsLoadFromMap() {
+				t.Fatalf("unexpected instruction %v", ins)
+			}
+			idx := -1
+			for i, name := range deviceMapNames {
+				if name == ins.Reference() {
+					idx = i
+				}
+			}
+			if idx < 0 {
+				t.Fatalf("reference to unknown map %q", ins.Reference())
+			}
+			regs[ins.Dst] = ptrMap | uint64(idx)
+		case asm.ALUClass, asm.ALU64Class:
+			src := uint64(ins.Constant)
+			if ins.OpCode.Source() == asm.RegSource {
+				src = regs[ins.Src]
+			}
+			dst := regs[ins.Dst]
+			switch ins.OpCode.ALUOp() {
+			case asm.Mov:
+				dst = src
+			case asm.And:
+				dst &= src
+			case asm.Add:
+				dst += src
+			case asm.RSh:
+				dst >>= src
+			default:
+				t.Fatalf("unexpected instruction %v", ins)
+			}
+			if class == asm.ALUClass {
+				dst = uint64(uint32(dst))
+			}
+			regs[ins.Dst] = dst
+		case asm.JumpClass:
+			var taken bool
+			switch op := ins.OpCode.JumpOp(); op {
+			case asm.Exit:
+				return regs[asm.R0]
+			case asm.Call:
+				if ins.Constant != int64(asm.FnMapLookupElem) || regs[asm.R1]&ptrMask != ptrMap {
+					t.Fatalf("unexpected call %v", ins)
+				}
+				key := deviceMapKey{
+					Type:  load(regs[asm.R2]),
+					Major: load(regs[asm.R2] + 4),
+					Minor: load(regs[asm.R2] + 8),
+				}
+				regs[asm.R0] = 0
+				if v, ok := maps[deviceMapNames[regs[asm.R1]&^ptrMask]][key]; ok {
+					values = append(values, v)
+					regs[asm.R0] = ptrValue | uint64(len(values)-1)
+				}
+				// R1-R5 are clobbered by calls.
+				for r := asm.R1; r <= asm.R5; r++ {
+					regs[r] = 0xdeadbeef
+				}
+				continue
+			case asm.JEq, asm.JNE:
+				src := uint64(ins.Constant)
+				if ins.OpCode.Source() == asm.RegSource {
+					src = regs[ins.Src]
+				}
+				taken = (regs[ins.Dst] == src) == (op == asm.JEq)
+			default:
+				t.Fatalf("unexpected instruction %v", ins)
+			}
+			if taken {
+				target, ok := syms[ins.Reference()]
+				if !ok {
+					t.Fatalf("jump to unknown symbol %q", ins.Reference())
+				}
+				pc = target
+			}
+		default:
+			t.Fatalf("unexpected instruction %v", ins)
+		}
+	}
+}
+
+// compareFilters checks that the linear and the map-driven device filters
+// generated for rules give the same verdict for every access in a range of
+// devices.
+func compareFilters(t *testing.T, rules []*devices.Rule, majors, minors []uint32) {
+	t.Helper()
+
+	linear, _, err := deviceFilter(rules)
+	if err != nil {
+		t.Fatalf("deviceFilter: %v", err)
+	}
+	mapped, maps, _, err := deviceFilterMaps(rules)
+	if err != nil {
+		t.Fatalf("deviceFilterMaps: %v", err)
+	}
+
+	types := []uint32{unix.BPF_DEVCG_DEV_BLOCK, unix.BPF_DEVCG_DEV_CHAR}
+	for _, typ := range types {
+		for _, major := range majors {
+			for _, minor := range minors {
+				for access := uint32(1); access <= 7; access++ {
+					want := runFilter(t, linear, nil, typ, access, major, minor)
+					got := runFilter(t, mapped, maps, typ, access, major, minor)
+					if got != want {
+						t.Errorf("type %d, %d:%d, access %d: map filter returned %d, linear filter returned %d", typ, major, minor, access, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDeviceFilterMaps_Equivalence(t *testing.T) {
+	const wildcard = devices.Wildcard
+	majors := []uint32{0, 1, 5, 8, 10, 136, 195, 200}
+	minors := []uint32{0, 1, 2, 3, 5, 7, 8, 9, 200, 255}
+
+	tests := []struct {
+		name  string
+		rules []*devices.Rule
+	}{
+		{name: "nil"},
+		{
+			name: "allow all",
+			rules: []*devices.Rule{
+				{Type: 'a', Major: wildcard, Minor: wildcard, Permissions: "rwm", Allow: true},
+			},
+		},
+		{
+			name: "allow all except",
+			rules: []*devices.Rule{
+				{Type: 'a', Major: wildcard, Minor: wildcard, Permissions: "rwm", Allow: true},
+				{Type: 'b', Major: 8, Minor: 0, Permissions: "rwm", Allow: false},
+				{Type: 'c', Major: 136, Minor: wildcard, Permissions: "w", Allow: false},
+				{Type: 'c', Major: wildcard, Minor: 3, Permissions: "m", Allow: false},
+			},
+		},
+		{
+			name: "allow list",
+			rules: []*devices.Rule{
+				{Type: 'c', Major: wildcard, Minor: wildcard, Permissions: "m", Allow: true},
+				{Type: 'b', Major: wildcard, Minor: wildcard, Permissions: "m", Allow: true},
+				{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+				{Type: 'c', Major: 1, Minor: 5, Permissions: "rw", Allow: true},
+				{Type: 'c', Major: 1, Minor: 7, Permissions: "r", Allow: true},
+				{Type: 'c', Major: 136, Minor: wildcard, Permissions: "rwm", Allow: true},
+				{Type: 'c', Major: wildcard, Minor: 200, Permissions: "rw", Allow: true},
+				{Type: 'b', Major: 8, Minor: wildcard, Permissions: "r", Allow: true},
+				{Type: 'b', Major: 8, Minor: 1, Permissions: "w", Allow: true},
+				{Type: 'c', Major: 1, Minor: 5, Permissions: "w", Allow: false},
+			},
+		},
+	}
+
+	// Many GPU-like devices, with a few rules denying some of them again.
+	var gpus []*devices.Rule
+	for minor := int64(0); minor < 256; minor++ {
+		gpus = append(gpus, &devices.Rule{Type: 'c', Major: 195, Minor: minor, Permissions: "rw", Allow: true})
+	}
+	gpus = append(gpus,
+		&devices.Rule{Type: 'c', Major: 195, Minor: 255, Permissions: "rwm", Allow: true},
+		&devices.Rule{Type: 'c', Major: 195, Minor: 7, Permissions: "w", Allow: false},
+		&devices.Rule{Type: 'c', Major: wildcard, Minor: 9, Permissions: "rwm", Allow: true},
+	)
+	tests = append(tests, struct {
+		name  string
+		rules []*devices.Rule
+	}{name: "many devices", rules: gpus})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			compareFilters(t, tc.rules, majors, minors)
+		})
+	}
+}
+
+func TestDeviceFilterMaps_FixedSize(t *testing.T) {
+	small, _, _, err := deviceFilterMaps(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules []*devices.Rule
+	for i := int64(0); i < 1000; i++ {
+		rules = append(rules, &devices.Rule{Type: 'c', Major: 200 + i/100, Minor: i, Permissions: "rwm", Allow: true})
+	}
+	large, maps, _, err := deviceFilterMaps(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small) != len(large) {
+		t.Errorf("program size depends on the number of rules: %d vs %d", len(small), len(large))
+	}
+	if n := len(maps[mapExact]); n != len(rules) {
+		t.Errorf("expected %d entries in %s, got %d", len(rules), mapExact, n)
+	}
+	for _, name := range []string{mapAnyMinor, mapAnyMajor, mapAny} {
+		if n := len(maps[name]); n != 0 {
+			t.Errorf("expected no entries in %s, got %d", name, n)
+		}
+	}
+}
+
+func TestBuildDeviceFilter_Threshold(t *testing.T) {
+	rule := func(minor int64) *devices.Rule {
+		return &devices.Rule{Type: 'c', Major: 195, Minor: minor, Permissions: "rwm", Allow: true}
+	}
+	distinct := func(n int64) []*devices.Rule {
+		var rules []*devices.Rule
+		for minor := int64(0); minor < n; minor++ {
+			rules = append(rules, rule(minor))
+		}
+		return rules
+	}
+
+	// Duplicate rules and rules overridden by later ones are not
+	// counted, as they are not in the generated program.
+	var dups []*devices.Rule
+	for i := 0; i < 2*mapFilterThreshold; i++ {
+		dups = append(dups, rule(0))
+	}
+	overridden := distinct(mapFilterThreshold + 1)
+	overridden = append(overridden, &devices.Rule{Type: 'a', Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "rwm", Allow: true})
+
+	for _, tc := range []struct {
+		name    string
+		rules   []*devices.Rule
+		useMaps bool
+	}{
+		{name: "duplicates", rules: dups},
+		{name: "overridden", rules: overridden},
+		{name: "at threshold", rules: distinct(mapFilterThreshold)},
+		{name: "above threshold", rules: distinct(mapFilterThreshold + 1), useMaps: true},
+	} {
+		_, maps, _, err := buildDeviceFilter(tc.rules)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if useMaps := maps != nil; useMaps != tc.useMaps {
+			t.Errorf("%s: expected map filter %v, got %v", tc.name, tc.useMaps, useMaps)
+		}
+	}
+}
@@ -13,4 +13,6 @@ func init() {
 	cgroups.DevicesSetV1 = setV1
 	cgroups.DevicesSetV2 = setV2
 	systemd.GenerateDeviceProps = systemdProperties
+	systemd.ParseDeviceProps = systemdRules
+	systemd.DevicesUnchangedV1 = devicesUnchangedV1
 }
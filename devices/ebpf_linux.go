@@ -154,7 +154,10 @@ func haveBpfProgReplace() bool {
 // Requires the system to be running in cgroup2 unified-mode with kernel >= 4.15 .
 //
 // https://github.com/torvalds/linux/commit/ebc614f687369f9df99828572b1d85a7c2de3d92
-func loadAttachCgroupDeviceFilter(insts asm.Instructions, license string, dirFd int) (func() error, error) {
+//
+// If maps is not nil, the maps referenced by insts are created and
+// populated from it before the program is loaded.
+func loadAttachCgroupDeviceFilter(insts asm.Instructions, maps deviceMaps, license string, dirFd int) (func() error, error) {
 	// Increase `ulimit -l` limit to avoid BPF_PROG_LOAD error (#2167).
 	// This limit is not inherited into the container.
 	memlockLimit := &unix.Rlimit{
@@ -170,6 +173,16 @@ func loadAttachCgroupDeviceFilter(insts asm.Instructions, license string, dirFd
 	}
 	useReplaceProg := haveBpfProgReplace() && len(oldProgs) == 1
 
+	if maps != nil {
+		// The program holds its own references to the maps, so we can
+		// close ours once the program is loaded.
+		closeMaps, err := associateDeviceMaps(insts, maps)
+		defer closeMaps()
+		if err != nil {
+			return nilCloser, err
+		}
+	}
+
 	// Generate new program.
 	spec := &ebpf.ProgramSpec{
 		Type:         ebpf.CGroupDevice,
@@ -254,3 +267,50 @@ func loadAttachCgroupDeviceFilter(insts asm.Instructions, license string, dirFd
 	}
 	return closer, nil
 }
+
+// associateDeviceMaps creates the maps described by maps, and associates
+// them with the instructions in insts which reference them. The returned
+// function closes the created maps.
+func associateDeviceMaps(insts asm.Instructions, maps deviceMaps) (func(), error) {
+	var created []*ebpf.Map
+	closeMaps := func() {
+		for _, m := range created {
+			m.Close()
+		}
+	}
+
+	byName := make(map[string]*ebpf.Map, len(maps))
+	for name, entries := range maps {
+		spec := &ebpf.MapSpec{
+			Name:       name,
+			Type:       ebpf.Hash,
+			KeySize:    uint32(unsafe.Sizeof(deviceMapKey{})),
+			ValueSize:  4,
+			MaxEntries: uint32(max(len(entries), 1)),
+		}
+		for key, access := range entries {
+			spec.Contents = append(spec.Contents, ebpf.MapKV{Key: key, Value: access})
+		}
+		m, err := ebpf.NewMap(spec)
+		if err != nil {
+			return closeMaps, fmt.Errorf("failed to create device filter map %s: %w", name, err)
+		}
+		created = append(created, m)
+		byName[name] = m
+	}
+
+	for i := range insts {
+		ref := insts[i].Reference()
+		if ref == "" || !insts[i].IsLoadFromMap() {
+			continue
+		}
+		m, ok := byName[ref]
+		if !ok {
+			return closeMaps, fmt.Errorf("[internal error] device filter references unknown map %q", ref)
+		}
+		if err := insts[i].AssociateMap(m); err != nil {
+			return closeMaps, err
+		}
+	}
+	return closeMaps, nil
+}
@@ -10,6 +10,7 @@ import (
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/godbus/dbus/v5"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 
 	"github.com/opencontainers/cgroups"
 	devices "github.com/opencontainers/cgroups/devices/config"
@@ -166,6 +167,145 @@ func systemdProperties(r *cgroups.Resources, sdVer int) ([]systemdDbus.Property,
 	return properties, nil
 }
 
+// systemdPseudoDevices are the devices systemd allows access to with
+// DevicePolicy=closed, or DevicePolicy=auto with non-empty DeviceAllow.
+var systemdPseudoDevices = []*devices.Rule{
+	{Type: devices.CharDevice, Major: 1, Minor: 3, Permissions: "rwm", Allow: true},                 // /dev/null
+	{Type: devices.CharDevice, Major: 1, Minor: 5, Permissions: "rwm", Allow: true},                 // /dev/zero
+	{Type: devices.CharDevice, Major: 1, Minor: 7, Permissions: "rwm", Allow: true},                 // /dev/full
+	{Type: devices.CharDevice, Major: 1, Minor: 8, Permissions: "rwm", Allow: true},                 // /dev/random
+	{Type: devices.CharDevice, Major: 1, Minor: 9, Permissions: "rwm", Allow: true},                 // /dev/urandom
+	{Type: devices.CharDevice, Major: 5, Minor: 0, Permissions: "rwm", Allow: true},                 // /dev/tty
+	{Type: devices.CharDevice, Major: 5, Minor: 2, Permissions: "rwm", Allow: true},                 // /dev/ptmx
+	{Type: devices.CharDevice, Major: 136, Minor: devices.Wildcard, Permissions: "rw", Allow: true}, // char-pts
+}
+
+// systemdRules is the reverse of systemdProperties. It converts the
+// DevicePolicy and DeviceAllow unit properties to a set of device rules.
+// Entries systemd would ignore (such as paths of non-existent devices)
+// are skipped.
+func systemdRules(props []systemdDbus.Property) ([]*devices.Rule, error) {
+	policy := "auto"
+	var allow []deviceAllowEntry
+	for _, p := range props {
+		var err error
+		switch p.Name {
+		case "DevicePolicy":
+			err = p.Value.Store(&policy)
+		case "DeviceAllow":
+			err = p.Value.Store(&allow)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %s: %w", p.Name, p.Value, err)
+		}
+	}
+
+	if policy == "auto" && len(allow) == 0 {
+		return []*devices.Rule{{
+			Type:        devices.WildcardDevice,
+			Major:       devices.Wildcard,
+			Minor:       devices.Wildcard,
+			Permissions: "rwm",
+			Allow:       true,
+		}}, nil
+	}
+
+	rules := []*devices.Rule{{
+		Type:        devices.WildcardDevice,
+		Major:       devices.Wildcard,
+		Minor:       devices.Wildcard,
+		Permissions: "rwm",
+		Allow:       false,
+	}}
+	switch policy {
+	case "auto", "closed":
+		for _, rule := range systemdPseudoDevices {
+			r := *rule
+			rules = append(rules, &r)
+		}
+	case "strict":
+	default:
+		return nil, fmt.Errorf("unknown DevicePolicy value %q", policy)
+	}
+	for _, entry := range allow {
+		entryRules, err := deviceAllowEntryRules(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, entryRules...)
+	}
+	return rules, nil
+}
+
+// deviceAllowEntryRules converts a DeviceAllow entry to device rules.
+func deviceAllowEntryRules(entry deviceAllowEntry) ([]*devices.Rule, error) {
+	perms := devices.Permissions(entry.Perms)
+	if !perms.IsValid() {
+		return nil, fmt.Errorf("invalid DeviceAllow entry %q permissions %q", entry.Path, entry.Perms)
+	}
+	rule := func(t devices.Type, major, minor int64) *devices.Rule {
+		return &devices.Rule{Type: t, Major: major, Minor: minor, Permissions: perms, Allow: true}
+	}
+
+	// /dev/{block,char}/MAJOR:minor.
+	for prefix, t := range map[string]devices.Type{"/dev/block/": devices.BlockDevice, "/dev/char/": devices.CharDevice} {
+		if majMin, ok := strings.CutPrefix(entry.Path, prefix); ok {
+			if maj, min, ok := strings.Cut(majMin, ":"); ok {
+				major, err1 := strconv.ParseInt(maj, 10, 64)
+				minor, err2 := strconv.ParseInt(min, 10, 64)
+				if err1 == nil && err2 == nil {
+					return []*devices.Rule{rule(t, major, minor)}, nil
+				}
+			}
+		}
+	}
+
+	// {block,char}-*, {block,char}-MAJOR, and {block,char}-GROUP.
+	for _, t := range []devices.Type{devices.BlockDevice, devices.CharDevice} {
+		prefix, _ := groupPrefix(t)
+		name, ok := strings.CutPrefix(entry.Path, prefix)
+		if !ok {
+			continue
+		}
+		if name == "*" {
+			return []*devices.Rule{rule(t, devices.Wildcard, devices.Wildcard)}, nil
+		}
+		if major, err := strconv.ParseInt(name, 10, 64); err == nil {
+			return []*devices.Rule{rule(t, major, devices.Wildcard)}, nil
+		}
+		majors, err := findDeviceGroupMajors(t, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find device group %q: %w", entry.Path, err)
+		}
+		if len(majors) == 0 {
+			logrus.Debugf("device group %q not found in /proc/devices -- ignoring DeviceAllow entry", entry.Path)
+		}
+		var rules []*devices.Rule
+		for _, major := range majors {
+			rules = append(rules, rule(t, major, devices.Wildcard))
+		}
+		return rules, nil
+	}
+
+	// Any other device node path.
+	var st unix.Stat_t
+	if err := unix.Stat(entry.Path, &st); err != nil {
+		logrus.Debugf("unable to stat DeviceAllow entry %q -- ignoring: %v", entry.Path, err)
+		return nil, nil
+	}
+	var t devices.Type
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFBLK:
+		t = devices.BlockDevice
+	case unix.S_IFCHR:
+		t = devices.CharDevice
+	default:
+		logrus.Debugf("DeviceAllow entry %q is not a device -- ignoring", entry.Path)
+		return nil, nil
+	}
+	return []*devices.Rule{rule(t, int64(unix.Major(st.Rdev)), int64(unix.Minor(st.Rdev)))}, nil
+}
+
 func newProp(name string, units any) systemdDbus.Property {
 	return systemdDbus.Property{
 		Name:  name,
@@ -235,6 +375,50 @@ func findDeviceGroup(ruleType devices.Type, ruleMajor int64) (string, error) {
 	return "", nil
 }
 
+// findDeviceGroupMajors returns the major numbers of a device group
+// (as listed in /proc/devices) of the given type, which is the reverse
+// of findDeviceGroup.
+func findDeviceGroupMajors(ruleType devices.Type, group string) ([]int64, error) {
+	fh, err := os.Open("/proc/devices")
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var (
+		majors      []int64
+		currentType devices.Type
+	)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "Block devices:":
+			currentType = devices.BlockDevice
+			continue
+		case "Character devices:":
+			currentType = devices.CharDevice
+			continue
+		case "":
+			continue
+		}
+		if currentType != ruleType {
+			continue
+		}
+		major, name, ok := strings.Cut(line, " ")
+		if !ok || name != group {
+			continue
+		}
+		if n, err := strconv.ParseInt(major, 10, 64); err == nil {
+			majors = append(majors, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading /proc/devices: %w", err)
+	}
+	return majors, nil
+}
+
 // DeviceAllow is the dbus type "a(ss)" which means we need a struct
 // to represent it in Go.
 type deviceAllowEntry struct {
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+
 	"github.com/opencontainers/cgroups"
 	devices "github.com/opencontainers/cgroups/devices/config"
 	"github.com/opencontainers/cgroups/systemd"
@@ -277,3 +280,103 @@ func newManager(t *testing.T, config *cgroups.Cgroup) (m cgroups.Manager) {
 
 	return m
 }
+
+func TestSystemdRules(t *testing.T) {
+	allowRule := func(t devices.Type, major, minor int64, perms devices.Permissions) *devices.Rule {
+		return &devices.Rule{Type: t, Major: major, Minor: minor, Permissions: perms, Allow: true}
+	}
+	denyAll := &devices.Rule{Type: devices.WildcardDevice, Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "rwm"}
+	allowAll := *denyAll
+	allowAll.Allow = true
+
+	for _, tc := range []struct {
+		name  string
+		rules []*devices.Rule
+	}{
+		{
+			name:  "allow all",
+			rules: []*devices.Rule{&allowAll},
+		},
+		{
+			name:  "deny all",
+			rules: []*devices.Rule{denyAll},
+		},
+		{
+			name: "mixed",
+			rules: []*devices.Rule{
+				denyAll,
+				allowRule(devices.CharDevice, 1, 3, "rwm"),
+				allowRule(devices.CharDevice, 10, 200, "rw"),
+				allowRule(devices.BlockDevice, 8, devices.Wildcard, "r"),
+				allowRule(devices.CharDevice, devices.Wildcard, devices.Wildcard, "m"),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			props, err := systemdProperties(&cgroups.Resources{Devices: tc.rules}, 255)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only the last DeviceAllow property is in effect.
+			got, err := systemdRules(props)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareRules(t, tc.rules, got)
+		})
+	}
+}
+
+func TestSystemdRulesDbusValue(t *testing.T) {
+	// Values received over dbus have a generic type.
+	props := []systemdDbus.Property{
+		newProp("DevicePolicy", "closed"),
+		newProp("DeviceAllow", [][]any{{"/dev/block/8:1", "rw"}, {"char-5", "r"}}),
+	}
+	got, err := systemdRules(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*devices.Rule{
+		{Type: devices.WildcardDevice, Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "rwm"},
+		{Type: devices.BlockDevice, Major: 8, Minor: 1, Permissions: "rw", Allow: true},
+		{Type: devices.CharDevice, Major: 5, Minor: devices.Wildcard, Permissions: "r", Allow: true},
+	}
+	want = append(want, systemdPseudoDevices...)
+	compareRules(t, want, got)
+
+	props[0] = newProp("DevicePolicy", "bogus")
+	if _, err := systemdRules(props); err == nil {
+		t.Error("expected an error for unknown DevicePolicy")
+	}
+}
+
+// compareRules checks that two sets of rules have the same effect.
+func compareRules(t *testing.T, want, got []*devices.Rule) {
+	t.Helper()
+	rules := func(list []*devices.Rule) []*devices.Rule {
+		var e emulator
+		for _, rule := range list {
+			if err := e.Apply(*rule); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := e.Rules()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	w, g := rules(want), rules(got)
+	if !reflect.DeepEqual(w, g) {
+		t.Errorf("rules mismatch:\nwant %v\n got %v", ruleList(w), ruleList(g))
+	}
+}
+
+func ruleList(rules []*devices.Rule) []string {
+	list := make([]string, 0, len(rules))
+	for _, r := range rules {
+		list = append(list, r.CgroupString())
+	}
+	return list
+}
@@ -71,6 +71,25 @@ func loadEmulator(path string) (*emulator, error) {
 	return emulatorFromList(bytes.NewBufferString(list))
 }
 
+// devicesUnchangedV1 answers whether the device rules currently in effect
+// in the devices cgroup at path are the same as the ones in r, meaning
+// setting r.Devices would not result in any transition rules.
+func devicesUnchangedV1(path string, r *cgroups.Resources) (bool, error) {
+	current, err := loadEmulator(path)
+	if err != nil {
+		return false, err
+	}
+	target, err := buildEmulator(r.Devices)
+	if err != nil {
+		return false, err
+	}
+	rules, err := current.Transition(target)
+	if err != nil {
+		return false, err
+	}
+	return len(rules) == 0, nil
+}
+
 func buildEmulator(rules []*devices.Rule) (*emulator, error) {
 	// This defaults to a white-list -- which is what we want!
 	emu := &emulator{}
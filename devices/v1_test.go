@@ -66,3 +66,38 @@ func TestSetV1Allow(t *testing.T) {
 		t.Errorf("Got the wrong value (%q), set devices.allow failed.", value)
 	}
 }
+
+func TestDevicesUnchangedV1(t *testing.T) {
+	rules := []*devices.Rule{
+		{
+			Type:        devices.CharDevice,
+			Major:       1,
+			Minor:       5,
+			Permissions: devices.Permissions("rwm"),
+			Allow:       true,
+		},
+	}
+	for _, tc := range []struct {
+		list      string
+		unchanged bool
+	}{
+		{list: "c 1:5 rwm", unchanged: true},
+		{list: "c 1:5 rw", unchanged: false},
+		{list: "c 1:5 rwm\nc 1:3 rwm", unchanged: false},
+		{list: "", unchanged: false},
+		// A black-list can't be updated without a disruptive deny-all.
+		{list: "a *:* rwm", unchanged: false},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(path.Join(dir, "devices.list"), []byte(tc.list), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		unchanged, err := devicesUnchangedV1(dir, &cgroups.Resources{Devices: rules})
+		if err != nil {
+			t.Fatalf("list %q: %v", tc.list, err)
+		}
+		if unchanged != tc.unchanged {
+			t.Errorf("list %q: expected unchanged %v, got %v", tc.list, tc.unchanged, unchanged)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type BlkioGroup struct {
@@ -24,47 +25,55 @@ func (s *BlkioGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 }
 
 func (s *BlkioGroup) Set(path string, r *cgroups.Resources) error {
-	s.detectWeightFilenames(path)
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *BlkioGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
+	// The file names are detected (and cached) only when needed, as
+	// path may be empty if the blkio cgroup does not exist.
+	if r.BlkioWeight != 0 || len(r.BlkioWeightDevice) > 0 {
+		s.detectWeightFilenames(path)
+	}
 	if r.BlkioWeight != 0 {
-		if err := cgroups.WriteFile(path, s.weightFilename, strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
+		if err := w.WriteFile(path, s.weightFilename, strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
 			return err
 		}
 	}
 
 	if r.BlkioLeafWeight != 0 {
-		if err := cgroups.WriteFile(path, "blkio.leaf_weight", strconv.FormatUint(uint64(r.BlkioLeafWeight), 10)); err != nil {
+		if err := w.WriteFile(path, "blkio.leaf_weight", strconv.FormatUint(uint64(r.BlkioLeafWeight), 10)); err != nil {
 			return err
 		}
 	}
 	for _, wd := range r.BlkioWeightDevice {
 		if wd.Weight != 0 {
-			if err := cgroups.WriteFile(path, s.weightDeviceFilename, wd.WeightString()); err != nil {
+			if err := w.WriteFile(path, s.weightDeviceFilename, wd.WeightString()); err != nil {
 				return err
 			}
 		}
 		if wd.LeafWeight != 0 {
-			if err := cgroups.WriteFile(path, "blkio.leaf_weight_device", wd.LeafWeightString()); err != nil {
+			if err := w.WriteFile(path, "blkio.leaf_weight_device", wd.LeafWeightString()); err != nil {
 				return err
 			}
 		}
 	}
 	for _, td := range r.BlkioThrottleReadBpsDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.read_bps_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.read_bps_device", td.String()); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteBpsDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.write_bps_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.write_bps_device", td.String()); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleReadIOPSDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.read_iops_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.read_iops_device", td.String()); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteIOPSDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.write_iops_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.write_iops_device", td.String()); err != nil {
 			return err
 		}
 	}
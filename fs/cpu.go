@@ -34,10 +34,14 @@ func (s *CpuGroup) Apply(path string, r *cgroups.Resources, pid int) error {
 }
 
 func (s *CpuGroup) SetRtSched(path string, r *cgroups.Resources) error {
+	return setRtSched(fscommon.FileWriter{}, path, r)
+}
+
+func setRtSched(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	var period string
 	if r.CpuRtPeriod != 0 {
 		period = strconv.FormatUint(r.CpuRtPeriod, 10)
-		if err := cgroups.WriteFile(path, "cpu.rt_period_us", period); err != nil {
+		if err := w.WriteFile(path, "cpu.rt_period_us", period); err != nil {
 			// The values of cpu.rt_period_us and cpu.rt_runtime_us
 			// are inter-dependent and need to be set in a proper order.
 			// If the kernel rejects the new period value with EINVAL
@@ -51,11 +55,11 @@ func (s *CpuGroup) SetRtSched(path string, r *cgroups.Resources) error {
 		}
 	}
 	if r.CpuRtRuntime != 0 {
-		if err := cgroups.WriteFile(path, "cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10)); err != nil {
+		if err := w.WriteFile(path, "cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10)); err != nil {
 			return err
 		}
 		if period != "" {
-			if err := cgroups.WriteFile(path, "cpu.rt_period_us", period); err != nil {
+			if err := w.WriteFile(path, "cpu.rt_period_us", period); err != nil {
 				return err
 			}
 		}
@@ -64,28 +68,26 @@ func (s *CpuGroup) SetRtSched(path string, r *cgroups.Resources) error {
 }
 
 func (s *CpuGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *CpuGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	if r.CpuShares != 0 {
 		shares := r.CpuShares
-		if err := cgroups.WriteFile(path, "cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
-			return err
-		}
-		// read it back
-		sharesRead, err := fscommon.GetCgroupParamUint(path, "cpu.shares")
-		if err != nil {
+		if err := w.WriteFile(path, "cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
 			return err
 		}
-		// ... and check
-		if shares > sharesRead {
-			return fmt.Errorf("the maximum allowed cpu-shares is %d", sharesRead)
-		} else if shares < sharesRead {
-			return fmt.Errorf("the minimum allowed cpu-shares is %d", sharesRead)
+		if !w.Recording() {
+			if err := checkShares(path, shares); err != nil {
+				return err
+			}
 		}
 	}
 
 	var period string
 	if r.CpuPeriod != 0 {
 		period = strconv.FormatUint(r.CpuPeriod, 10)
-		if err := cgroups.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
+		if err := w.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
 			// Sometimes when the period to be set is smaller
 			// than the current one, it is rejected by the kernel
 			// (EINVAL) as old_quota/new_period exceeds the parent
@@ -103,37 +105,38 @@ func (s *CpuGroup) Set(path string, r *cgroups.Resources) error {
 	var burst string
 	if r.CpuBurst != nil {
 		burst = strconv.FormatUint(*r.CpuBurst, 10)
-		if err := cgroups.WriteFile(path, "cpu.cfs_burst_us", burst); err != nil {
+		if err := w.WriteFile(path, "cpu.cfs_burst_us", burst); err != nil {
 			if errors.Is(err, unix.ENOENT) {
-				// If CPU burst knob is not available (e.g.
-				// older kernel), ignore it.
-				burst = ""
-			} else {
-				// Sometimes when the burst to be set is larger
-				// than the current one, it is rejected by the kernel
-				// (EINVAL) as old_quota/new_burst exceeds the parent
-				// cgroup quota limit. If this happens and the quota is
-				// going to be set, ignore the error for now and retry
-				// after setting the quota.
-				if !errors.Is(err, unix.EINVAL) || r.CpuQuota == 0 {
-					return err
+				return &cgroups.UnsupportedError{
+					Manager: cgroups.ManagerTypeFs,
+					Field:   "CpuBurst",
+					Reason:  "cpu.cfs_burst_us not found (requires Linux 5.14+)",
 				}
 			}
+			// Sometimes when the burst to be set is larger
+			// than the current one, it is rejected by the kernel
+			// (EINVAL) as old_quota/new_burst exceeds the parent
+			// cgroup quota limit. If this happens and the quota is
+			// going to be set, ignore the error for now and retry
+			// after setting the quota.
+			if !errors.Is(err, unix.EINVAL) || r.CpuQuota == 0 {
+				return err
+			}
 		} else {
 			burst = ""
 		}
 	}
 	if r.CpuQuota != 0 {
-		if err := cgroups.WriteFile(path, "cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)); err != nil {
+		if err := w.WriteFile(path, "cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)); err != nil {
 			return err
 		}
 		if period != "" {
-			if err := cgroups.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
+			if err := w.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
 				return err
 			}
 		}
 		if burst != "" {
-			if err := cgroups.WriteFile(path, "cpu.cfs_burst_us", burst); err != nil {
+			if err := w.WriteFile(path, "cpu.cfs_burst_us", burst); err != nil {
 				return err
 			}
 		}
@@ -141,12 +144,29 @@ func (s *CpuGroup) Set(path string, r *cgroups.Resources) error {
 
 	if r.CPUIdle != nil {
 		idle := strconv.FormatInt(*r.CPUIdle, 10)
-		if err := cgroups.WriteFile(path, "cpu.idle", idle); err != nil {
+		if err := w.WriteFile(path, "cpu.idle", idle); err != nil {
 			return err
 		}
 	}
 
-	return s.SetRtSched(path, r)
+	return setRtSched(w, path, r)
+}
+
+// checkShares checks that cpu.shares was set to shares, as the kernel
+// silently clamps the values out of range.
+func checkShares(path string, shares uint64) error {
+	// read it back
+	sharesRead, err := fscommon.GetCgroupParamUint(path, "cpu.shares")
+	if err != nil {
+		return err
+	}
+	// ... and check
+	if shares > sharesRead {
+		return fmt.Errorf("the maximum allowed cpu-shares is %d", sharesRead)
+	} else if shares < sharesRead {
+		return fmt.Errorf("the minimum allowed cpu-shares is %d", sharesRead)
+	}
+	return nil
 }
 
 func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
@@ -34,6 +34,10 @@ func (s *CpuacctGroup) Set(_ string, _ *cgroups.Resources) error {
 	return nil
 }
 
+func (s *CpuacctGroup) SetWith(_ fscommon.Writer, _ string, _ *cgroups.Resources) error {
+	return nil
+}
+
 func (s *CpuacctGroup) GetStats(path string, stats *cgroups.Stats) error {
 	if !cgroups.PathExists(path) {
 		return nil
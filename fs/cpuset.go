@@ -59,13 +59,17 @@ func (s *CpusetGroup) Apply(path string, r *cgroups.Resources, pid int) error {
 }
 
 func (s *CpusetGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *CpusetGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	if r.CpusetCpus != "" {
-		if err := cgroups.WriteFile(path, cpusetFile(path, "cpus"), r.CpusetCpus); err != nil {
+		if err := w.WriteFile(path, cpusetFile(path, "cpus"), r.CpusetCpus); err != nil {
 			return err
 		}
 	}
 	if r.CpusetMems != "" {
-		if err := cgroups.WriteFile(path, cpusetFile(path, "mems"), r.CpusetMems); err != nil {
+		if err := w.WriteFile(path, cpusetFile(path, "mems"), r.CpusetMems); err != nil {
 			return err
 		}
 	}
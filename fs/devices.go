@@ -2,6 +2,7 @@ package fs
 
 import (
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type DevicesGroup struct{}
@@ -24,6 +25,15 @@ func (s *DevicesGroup) Apply(path string, r *cgroups.Resources, pid int) error {
 }
 
 func (s *DevicesGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *DevicesGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
+	// Device rules are set by cgroups.DevicesSetV1, so they can't be
+	// recorded.
+	if w.Recording() {
+		return nil
+	}
 	if cgroups.DevicesSetV1 == nil {
 		if len(r.Devices) == 0 {
 			return nil
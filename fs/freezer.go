@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
@@ -22,7 +23,19 @@ func (s *FreezerGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 	return apply(path, pid)
 }
 
-func (s *FreezerGroup) Set(path string, r *cgroups.Resources) (Err error) {
+func (s *FreezerGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *FreezerGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) (Err error) {
+	if w.Recording() {
+		// The retries below depend on the state read back, so only
+		// the final write is recorded.
+		switch r.Freezer {
+		case cgroups.Frozen, cgroups.Thawed:
+			return w.WriteFile(path, "freezer.state", string(r.Freezer))
+		}
+	}
 	switch r.Freezer {
 	case cgroups.Frozen:
 		defer func() {
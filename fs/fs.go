@@ -51,6 +51,8 @@ type subsystem interface {
 	Apply(path string, r *cgroups.Resources, pid int) error
 	// Set sets the cgroup resources.
 	Set(path string, r *cgroups.Resources) error
+	// SetWith is like Set, but the cgroup files are written via w.
+	SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error
 }
 
 type Manager struct {
@@ -167,7 +169,7 @@ func (m *Manager) GetStats() (*cgroups.Stats, error) {
 	return stats, nil
 }
 
-func (m *Manager) Set(r *cgroups.Resources) error {
+func (m *Manager) Set(r *cgroups.Resources) (retErr error) {
 	if r == nil {
 		return nil
 	}
@@ -175,12 +177,33 @@ func (m *Manager) Set(r *cgroups.Resources) error {
 	if r.Unified != nil {
 		return cgroups.ErrV1NoUnified
 	}
+	if err := cgroups.CheckResourcesV1(r, cgroups.ManagerTypeFs); err != nil {
+		return err
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if r.RollbackOnError {
+		s := snapshot(m.paths, r)
+		defer func() {
+			if retErr != nil {
+				retErr = s.Rollback(retErr)
+			}
+		}()
+	}
+	if err := m.set(fscommon.FileWriter{}, r); err != nil {
+		return err
+	}
+	m.cgroups.Resources = r
+
+	return nil
+}
+
+// set applies r to the cgroup, writing the files via w.
+func (m *Manager) set(w fscommon.Writer, r *cgroups.Resources) error {
 	for _, sys := range subsystems {
 		path := m.paths[sys.Name()]
-		if err := sys.Set(path, r); err != nil {
+		if err := sys.SetWith(w, path, r); err != nil {
 			// When rootless is true, errors from the device subsystem
 			// are ignored, as it is really not expected to work.
 			if m.cgroups.Rootless && sys.Name() == "devices" && !errors.Is(err, cgroups.ErrDevicesUnsupported) {
@@ -196,10 +219,41 @@ func (m *Manager) Set(r *cgroups.Resources) error {
 			return err
 		}
 	}
-
 	return nil
 }
 
+// Plan returns the file writes Set would perform to apply r, in order,
+// without changing anything. Plan runs the same code as Set, except the
+// writes are recorded rather than performed, and the old values are read
+// from the cgroup files.
+//
+// Device rules (which are set by [cgroups.DevicesSetV1]) are not
+// included. As the recorded writes always succeed (unless the file does
+// not exist), neither are the writes Set retries after an error (e.g.
+// cpu.cfs_period_us is written again after cpu.cfs_quota_us if the first
+// write was rejected), nor the retries needed to freeze the cgroup.
+func (m *Manager) Plan(r *cgroups.Resources) ([]cgroups.Operation, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if r.Unified != nil {
+		return nil, cgroups.ErrV1NoUnified
+	}
+	if err := cgroups.CheckResourcesV1(r, cgroups.ManagerTypeFs); err != nil {
+		return nil, err
+	}
+	// Use a copy since MemorySwap in r may be modified.
+	rCopy := *r
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec := &fscommon.Recorder{}
+	if err := m.set(rec, &rCopy); err != nil {
+		return nil, err
+	}
+	return rec.Ops, nil
+}
+
 // Freeze toggles the container's freezer cgroup depending on the state
 // provided
 func (m *Manager) Freeze(state cgroups.FreezerState) error {
@@ -236,6 +290,14 @@ func (m *Manager) GetCgroups() (*cgroups.Cgroup, error) {
 	return m.cgroups, nil
 }
 
+// MarshalState returns the serialized state of m, from which the manager
+// can be restored (see [cgroups.State]).
+func (m *Manager) MarshalState() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cgroups.MarshalState(cgroups.State{Type: cgroups.ManagerTypeFs, Paths: m.paths, Config: m.cgroups})
+}
+
 func (m *Manager) GetFreezerState() (cgroups.FreezerState, error) {
 	dir := m.Path("freezer")
 	// If the container doesn't have the freezer cgroup, say it's undefined.
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/opencontainers/cgroups"
@@ -47,3 +48,69 @@ func BenchmarkGetStats(b *testing.B) {
 		b.Fatalf("stats: %+v", st)
 	}
 }
+
+func TestPlan(t *testing.T) {
+	paths := make(map[string]string)
+	for _, subsys := range []string{"memory", "cpu", "pids", "freezer"} {
+		paths[subsys] = tempDir(t, subsys)
+	}
+	files := map[string]map[string]string{
+		"memory": {
+			"memory.limit_in_bytes":       "9223372036854771712\n",
+			"memory.memsw.limit_in_bytes": "9223372036854771712\n",
+		},
+		"cpu":     {"cpu.shares": "1024\n", "cpu.cfs_quota_us": "-1\n"},
+		"pids":    {"pids.max": "max\n"},
+		"freezer": {"freezer.state": "THAWED\n"},
+	}
+	for subsys, f := range files {
+		writeFileContents(t, paths[subsys], f)
+	}
+
+	m, err := NewManager(&cgroups.Cgroup{Resources: &cgroups.Resources{}}, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &cgroups.Resources{
+		Memory:    -1,
+		CpuShares: 512,
+		CpuQuota:  50000,
+		PidsLimit: 100,
+		Freezer:   cgroups.Frozen,
+	}
+	ops, err := m.Plan(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := func(subsys, file, old, new string) cgroups.Operation {
+		return cgroups.Operation{Path: paths[subsys], File: file, Old: old, New: new}
+	}
+	expected := []cgroups.Operation{
+		op("memory", "memory.memsw.limit_in_bytes", "9223372036854771712", "-1"),
+		op("memory", "memory.limit_in_bytes", "9223372036854771712", "-1"),
+		op("cpu", "cpu.shares", "1024", "512"),
+		op("cpu", "cpu.cfs_quota_us", "-1", "50000"),
+		op("pids", "pids.max", "max", "100"),
+		op("freezer", "freezer.state", "THAWED", "FROZEN"),
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, ops)
+	}
+
+	// Nothing is changed, including r.
+	for subsys, f := range files {
+		for name, data := range f {
+			if got, err := cgroups.ReadFile(paths[subsys], name); err != nil || got != data {
+				t.Errorf("%s: expected %q, got %q (error: %v)", name, data, got, err)
+			}
+		}
+	}
+	if r.MemorySwap != 0 {
+		t.Errorf("expected MemorySwap to be unchanged, got %d", r.MemorySwap)
+	}
+
+	// Like Set, Plan fails if a file does not exist.
+	if _, err := m.Plan(&cgroups.Resources{CpuRtRuntime: 1000}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
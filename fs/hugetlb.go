@@ -20,20 +20,27 @@ func (s *HugetlbGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 }
 
 func (s *HugetlbGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *HugetlbGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	const suffix = ".limit_in_bytes"
 	skipRsvd := false
 
 	for _, hugetlb := range r.HugetlbLimit {
 		prefix := "hugetlb." + hugetlb.Pagesize
 		val := strconv.FormatUint(hugetlb.Limit, 10)
-		if err := cgroups.WriteFile(path, prefix+suffix, val); err != nil {
+		if err := w.WriteFile(path, prefix+suffix, val); err != nil {
 			return err
 		}
-		if skipRsvd {
+		// Only ignore the lack of reservation limits support
+		// if the reservation limit is not set explicitly.
+		if skipRsvd && hugetlb.RsvdLimit == nil {
 			continue
 		}
-		if err := cgroups.WriteFile(path, prefix+".rsvd"+suffix, val); err != nil {
-			if errors.Is(err, os.ErrNotExist) {
+		val = strconv.FormatUint(hugetlb.ReservationLimit(), 10)
+		if err := w.WriteFile(path, prefix+".rsvd"+suffix, val); err != nil {
+			if errors.Is(err, os.ErrNotExist) && hugetlb.RsvdLimit == nil {
 				skipRsvd = true
 				continue
 			}
@@ -48,36 +55,47 @@ func (s *HugetlbGroup) GetStats(path string, stats *cgroups.Stats) error {
 	if !cgroups.PathExists(path) {
 		return nil
 	}
-	rsvd := ".rsvd"
-	hugetlbStats := cgroups.HugetlbStats{}
 	for _, pageSize := range cgroups.HugePageSizes() {
-	again:
-		prefix := "hugetlb." + pageSize + rsvd
+		prefix := "hugetlb." + pageSize
+		hugetlbStats := cgroups.HugetlbStats{}
 
-		value, err := fscommon.GetCgroupParamUint(path, prefix+".usage_in_bytes")
-		if err != nil {
-			if rsvd != "" && errors.Is(err, os.ErrNotExist) {
-				rsvd = ""
-				goto again
-			}
+		// Usage, MaxUsage and Failcnt are the reservation counters, if
+		// available, and the fault counters otherwise. In the former case,
+		// the fault counters are optional.
+		rsvd, err := getHugetlbCounters(path, prefix+".rsvd")
+		haveRsvd := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return err
 		}
-		hugetlbStats.Usage = value
-
-		value, err = fscommon.GetCgroupParamUint(path, prefix+".max_usage_in_bytes")
-		if err != nil {
+		fault, err := getHugetlbCounters(path, prefix)
+		if err != nil && (!haveRsvd || !errors.Is(err, os.ErrNotExist)) {
 			return err
 		}
-		hugetlbStats.MaxUsage = value
 
-		value, err = fscommon.GetCgroupParamUint(path, prefix+".failcnt")
-		if err != nil {
-			return err
+		hugetlbStats.FaultUsage, hugetlbStats.FaultMaxUsage, hugetlbStats.FaultFailcnt = fault[0], fault[1], fault[2]
+		hugetlbStats.RsvdUsage, hugetlbStats.RsvdMaxUsage, hugetlbStats.RsvdFailcnt = rsvd[0], rsvd[1], rsvd[2]
+		if haveRsvd {
+			hugetlbStats.Usage, hugetlbStats.MaxUsage, hugetlbStats.Failcnt = rsvd[0], rsvd[1], rsvd[2]
+		} else {
+			hugetlbStats.Usage, hugetlbStats.MaxUsage, hugetlbStats.Failcnt = fault[0], fault[1], fault[2]
 		}
-		hugetlbStats.Failcnt = value
 
 		stats.HugetlbStats[pageSize] = hugetlbStats
 	}
 
 	return nil
 }
+
+// getHugetlbCounters returns usage, max usage and failcnt values read
+// from the files with the given prefix.
+func getHugetlbCounters(path, prefix string) ([3]uint64, error) {
+	var c [3]uint64
+	for i, file := range []string{".usage_in_bytes", ".max_usage_in_bytes", ".failcnt"} {
+		value, err := fscommon.GetCgroupParamUint(path, prefix+file)
+		if err != nil {
+			return c, err
+		}
+		c[i] = value
+	}
+	return c, nil
+}
@@ -85,7 +85,10 @@ func TestHugetlbStats(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectedStats := cgroups.HugetlbStats{Usage: 128, MaxUsage: 256, Failcnt: 100}
+	expectedStats := cgroups.HugetlbStats{
+		Usage: 128, MaxUsage: 256, Failcnt: 100,
+		FaultUsage: 128, FaultMaxUsage: 256, FaultFailcnt: 100,
+	}
 	for _, pageSize := range cgroups.HugePageSizes() {
 		expectHugetlbStatEquals(t, expectedStats, actualStats.HugetlbStats[pageSize])
 	}
@@ -107,7 +110,79 @@ func TestHugetlbRStatsRsvd(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectedStats := cgroups.HugetlbStats{Usage: 128, MaxUsage: 256, Failcnt: 100}
+	expectedStats := cgroups.HugetlbStats{
+		Usage: 128, MaxUsage: 256, Failcnt: 100,
+		RsvdUsage: 128, RsvdMaxUsage: 256, RsvdFailcnt: 100,
+	}
+	for _, pageSize := range cgroups.HugePageSizes() {
+		expectHugetlbStatEquals(t, expectedStats, actualStats.HugetlbStats[pageSize])
+	}
+}
+
+func TestHugetlbSetRsvdLimit(t *testing.T) {
+	path := tempDir(t, "hugetlb")
+
+	const (
+		faultValue = 1024
+		rsvdValue  = 512
+	)
+	rsvd := uint64(rsvdValue)
+	hugetlb := &HugetlbGroup{}
+	for _, pageSize := range cgroups.HugePageSizes() {
+		r := &cgroups.Resources{
+			HugetlbLimit: []*cgroups.HugepageLimit{
+				{Pagesize: pageSize, Limit: faultValue, RsvdLimit: &rsvd},
+			},
+		}
+		if err := hugetlb.Set(path, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pageSize := range cgroups.HugePageSizes() {
+		for f, expected := range map[string]uint64{limit: faultValue, rsvdLimit: rsvdValue} {
+			name := fmt.Sprintf(f, pageSize)
+			value, err := fscommon.GetCgroupParamUint(path, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != expected {
+				t.Errorf("%s: expected %d, got %d", name, expected, value)
+			}
+		}
+	}
+}
+
+func TestHugetlbStatsRsvdAndFault(t *testing.T) {
+	path := tempDir(t, "hugetlb")
+	for _, pageSize := range cgroups.HugePageSizes() {
+		writeFileContents(t, path, map[string]string{
+			fmt.Sprintf(usage, pageSize):        "1024\n",
+			fmt.Sprintf(maxUsage, pageSize):     "2048\n",
+			fmt.Sprintf(failcnt, pageSize):      "1\n",
+			fmt.Sprintf(rsvdUsage, pageSize):    hugetlbUsageContents,
+			fmt.Sprintf(rsvdMaxUsage, pageSize): hugetlbMaxUsageContents,
+			fmt.Sprintf(rsvdFailcnt, pageSize):  hugetlbFailcnt,
+		})
+	}
+
+	hugetlb := &HugetlbGroup{}
+	actualStats := *cgroups.NewStats()
+	err := hugetlb.GetStats(path, &actualStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStats := cgroups.HugetlbStats{
+		Usage:         128,
+		MaxUsage:      256,
+		Failcnt:       100,
+		FaultUsage:    1024,
+		FaultMaxUsage: 2048,
+		FaultFailcnt:  1,
+		RsvdUsage:     128,
+		RsvdMaxUsage:  256,
+		RsvdFailcnt:   100,
+	}
 	for _, pageSize := range cgroups.HugePageSizes() {
 		expectHugetlbStatEquals(t, expectedStats, actualStats.HugetlbStats[pageSize])
 	}
@@ -33,12 +33,12 @@ func (s *MemoryGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 	return apply(path, pid)
 }
 
-func setMemory(path string, val int64) error {
+func setMemory(w fscommon.Writer, path string, val int64) error {
 	if val == 0 {
 		return nil
 	}
 
-	err := cgroups.WriteFile(path, cgroupMemoryLimit, strconv.FormatInt(val, 10))
+	err := w.WriteFile(path, cgroupMemoryLimit, strconv.FormatInt(val, 10))
 	if !errors.Is(err, unix.EBUSY) {
 		return err
 	}
@@ -57,15 +57,15 @@ func setMemory(path string, val int64) error {
 	return fmt.Errorf("unable to set memory limit to %d (current usage: %d, peak usage: %d)", val, usage, max)
 }
 
-func setSwap(path string, val int64) error {
+func setSwap(w fscommon.Writer, path string, val int64) error {
 	if val == 0 {
 		return nil
 	}
 
-	return cgroups.WriteFile(path, cgroupMemorySwapLimit, strconv.FormatInt(val, 10))
+	return w.WriteFile(path, cgroupMemorySwapLimit, strconv.FormatInt(val, 10))
 }
 
-func setMemoryAndSwap(path string, r *cgroups.Resources) error {
+func setMemoryAndSwap(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	// If the memory update is set to -1 and the swap is not explicitly
 	// set, we should also set swap to -1, it means unlimited memory.
 	if r.Memory == -1 && r.MemorySwap == 0 {
@@ -87,20 +87,20 @@ func setMemoryAndSwap(path string, r *cgroups.Resources) error {
 		// for memory and swap memory, so it won't fail because the new
 		// value and the old value don't fit kernel's validation.
 		if r.MemorySwap == -1 || curLimit < uint64(r.MemorySwap) {
-			if err := setSwap(path, r.MemorySwap); err != nil {
+			if err := setSwap(w, path, r.MemorySwap); err != nil {
 				return err
 			}
-			if err := setMemory(path, r.Memory); err != nil {
+			if err := setMemory(w, path, r.Memory); err != nil {
 				return err
 			}
 			return nil
 		}
 	}
 
-	if err := setMemory(path, r.Memory); err != nil {
+	if err := setMemory(w, path, r.Memory); err != nil {
 		return err
 	}
-	if err := setSwap(path, r.MemorySwap); err != nil {
+	if err := setSwap(w, path, r.MemorySwap); err != nil {
 		return err
 	}
 
@@ -108,27 +108,31 @@ func setMemoryAndSwap(path string, r *cgroups.Resources) error {
 }
 
 func (s *MemoryGroup) Set(path string, r *cgroups.Resources) error {
-	if err := setMemoryAndSwap(path, r); err != nil {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *MemoryGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
+	if err := setMemoryAndSwap(w, path, r); err != nil {
 		return err
 	}
 
 	// ignore KernelMemory and KernelMemoryTCP
 
 	if r.MemoryReservation != 0 {
-		if err := cgroups.WriteFile(path, "memory.soft_limit_in_bytes", strconv.FormatInt(r.MemoryReservation, 10)); err != nil {
+		if err := w.WriteFile(path, "memory.soft_limit_in_bytes", strconv.FormatInt(r.MemoryReservation, 10)); err != nil {
 			return err
 		}
 	}
 
 	if r.OomKillDisable {
-		if err := cgroups.WriteFile(path, "memory.oom_control", "1"); err != nil {
+		if err := w.WriteFile(path, "memory.oom_control", "1"); err != nil {
 			return err
 		}
 	}
 	if r.MemorySwappiness == nil || int64(*r.MemorySwappiness) == -1 {
 		return nil
 	} else if *r.MemorySwappiness <= 100 {
-		if err := cgroups.WriteFile(path, "memory.swappiness", strconv.FormatUint(*r.MemorySwappiness, 10)); err != nil {
+		if err := w.WriteFile(path, "memory.swappiness", strconv.FormatUint(*r.MemorySwappiness, 10)); err != nil {
 			return err
 		}
 	} else {
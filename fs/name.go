@@ -2,6 +2,7 @@ package fs
 
 import (
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type NameGroup struct {
@@ -25,6 +26,10 @@ func (s *NameGroup) Set(_ string, _ *cgroups.Resources) error {
 	return nil
 }
 
+func (s *NameGroup) SetWith(_ fscommon.Writer, _ string, _ *cgroups.Resources) error {
+	return nil
+}
+
 func (s *NameGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type NetClsGroup struct{}
@@ -17,8 +18,12 @@ func (s *NetClsGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 }
 
 func (s *NetClsGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *NetClsGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	if r.NetClsClassid != 0 {
-		if err := cgroups.WriteFile(path, "net_cls.classid", strconv.FormatUint(uint64(r.NetClsClassid), 10)); err != nil {
+		if err := w.WriteFile(path, "net_cls.classid", strconv.FormatUint(uint64(r.NetClsClassid), 10)); err != nil {
 			return err
 		}
 	}
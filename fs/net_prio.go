@@ -2,6 +2,7 @@ package fs
 
 import (
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type NetPrioGroup struct{}
@@ -15,8 +16,12 @@ func (s *NetPrioGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 }
 
 func (s *NetPrioGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *NetPrioGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	for _, prioMap := range r.NetPrioIfpriomap {
-		if err := cgroups.WriteFile(path, "net_prio.ifpriomap", prioMap.CgroupString()); err != nil {
+		if err := w.WriteFile(path, "net_prio.ifpriomap", prioMap.CgroupString()); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,70 @@
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+const cgroupMemorySwapMaxUsage = "memory.memsw.max_usage_in_bytes"
+
+// peakTracker is a [cgroups.PeakTracker] using memory.max_usage_in_bytes
+// and memory.memsw.max_usage_in_bytes, which are reset by writing 0.
+type peakTracker struct {
+	path string
+	swap bool
+}
+
+// OpenPeakTracker returns a [cgroups.PeakTracker] for the cgroup, with its
+// window started. Note that on cgroup v1 resetting the tracker resets the
+// cgroup's maximum usage, which affects others reading it (including
+// MaxUsage in [cgroups.MemoryStats]).
+func (m *Manager) OpenPeakTracker() (cgroups.PeakTracker, error) {
+	path := m.Path("memory")
+	if path == "" {
+		return nil, errSubsystemDoesNotExist
+	}
+	t := &peakTracker{path: path}
+	// There's no memory.memsw.* if swap accounting is disabled.
+	_, err := cgroups.ReadFile(path, cgroupMemorySwapMaxUsage)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	t.swap = err == nil
+	if err := t.Reset(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *peakTracker) Reset() error {
+	if err := cgroups.WriteFile(t.path, cgroupMemoryMaxUsage, "0"); err != nil {
+		return err
+	}
+	if t.swap {
+		return cgroups.WriteFile(t.path, cgroupMemorySwapMaxUsage, "0")
+	}
+	return nil
+}
+
+func (t *peakTracker) Peak() (cgroups.PeakUsage, error) {
+	var (
+		p   cgroups.PeakUsage
+		err error
+	)
+	if p.Memory, err = fscommon.GetCgroupParamUint(t.path, cgroupMemoryMaxUsage); err != nil {
+		return p, err
+	}
+	if t.swap {
+		if p.Swap, err = fscommon.GetCgroupParamUint(t.path, cgroupMemorySwapMaxUsage); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func (t *peakTracker) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestPeakTracker(t *testing.T) {
+	path := tempDir(t, "memory")
+	writeFileContents(t, path, map[string]string{
+		cgroupMemoryMaxUsage:     "4096",
+		cgroupMemorySwapMaxUsage: "8192",
+	})
+	m, err := NewManager(&cgroups.Cgroup{Resources: &cgroups.Resources{}}, map[string]string{"memory": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := m.OpenPeakTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	// Opening starts the window.
+	p, err := tr.Peak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (cgroups.PeakUsage{}) {
+		t.Errorf("expected zero peak after open, got %+v", p)
+	}
+
+	writeFileContents(t, path, map[string]string{
+		cgroupMemoryMaxUsage:     "1024",
+		cgroupMemorySwapMaxUsage: "2048",
+	})
+	p, err = tr.Peak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (cgroups.PeakUsage{Memory: 1024, Swap: 2048}); p != expected {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+}
@@ -2,6 +2,7 @@ package fs
 
 import (
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type PerfEventGroup struct{}
@@ -18,6 +19,10 @@ func (s *PerfEventGroup) Set(_ string, _ *cgroups.Resources) error {
 	return nil
 }
 
+func (s *PerfEventGroup) SetWith(_ fscommon.Writer, _ string, _ *cgroups.Resources) error {
+	return nil
+}
+
 func (s *PerfEventGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
@@ -19,6 +19,10 @@ func (s *PidsGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 }
 
 func (s *PidsGroup) Set(path string, r *cgroups.Resources) error {
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *PidsGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
 	if r.PidsLimit != 0 {
 		// "max" is the fallback value.
 		limit := "max"
@@ -27,7 +31,7 @@ func (s *PidsGroup) Set(path string, r *cgroups.Resources) error {
 			limit = strconv.FormatInt(r.PidsLimit, 10)
 		}
 
-		if err := cgroups.WriteFile(path, "pids.max", limit); err != nil {
+		if err := w.WriteFile(path, "pids.max", limit); err != nil {
 			return err
 		}
 	}
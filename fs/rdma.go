@@ -16,7 +16,16 @@ func (s *RdmaGroup) Apply(path string, _ *cgroups.Resources, pid int) error {
 }
 
 func (s *RdmaGroup) Set(path string, r *cgroups.Resources) error {
-	return fscommon.RdmaSet(path, r)
+	return s.SetWith(fscommon.FileWriter{}, path, r)
+}
+
+func (s *RdmaGroup) SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error {
+	for _, line := range fscommon.RdmaLines(r) {
+		if err := w.WriteFile(path, "rdma.max", line); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *RdmaGroup) GetStats(path string, stats *cgroups.Stats) error {
@@ -0,0 +1,312 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+// unlimited is the lowest value of a cgroup v1 memory or hugetlb limit
+// considered unlimited. The kernel reports no limit as the maximum int64
+// value rounded down to the page size (e.g. 9223372036854771712).
+const unlimited = 1 << 62
+
+// ReadResources reads the current resource configuration of the cgroup
+// v1 directories in paths (a map from a subsystem name to its path, as
+// returned by GetPaths) into [cgroups.Resources], such that Set of the
+// result reapplies the same configuration. Unlike GetCgroups, which
+// returns the configuration the manager was created with, this reflects
+// the actual cgroup state.
+//
+// Unlimited values are converted to -1 where the Resources field
+// supports it, and are omitted otherwise. Subsystems without a path and
+// files which do not exist are skipped. Device rules and freezer state
+// are not read.
+func ReadResources(paths map[string]string) (*cgroups.Resources, error) {
+	r := &cgroups.Resources{}
+	for _, s := range []struct {
+		name string
+		read func(string, *cgroups.Resources) error
+	}{
+		{"cpuset", readCpusetResources},
+		{"memory", readMemoryResources},
+		{"cpu", readCPUResources},
+		{"pids", readPidsResources},
+		{"blkio", readBlkioResources},
+		{"hugetlb", readHugetlbResources},
+		{"net_cls", readNetClsResources},
+		{"net_prio", readNetPrioResources},
+		{"rdma", fscommon.RdmaGet},
+	} {
+		path := paths[s.name]
+		if path == "" {
+			continue
+		}
+		if err := s.read(path, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// readOptional returns the trimmed contents of a cgroup file, or an
+// empty string if the file does not exist.
+func readOptional(path, file string) (string, error) {
+	data, err := cgroups.ReadFile(path, file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(data), nil
+}
+
+// readOptionalInt reads a single integer value cgroup file, converting
+// "max" and unlimited values to -1. It returns nil if the file does not
+// exist.
+func readOptionalInt(path, file string) (*int64, error) {
+	str, err := readOptional(path, file)
+	if err != nil || str == "" {
+		return nil, err
+	}
+	if str == "max" {
+		v := int64(-1)
+		return &v, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return nil, &parseError{Path: path, File: file, Err: err}
+	}
+	if val >= unlimited {
+		val = -1
+	}
+	return &val, nil
+}
+
+// readInt is like readOptionalInt, except it returns 0 if the file does
+// not exist.
+func readInt(path, file string) (int64, error) {
+	v, err := readOptionalInt(path, file)
+	if v == nil {
+		return 0, err
+	}
+	return *v, err
+}
+
+// readDeviceValues reads a cgroup file consisting of "MAJOR:MINOR VALUE"
+// lines, calling fn for each. Other lines (e.g. "default 100") are skipped.
+func readDeviceValues(path, file string, fn func(major, minor int64, value uint64)) error {
+	str, err := readOptional(path, file)
+	if err != nil || str == "" {
+		return err
+	}
+	for _, line := range strings.Split(str, "\n") {
+		var major, minor int64
+		var value uint64
+		if _, err := fmt.Sscanf(line, "%d:%d %d", &major, &minor, &value); err != nil {
+			if strings.HasPrefix(line, "default ") {
+				continue
+			}
+			return &parseError{Path: path, File: file, Err: err}
+		}
+		fn(major, minor, value)
+	}
+	return nil
+}
+
+func readCpusetResources(path string, r *cgroups.Resources) error {
+	var err error
+	if r.CpusetCpus, err = readOptional(path, cpusetFile(path, "cpus")); err != nil {
+		return err
+	}
+	r.CpusetMems, err = readOptional(path, cpusetFile(path, "mems"))
+	return err
+}
+
+func readMemoryResources(path string, r *cgroups.Resources) error {
+	var err error
+	if r.Memory, err = readInt(path, "memory.limit_in_bytes"); err != nil {
+		return err
+	}
+	if r.MemorySwap, err = readInt(path, "memory.memsw.limit_in_bytes"); err != nil {
+		return err
+	}
+	if r.MemoryReservation, err = readInt(path, "memory.soft_limit_in_bytes"); err != nil {
+		return err
+	}
+	swappiness, err := readOptionalInt(path, "memory.swappiness")
+	if err != nil {
+		return err
+	}
+	if swappiness != nil {
+		v := uint64(*swappiness)
+		r.MemorySwappiness = &v
+	}
+	oom, err := fscommon.GetValueByKey(path, "memory.oom_control", "oom_kill_disable")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	r.OomKillDisable = oom == 1
+	return nil
+}
+
+func readCPUResources(path string, r *cgroups.Resources) error {
+	shares, err := readInt(path, "cpu.shares")
+	if err != nil {
+		return err
+	}
+	r.CpuShares = uint64(shares)
+	if r.CpuQuota, err = readInt(path, "cpu.cfs_quota_us"); err != nil {
+		return err
+	}
+	period, err := readInt(path, "cpu.cfs_period_us")
+	if err != nil {
+		return err
+	}
+	r.CpuPeriod = uint64(period)
+	burst, err := readOptionalInt(path, "cpu.cfs_burst_us")
+	if err != nil {
+		return err
+	}
+	if burst != nil {
+		b := uint64(*burst)
+		r.CpuBurst = &b
+	}
+	if r.CpuRtRuntime, err = readInt(path, "cpu.rt_runtime_us"); err != nil {
+		return err
+	}
+	rtPeriod, err := readInt(path, "cpu.rt_period_us")
+	if err != nil {
+		return err
+	}
+	r.CpuRtPeriod = uint64(rtPeriod)
+	r.CPUIdle, err = readOptionalInt(path, "cpu.idle")
+	return err
+}
+
+func readPidsResources(path string, r *cgroups.Resources) error {
+	var err error
+	r.PidsLimit, err = readInt(path, "pids.max")
+	return err
+}
+
+func readBlkioResources(path string, r *cgroups.Resources) error {
+	s := &BlkioGroup{}
+	s.detectWeightFilenames(path)
+	weight, err := readInt(path, s.weightFilename)
+	if err != nil {
+		return err
+	}
+	r.BlkioWeight = uint16(weight)
+	leafWeight, err := readInt(path, "blkio.leaf_weight")
+	if err != nil {
+		return err
+	}
+	r.BlkioLeafWeight = uint16(leafWeight)
+
+	weightDevice := func(major, minor int64) *cgroups.WeightDevice {
+		for _, wd := range r.BlkioWeightDevice {
+			if wd.Major == major && wd.Minor == minor {
+				return wd
+			}
+		}
+		wd := cgroups.NewWeightDevice(major, minor, 0, 0)
+		r.BlkioWeightDevice = append(r.BlkioWeightDevice, wd)
+		return wd
+	}
+	if err := readDeviceValues(path, s.weightDeviceFilename, func(major, minor int64, v uint64) {
+		weightDevice(major, minor).Weight = uint16(v)
+	}); err != nil {
+		return err
+	}
+	if err := readDeviceValues(path, "blkio.leaf_weight_device", func(major, minor int64, v uint64) {
+		weightDevice(major, minor).LeafWeight = uint16(v)
+	}); err != nil {
+		return err
+	}
+
+	for _, t := range []struct {
+		file string
+		list *[]*cgroups.ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", &r.BlkioThrottleReadBpsDevice},
+		{"blkio.throttle.write_bps_device", &r.BlkioThrottleWriteBpsDevice},
+		{"blkio.throttle.read_iops_device", &r.BlkioThrottleReadIOPSDevice},
+		{"blkio.throttle.write_iops_device", &r.BlkioThrottleWriteIOPSDevice},
+	} {
+		if err := readDeviceValues(path, t.file, func(major, minor int64, v uint64) {
+			*t.list = append(*t.list, cgroups.NewThrottleDevice(major, minor, v))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readHugetlbResources(path string, r *cgroups.Resources) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		pagesize, ok := strings.CutPrefix(e.Name(), "hugetlb.")
+		if !ok {
+			continue
+		}
+		if pagesize, ok = strings.CutSuffix(pagesize, ".limit_in_bytes"); !ok || strings.Contains(pagesize, ".") {
+			continue
+		}
+		limit, err := fscommon.GetCgroupParamUint(path, e.Name())
+		if err != nil {
+			return err
+		}
+		l := &cgroups.HugepageLimit{Pagesize: pagesize, Limit: limit}
+		rsvd, err := fscommon.GetCgroupParamUint(path, "hugetlb."+pagesize+".rsvd.limit_in_bytes")
+		if err == nil {
+			if rsvd != limit {
+				l.RsvdLimit = &rsvd
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if limit >= unlimited && l.RsvdLimit == nil {
+			continue
+		}
+		r.HugetlbLimit = append(r.HugetlbLimit, l)
+	}
+	return nil
+}
+
+func readNetClsResources(path string, r *cgroups.Resources) error {
+	classid, err := readInt(path, "net_cls.classid")
+	r.NetClsClassid = uint32(classid)
+	return err
+}
+
+func readNetPrioResources(path string, r *cgroups.Resources) error {
+	str, err := readOptional(path, "net_prio.ifpriomap")
+	if err != nil || str == "" {
+		return err
+	}
+	for _, line := range strings.Split(str, "\n") {
+		iface, prio, ok := strings.Cut(line, " ")
+		if !ok {
+			return &parseError{Path: path, File: "net_prio.ifpriomap", Err: fmt.Errorf("bad line %q", line)}
+		}
+		p, err := strconv.ParseInt(prio, 10, 64)
+		if err != nil {
+			return &parseError{Path: path, File: "net_prio.ifpriomap", Err: err}
+		}
+		// Priority 0 is the default.
+		if p != 0 {
+			r.NetPrioIfpriomap = append(r.NetPrioIfpriomap, &cgroups.IfPrioMap{Interface: iface, Priority: p})
+		}
+	}
+	return nil
+}
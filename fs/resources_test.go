@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestReadResources(t *testing.T) {
+	paths := map[string]string{
+		"memory":   tempDir(t, "memory"),
+		"cpu":      tempDir(t, "cpu"),
+		"pids":     tempDir(t, "pids"),
+		"blkio":    tempDir(t, "blkio"),
+		"net_prio": tempDir(t, "net_prio"),
+	}
+	writeFileContents(t, paths["memory"], map[string]string{
+		"memory.limit_in_bytes":       "1073741824\n",
+		"memory.memsw.limit_in_bytes": "9223372036854771712\n",
+		"memory.soft_limit_in_bytes":  "9223372036854771712\n",
+		"memory.swappiness":           "60\n",
+		"memory.oom_control":          "oom_kill_disable 1\nunder_oom 0\n",
+	})
+	writeFileContents(t, paths["cpu"], map[string]string{
+		"cpu.shares":        "512\n",
+		"cpu.cfs_quota_us":  "-1\n",
+		"cpu.cfs_period_us": "100000\n",
+	})
+	writeFileContents(t, paths["pids"], map[string]string{
+		"pids.max": "max\n",
+	})
+	writeFileContents(t, paths["blkio"], map[string]string{
+		"blkio.weight":                   "500\n",
+		"blkio.weight_device":            "8:0 300\n",
+		"blkio.throttle.read_bps_device": "8:0 1048576\n",
+	})
+	writeFileContents(t, paths["net_prio"], map[string]string{
+		"net_prio.ifpriomap": "lo 0\neth0 5\n",
+	})
+
+	r, err := ReadResources(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swappiness := uint64(60)
+	expected := &cgroups.Resources{
+		Memory:                     1 << 30,
+		MemorySwap:                 -1,
+		MemoryReservation:          -1,
+		MemorySwappiness:           &swappiness,
+		OomKillDisable:             true,
+		CpuShares:                  512,
+		CpuQuota:                   -1,
+		CpuPeriod:                  100000,
+		PidsLimit:                  -1,
+		BlkioWeight:                500,
+		BlkioWeightDevice:          []*cgroups.WeightDevice{cgroups.NewWeightDevice(8, 0, 300, 0)},
+		BlkioThrottleReadBpsDevice: []*cgroups.ThrottleDevice{cgroups.NewThrottleDevice(8, 0, 1048576)},
+		NetPrioIfpriomap:           []*cgroups.IfPrioMap{{Interface: "eth0", Priority: 5}},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, r)
+	}
+
+	// Set of the result writes the same values.
+	paths2 := make(map[string]string, len(paths))
+	for name := range paths {
+		paths2[name] = tempDir(t, name)
+	}
+	writeFileContents(t, paths2["blkio"], map[string]string{"blkio.weight": ""})
+	writeFileContents(t, paths2["memory"], map[string]string{"memory.limit_in_bytes": "9223372036854771712"})
+	m, err := NewManager(&cgroups.Cgroup{Resources: &cgroups.Resources{}}, paths2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ReadResources(paths2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake cgroupfs does not emulate memory.oom_control.
+	r2.OomKillDisable = r.OomKillDisable
+	if !reflect.DeepEqual(r2, r) {
+		t.Errorf("round trip mismatch: expected\n%+v\ngot\n%+v", r, r2)
+	}
+}
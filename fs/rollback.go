@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+// snapshot saves the files in paths which Set may modify to apply r, in
+// the order they are written. Device rules and freezer state are not
+// saved (see [cgroups.Resources] RollbackOnError).
+func snapshot(paths map[string]string, r *cgroups.Resources) *fscommon.Snapshot {
+	s := &fscommon.Snapshot{}
+	for _, sys := range subsystems {
+		path := paths[sys.Name()]
+		if path == "" {
+			continue
+		}
+		switch sys.Name() {
+		case "cpuset":
+			s.Save(path, cpusetFile(path, "cpus"), cpusetFile(path, "mems"))
+		case "memory":
+			s.Save(path,
+				"memory.limit_in_bytes", "memory.memsw.limit_in_bytes",
+				"memory.soft_limit_in_bytes", "memory.oom_control",
+				"memory.swappiness")
+		case "cpu":
+			s.Save(path,
+				"cpu.rt_period_us", "cpu.rt_runtime_us", "cpu.shares",
+				"cpu.cfs_period_us", "cpu.cfs_quota_us", "cpu.cfs_burst_us",
+				"cpu.idle")
+		case "pids":
+			s.Save(path, "pids.max")
+		case "blkio":
+			s.Save(path,
+				"blkio.weight", "blkio.bfq.weight", "blkio.leaf_weight",
+				"blkio.weight_device", "blkio.bfq.weight_device",
+				"blkio.leaf_weight_device",
+				"blkio.throttle.read_bps_device", "blkio.throttle.write_bps_device",
+				"blkio.throttle.read_iops_device", "blkio.throttle.write_iops_device")
+		case "hugetlb":
+			for _, l := range r.HugetlbLimit {
+				prefix := "hugetlb." + l.Pagesize
+				s.Save(path, prefix+".limit_in_bytes", prefix+".rsvd.limit_in_bytes")
+			}
+		case "net_cls":
+			s.Save(path, "net_cls.classid")
+		case "net_prio":
+			s.Save(path, "net_prio.ifpriomap")
+		case "rdma":
+			s.Save(path, "rdma.max")
+		}
+	}
+	return s
+}
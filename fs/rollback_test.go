@@ -0,0 +1,60 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestSetRollback(t *testing.T) {
+	memoryPath := tempDir(t, "memory")
+	pidsPath := tempDir(t, "pids")
+	cpuPath := tempDir(t, "cpu")
+
+	writeFileContents(t, memoryPath, map[string]string{
+		"memory.limit_in_bytes":       "9223372036854771712",
+		"memory.memsw.limit_in_bytes": "9223372036854771712",
+	})
+	writeFileContents(t, pidsPath, map[string]string{
+		"pids.max": "max",
+	})
+	// Make writing cpu.shares fail.
+	if err := os.Mkdir(filepath.Join(cpuPath, "cpu.shares"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(&cgroups.Cgroup{Resources: &cgroups.Resources{}}, map[string]string{
+		"memory": memoryPath,
+		"cpu":    cpuPath,
+		"pids":   pidsPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Set(&cgroups.Resources{
+		Memory:          1 << 30,
+		MemorySwap:      2 << 30,
+		CpuShares:       512,
+		PidsLimit:       100,
+		RollbackOnError: true,
+	})
+	var rbErr *cgroups.RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("expected RollbackError, got %v", err)
+	}
+	if rbErr.RollbackErr != nil {
+		t.Fatalf("unexpected rollback error: %v", rbErr.RollbackErr)
+	}
+	for _, name := range []string{"memory.limit_in_bytes", "memory.memsw.limit_in_bytes"} {
+		if got, err := cgroups.ReadFile(memoryPath, name); err != nil || got != "9223372036854771712" {
+			t.Errorf("%s: expected it to be restored, got %q (error: %v)", name, got, err)
+		}
+	}
+	// Set failed before pids.max was written.
+	if got, err := cgroups.ReadFile(pidsPath, "pids.max"); err != nil || got != "max" {
+		t.Errorf("pids.max: expected %q, got %q (error: %v)", "max", got, err)
+	}
+}
@@ -16,20 +16,20 @@ func isCPUSet(r *cgroups.Resources) bool {
 	return r.CpuWeight != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0 || r.CPUIdle != nil || r.CpuBurst != nil
 }
 
-func setCPU(dirPath string, r *cgroups.Resources) error {
+func setCPU(w fscommon.Writer, dirPath string, r *cgroups.Resources) error {
 	if !isCPUSet(r) {
 		return nil
 	}
 
 	if r.CPUIdle != nil {
-		if err := cgroups.WriteFile(dirPath, "cpu.idle", strconv.FormatInt(*r.CPUIdle, 10)); err != nil {
+		if err := w.WriteFile(dirPath, "cpu.idle", strconv.FormatInt(*r.CPUIdle, 10)); err != nil {
 			return err
 		}
 	}
 
 	// NOTE: .CpuShares is not used here. Conversion is the caller's responsibility.
 	if r.CpuWeight != 0 {
-		if err := cgroups.WriteFile(dirPath, "cpu.weight", strconv.FormatUint(r.CpuWeight, 10)); err != nil {
+		if err := w.WriteFile(dirPath, "cpu.weight", strconv.FormatUint(r.CpuWeight, 10)); err != nil {
 			return err
 		}
 	}
@@ -37,7 +37,7 @@ func setCPU(dirPath string, r *cgroups.Resources) error {
 	var burst string
 	if r.CpuBurst != nil {
 		burst = strconv.FormatUint(*r.CpuBurst, 10)
-		if err := cgroups.WriteFile(dirPath, "cpu.max.burst", burst); err != nil {
+		if err := w.WriteFile(dirPath, "cpu.max.burst", burst); err != nil {
 			// Sometimes when the burst to be set is larger
 			// than the current one, it is rejected by the kernel
 			// (EINVAL) as old_quota/new_burst exceeds the parent
@@ -63,11 +63,11 @@ func setCPU(dirPath string, r *cgroups.Resources) error {
 			period = 100000
 		}
 		str += " " + strconv.FormatUint(period, 10)
-		if err := cgroups.WriteFile(dirPath, "cpu.max", str); err != nil {
+		if err := w.WriteFile(dirPath, "cpu.max", str); err != nil {
 			return err
 		}
 		if burst != "" {
-			if err := cgroups.WriteFile(dirPath, "cpu.max.burst", burst); err != nil {
+			if err := w.WriteFile(dirPath, "cpu.max.burst", burst); err != nil {
 				return err
 			}
 		}
@@ -9,8 +9,8 @@ import (
 	"github.com/opencontainers/cgroups"
 )
 
-func supportedControllers() (string, error) {
-	return cgroups.ReadFile(UnifiedMountpoint, "/cgroup.controllers")
+func supportedControllers(root string) (string, error) {
+	return cgroups.ReadFile(root, "/cgroup.controllers")
 }
 
 // needAnyControllers returns whether we enable some supported controllers or not,
@@ -23,7 +23,7 @@ func needAnyControllers(r *cgroups.Resources) (bool, error) {
 	}
 
 	// list of all available controllers
-	content, err := supportedControllers()
+	content, err := supportedControllers(UnifiedMountpoint)
 	if err != nil {
 		return false, err
 	}
@@ -68,12 +68,19 @@ func containsDomainController(r *cgroups.Resources) bool {
 }
 
 // CreateCgroupPath creates cgroupv2 path, enabling all the supported controllers.
-func CreateCgroupPath(path string, c *cgroups.Cgroup) (Err error) {
-	if !strings.HasPrefix(path, UnifiedMountpoint) {
+func CreateCgroupPath(path string, c *cgroups.Cgroup) error {
+	return CreateCgroupPathAt(UnifiedMountpoint, path, c)
+}
+
+// CreateCgroupPathAt is like [CreateCgroupPath], for a cgroup v2 hierarchy
+// mounted at root (normally [UnifiedMountpoint]).
+func CreateCgroupPathAt(root, path string, c *cgroups.Cgroup) (Err error) {
+	rel, ok := strings.CutPrefix(path, root)
+	if !ok || (rel != "" && rel[0] != '/') {
 		return fmt.Errorf("invalid cgroup path %s", path)
 	}
 
-	content, err := supportedControllers()
+	content, err := supportedControllers(root)
 	if err != nil {
 		return err
 	}
@@ -85,9 +92,9 @@ func CreateCgroupPath(path string, c *cgroups.Cgroup) (Err error) {
 	ctrs := strings.Fields(content)
 	res := "+" + strings.Join(ctrs, " +")
 
-	elements := strings.Split(path, "/")
-	elements = elements[3:]
-	current := "/sys/fs"
+	// The first element is the root itself.
+	elements := strings.Split(filepath.Base(root)+rel, "/")
+	current := filepath.Dir(root)
 	for i, e := range elements {
 		current = filepath.Join(current, e)
 		if i > 0 {
@@ -11,9 +11,10 @@ import (
 	"golang.org/x/sys/unix"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
-func setFreezer(dirPath string, state cgroups.FreezerState) error {
+func setFreezer(w fscommon.Writer, dirPath string, state cgroups.FreezerState) error {
 	var stateStr string
 	switch state {
 	case cgroups.Undefined:
@@ -26,6 +27,13 @@ func setFreezer(dirPath string, state cgroups.FreezerState) error {
 		return fmt.Errorf("invalid freezer state %q requested", state)
 	}
 
+	if w.Recording() {
+		if err := w.WriteFile(dirPath, "cgroup.freeze", stateStr); err != nil && state == cgroups.Frozen {
+			return fmt.Errorf("freezer not supported: %w", err)
+		}
+		return nil
+	}
+
 	fd, err := cgroups.OpenFile(dirPath, "cgroup.freeze", unix.O_RDWR)
 	if err != nil {
 		// We can ignore this request as long as the user didn't ask us to
@@ -3,7 +3,10 @@ package fs2
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/opencontainers/cgroups"
@@ -19,6 +22,11 @@ type Manager struct {
 	// controllers is content of "cgroup.controllers" file.
 	// excludes pseudo-controllers ("devices" and "freezer").
 	controllers map[string]struct{}
+	// root is the cgroup v2 mountpoint; empty means UnifiedMountpoint.
+	root string
+	// typ is the manager type reported in errors; empty means
+	// cgroups.ManagerTypeFs2.
+	typ string
 }
 
 // NewManager creates a manager for cgroup v2 unified hierarchy.
@@ -40,6 +48,53 @@ func NewManager(config *cgroups.Cgroup, dirPath string) (*Manager, error) {
 	return m, nil
 }
 
+// NewManagerWithType is like [NewManager], but typ (one of
+// cgroups.ManagerType* constants) is reported as the manager type in
+// errors. It is used by cgroup managers built on top of Manager, such
+// as the systemd one.
+func NewManagerWithType(config *cgroups.Cgroup, dirPath, typ string) (*Manager, error) {
+	m, err := NewManager(config, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	m.typ = typ
+	return m, nil
+}
+
+// managerType returns the manager type to report in errors.
+func (m *Manager) managerType() string {
+	if m.typ == "" {
+		return cgroups.ManagerTypeFs2
+	}
+	return m.typ
+}
+
+// Attach returns a manager for an existing cgroup v2 directory dirPath
+// (like "/sys/fs/cgroup/user.slice/user-1001.slice/session-1.scope"),
+// without modifying the cgroup. The returned manager's configuration
+// has the resources currently set in the cgroup (see [ReadResources]).
+func Attach(dirPath string) (*Manager, error) {
+	dirPath = filepath.Clean(dirPath)
+	if !filepath.IsAbs(dirPath) {
+		return nil, fmt.Errorf("cgroup path %q is not absolute", dirPath)
+	}
+	// Make sure it is a cgroup v2 directory.
+	if _, err := cgroups.ReadFile(dirPath, "cgroup.controllers"); err != nil {
+		return nil, fmt.Errorf("can't attach to %s: %w", dirPath, err)
+	}
+
+	r, err := ReadResources(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't attach to %s: %w", dirPath, err)
+	}
+	config := &cgroups.Cgroup{Resources: r}
+	if path, ok := strings.CutPrefix(dirPath, UnifiedMountpoint); ok && (path == "" || path[0] == '/') {
+		config.Path = "/" + strings.TrimPrefix(path, "/")
+	}
+
+	return NewManager(config, dirPath)
+}
+
 func (m *Manager) getControllers() error {
 	if m.controllers != nil {
 		return nil
@@ -62,7 +117,11 @@ func (m *Manager) getControllers() error {
 }
 
 func (m *Manager) Apply(pid int) error {
-	if err := CreateCgroupPath(m.dirPath, m.config); err != nil {
+	root := m.root
+	if root == "" {
+		root = UnifiedMountpoint
+	}
+	if err := CreateCgroupPathAt(root, m.dirPath, m.config); err != nil {
 		// Related tests:
 		// - "runc create (no limits + no cgrouppath + no permission) succeeds"
 		// - "runc create (rootless + no limits + cgrouppath + no permission) fails with permission error"
@@ -146,7 +205,7 @@ func (m *Manager) Freeze(state cgroups.FreezerState) error {
 	if m.config.Resources == nil {
 		return errors.New("cannot toggle freezer: cgroups not configured for container")
 	}
-	if err := setFreezer(m.dirPath, state); err != nil {
+	if err := setFreezer(fscommon.FileWriter{}, m.dirPath, state); err != nil {
 		return err
 	}
 	m.config.Resources.Freezer = state
@@ -161,27 +220,50 @@ func (m *Manager) Path(_ string) string {
 	return m.dirPath
 }
 
-func (m *Manager) Set(r *cgroups.Resources) error {
+func (m *Manager) Set(r *cgroups.Resources) (retErr error) {
 	if r == nil {
 		return nil
 	}
+	if err := cgroups.CheckResourcesV2(r, m.managerType()); err != nil {
+		return err
+	}
 	if err := m.getControllers(); err != nil {
 		return err
 	}
+	if err := checkIo(m.dirPath, r, m.managerType()); err != nil {
+		return err
+	}
+	if r.RollbackOnError {
+		s := snapshot(m.dirPath, r)
+		defer func() {
+			if retErr != nil {
+				retErr = s.Rollback(retErr)
+			}
+		}()
+	}
+	if err := m.set(fscommon.FileWriter{}, r); err != nil {
+		return err
+	}
+	m.config.Resources = r
+	return nil
+}
+
+// set applies r to the cgroup, writing the files via w.
+func (m *Manager) set(w fscommon.Writer, r *cgroups.Resources) error {
 	// pids (since kernel 4.5)
-	if err := setPids(m.dirPath, r); err != nil {
+	if err := setPids(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// memory (since kernel 4.5)
-	if err := setMemory(m.dirPath, r); err != nil {
+	if err := setMemory(w, m.dirPath, r, m.managerType()); err != nil {
 		return err
 	}
 	// io (since kernel 4.5)
-	if err := setIo(m.dirPath, r); err != nil {
+	if err := setIo(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// cpu (since kernel 4.15)
-	if err := setCPU(m.dirPath, r); err != nil {
+	if err := setCPU(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// devices (since kernel 4.15, pseudo-controller)
@@ -189,32 +271,34 @@ func (m *Manager) Set(r *cgroups.Resources) error {
 	// When rootless is true, errors from the device subsystem are ignored because it is really not expected to work.
 	// However, errors from other subsystems are not ignored.
 	// see @test "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
-	if err := setDevices(m.dirPath, r); err != nil {
-		if !m.config.Rootless || errors.Is(err, cgroups.ErrDevicesUnsupported) {
-			return err
+	//
+	// Device rules are not set via cgroup files, so they can't be recorded.
+	if !w.Recording() {
+		if err := setDevices(m.dirPath, r); err != nil {
+			if !m.config.Rootless || errors.Is(err, cgroups.ErrDevicesUnsupported) {
+				return err
+			}
 		}
 	}
 	// cpuset (since kernel 5.0)
-	if err := setCpuset(m.dirPath, r); err != nil {
+	if err := setCpuset(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// hugetlb (since kernel 5.6)
-	if err := setHugeTlb(m.dirPath, r); err != nil {
+	if err := setHugeTlb(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// rdma (since kernel 4.11)
-	if err := fscommon.RdmaSet(m.dirPath, r); err != nil {
-		return err
+	for _, line := range fscommon.RdmaLines(r) {
+		if err := w.WriteFile(m.dirPath, "rdma.max", line); err != nil {
+			return err
+		}
 	}
 	// freezer (since kernel 5.2, pseudo-controller)
-	if err := setFreezer(m.dirPath, r.Freezer); err != nil {
-		return err
-	}
-	if err := m.setUnified(r.Unified); err != nil {
+	if err := setFreezer(w, m.dirPath, r.Freezer); err != nil {
 		return err
 	}
-	m.config.Resources = r
-	return nil
+	return m.setUnified(w, r.Unified)
 }
 
 func setDevices(dirPath string, r *cgroups.Resources) error {
@@ -227,12 +311,13 @@ func setDevices(dirPath string, r *cgroups.Resources) error {
 	return cgroups.DevicesSetV2(dirPath, r)
 }
 
-func (m *Manager) setUnified(res map[string]string) error {
-	for k, v := range res {
+func (m *Manager) setUnified(w fscommon.Writer, res map[string]string) error {
+	for _, k := range slices.Sorted(maps.Keys(res)) {
+		v := res[k]
 		if strings.Contains(k, "/") {
 			return fmt.Errorf("unified resource %q must be a file name (no slashes)", k)
 		}
-		if err := cgroups.WriteFileByLine(m.dirPath, k, v); err != nil {
+		if err := w.WriteFileByLine(m.dirPath, k, v); err != nil {
 			// Check for both EPERM and ENOENT since O_CREAT is used by WriteFile.
 			if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
 				// Check if a controller is available,
@@ -262,6 +347,12 @@ func (m *Manager) GetCgroups() (*cgroups.Cgroup, error) {
 	return m.config, nil
 }
 
+// MarshalState returns the serialized state of m, from which the manager
+// can be restored (see [cgroups.State]).
+func (m *Manager) MarshalState() ([]byte, error) {
+	return cgroups.MarshalState(cgroups.State{Type: cgroups.ManagerTypeFs2, Paths: m.GetPaths(), Config: m.config})
+}
+
 func (m *Manager) GetFreezerState() (cgroups.FreezerState, error) {
 	return getFreezer(m.dirPath)
 }
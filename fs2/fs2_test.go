@@ -0,0 +1,94 @@
+package fs2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestAttach(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	if _, err := Attach(fakeCgroupDir); err == nil {
+		t.Fatal("expected an error attaching to a non-cgroup directory")
+	}
+	if _, err := Attach("relative/path"); err == nil {
+		t.Fatal("expected an error attaching to a relative path")
+	}
+
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "cgroup.controllers"), []byte("cpu memory pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "cgroup.procs"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Attach(fakeCgroupDir + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Path("") != fakeCgroupDir {
+		t.Errorf("expected path %q, got %q", fakeCgroupDir, m.Path(""))
+	}
+	if !m.Exists() {
+		t.Error("expected the cgroup to exist")
+	}
+	// Treat the fake cgroup as the cgroup v2 root.
+	m.root = fakeCgroupDir
+	if err := m.Apply(1234); err != nil {
+		t.Fatal(err)
+	}
+	if pids, err := m.GetPids(); err != nil || len(pids) != 1 || pids[0] != 1234 {
+		t.Errorf("expected pid 1234 in the cgroup, got %v (error: %v)", pids, err)
+	}
+}
+
+func TestSetRollback(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	dir := t.TempDir()
+
+	for name, data := range map[string]string{
+		"cgroup.controllers": "cpu memory pids\n",
+		"pids.max":           "max\n",
+		"memory.max":         "max\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Make writing cpu.max fail.
+	if err := os.Mkdir(filepath.Join(dir, "cpu.max"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(&cgroups.Cgroup{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &cgroups.Resources{
+		PidsLimit:       100,
+		Memory:          1 << 30,
+		CpuQuota:        50000,
+		CpuPeriod:       100000,
+		RollbackOnError: true,
+	}
+	err = m.Set(r)
+	var rbErr *cgroups.RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("expected RollbackError, got %v", err)
+	}
+	if rbErr.RollbackErr != nil {
+		t.Fatalf("unexpected rollback error: %v", rbErr.RollbackErr)
+	}
+	for _, name := range []string{"pids.max", "memory.max"} {
+		if got, err := cgroups.ReadFile(dir, name); err != nil || got != "max" {
+			t.Errorf("%s: expected %q, got %q (error: %v)", name, "max", got, err)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package fs2
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/opencontainers/cgroups"
 	"github.com/opencontainers/cgroups/fscommon"
@@ -13,7 +15,7 @@ func isHugeTlbSet(r *cgroups.Resources) bool {
 	return len(r.HugetlbLimit) > 0
 }
 
-func setHugeTlb(dirPath string, r *cgroups.Resources) error {
+func setHugeTlb(w fscommon.Writer, dirPath string, r *cgroups.Resources) error {
 	if !isHugeTlbSet(r) {
 		return nil
 	}
@@ -22,14 +24,17 @@ func setHugeTlb(dirPath string, r *cgroups.Resources) error {
 	for _, hugetlb := range r.HugetlbLimit {
 		prefix := "hugetlb." + hugetlb.Pagesize
 		val := strconv.FormatUint(hugetlb.Limit, 10)
-		if err := cgroups.WriteFile(dirPath, prefix+suffix, val); err != nil {
+		if err := w.WriteFile(dirPath, prefix+suffix, val); err != nil {
 			return err
 		}
-		if skipRsvd {
+		// Only ignore the lack of reservation limits support
+		// if the reservation limit is not set explicitly.
+		if skipRsvd && hugetlb.RsvdLimit == nil {
 			continue
 		}
-		if err := cgroups.WriteFile(dirPath, prefix+".rsvd"+suffix, val); err != nil {
-			if errors.Is(err, os.ErrNotExist) {
+		val = strconv.FormatUint(hugetlb.ReservationLimit(), 10)
+		if err := w.WriteFile(dirPath, prefix+".rsvd"+suffix, val); err != nil {
+			if errors.Is(err, os.ErrNotExist) && hugetlb.RsvdLimit == nil {
 				skipRsvd = true
 				continue
 			}
@@ -41,30 +46,74 @@ func setHugeTlb(dirPath string, r *cgroups.Resources) error {
 }
 
 func statHugeTlb(dirPath string, stats *cgroups.Stats) error {
-	hugetlbStats := cgroups.HugetlbStats{}
-	rsvd := ".rsvd"
-
 	for _, pagesize := range cgroups.HugePageSizes() {
 		prefix := "hugetlb." + pagesize
-	again:
-		value, err := fscommon.GetCgroupParamUint(dirPath, prefix+rsvd+".current")
+		hugetlbStats := cgroups.HugetlbStats{}
+
+		value, err := fscommon.GetCgroupParamUint(dirPath, prefix+".current")
 		if err != nil {
-			if rsvd != "" && errors.Is(err, os.ErrNotExist) {
-				rsvd = ""
-				goto again
-			}
 			return err
 		}
-		hugetlbStats.Usage = value
+		hugetlbStats.FaultUsage = value
 
 		value, err = fscommon.GetValueByKey(dirPath, prefix+".events", "max")
 		if err != nil {
 			return err
 		}
-		hugetlbStats.Failcnt = value
+		hugetlbStats.FaultFailcnt = value
+
+		// Usage is the reservation usage, if available.
+		hugetlbStats.Usage = hugetlbStats.FaultUsage
+		hugetlbStats.Failcnt = hugetlbStats.FaultFailcnt
+		value, err = fscommon.GetCgroupParamUint(dirPath, prefix+".rsvd.current")
+		if err == nil {
+			hugetlbStats.RsvdUsage = value
+			hugetlbStats.Usage = value
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		hugetlbStats.NumaStat, err = statHugeTlbNuma(dirPath, prefix+".numa_stat")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 
 		stats.HugetlbStats[pagesize] = hugetlbStats
 	}
 
 	return nil
 }
+
+// statHugeTlbNuma parses hugetlb.<size>.numa_stat, which looks like
+// "total=4194304 N0=2097152 N1=2097152".
+func statHugeTlbNuma(dirPath, file string) (*cgroups.PageStats, error) {
+	data, err := cgroups.ReadFile(dirPath, file)
+	if err != nil {
+		return nil, err
+	}
+	ps := &cgroups.PageStats{}
+	line, _, _ := strings.Cut(data, "\n")
+	for _, field := range strings.Fields(line) {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, &parseError{Path: dirPath, File: file, Err: fmt.Errorf("invalid field %q", field)}
+		}
+		value, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return nil, &parseError{Path: dirPath, File: file, Err: err}
+		}
+		if key == "total" {
+			ps.Total = value
+			continue
+		}
+		node, err := strconv.ParseUint(strings.TrimPrefix(key, "N"), 10, 8)
+		if err != nil {
+			return nil, &parseError{Path: dirPath, File: file, Err: err}
+		}
+		if ps.Nodes == nil {
+			ps.Nodes = make(map[uint8]uint64)
+		}
+		ps.Nodes[uint8(node)] = value
+	}
+	return ps, nil
+}
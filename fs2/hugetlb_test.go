@@ -0,0 +1,105 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+func TestSetHugeTlbRsvdLimit(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	rsvd := uint64(1 << 21)
+	r := &cgroups.Resources{
+		HugetlbLimit: []*cgroups.HugepageLimit{
+			{Pagesize: "2MB", Limit: 1 << 22, RsvdLimit: &rsvd},
+			{Pagesize: "1GB", Limit: 1 << 30},
+		},
+	}
+	if err := setHugeTlb(fscommon.FileWriter{}, fakeCgroupDir, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]uint64{
+		"hugetlb.2MB.max":      1 << 22,
+		"hugetlb.2MB.rsvd.max": 1 << 21,
+		"hugetlb.1GB.max":      1 << 30,
+		"hugetlb.1GB.rsvd.max": 1 << 30,
+	} {
+		value, err := fscommon.GetCgroupParamUint(fakeCgroupDir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Errorf("%s: expected %d, got %d", file, expected, value)
+		}
+	}
+}
+
+func TestStatHugeTlb(t *testing.T) {
+	pageSizes := cgroups.HugePageSizes()
+	if len(pageSizes) == 0 {
+		t.Skip("no huge pages support")
+	}
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	for _, pagesize := range pageSizes {
+		prefix := "hugetlb." + pagesize
+		for name, data := range map[string]string{
+			prefix + ".current":      "4194304\n",
+			prefix + ".events":       "max 3\n",
+			prefix + ".rsvd.current": "6291456\n",
+			prefix + ".numa_stat":    "total=4194304 N0=2097152 N1=2097152\n",
+		} {
+			if err := os.WriteFile(filepath.Join(fakeCgroupDir, name), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stats := cgroups.NewStats()
+	if err := statHugeTlb(fakeCgroupDir, stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := cgroups.HugetlbStats{
+		Usage:        6291456,
+		Failcnt:      3,
+		FaultUsage:   4194304,
+		FaultFailcnt: 3,
+		RsvdUsage:    6291456,
+		NumaStat: &cgroups.PageStats{
+			Total: 4194304,
+			Nodes: map[uint8]uint64{0: 2097152, 1: 2097152},
+		},
+	}
+	for _, pagesize := range pageSizes {
+		if got := stats.HugetlbStats[pagesize]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %+v, got %+v", pagesize, expected, got)
+		}
+	}
+}
+
+func TestStatHugeTlbNumaBad(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	for i, data := range []string{"total=1 N0", "total=x", "total=1 Nx=1"} {
+		file := "hugetlb.2MB.numa_stat" + strconv.Itoa(i)
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := statHugeTlbNuma(fakeCgroupDir, file); err == nil {
+			t.Errorf("%q: expected error, got nil", data)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package fs2
 
 import (
 	"bufio"
-	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -11,6 +11,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 func isIoSet(r *cgroups.Resources) bool {
@@ -19,81 +20,139 @@ func isIoSet(r *cgroups.Resources) bool {
 		len(r.BlkioThrottleReadBpsDevice) > 0 ||
 		len(r.BlkioThrottleWriteBpsDevice) > 0 ||
 		len(r.BlkioThrottleReadIOPSDevice) > 0 ||
-		len(r.BlkioThrottleWriteIOPSDevice) > 0
+		len(r.BlkioThrottleWriteIOPSDevice) > 0 ||
+		len(r.IOWeightDevice) > 0 ||
+		len(r.IOLatencyDevice) > 0
 }
 
 // bfqDeviceWeightSupported checks for per-device BFQ weight support (added
-// in kernel v5.4, commit 795fe54c2a8) by reading from "io.bfq.weight".
-func bfqDeviceWeightSupported(bfq *os.File) bool {
-	if bfq == nil {
-		return false
-	}
-	_, _ = bfq.Seek(0, 0)
-	buf := make([]byte, 32)
-	_, _ = bfq.Read(buf)
+// in kernel v5.4, commit 795fe54c2a8) by the contents of "io.bfq.weight".
+func bfqDeviceWeightSupported(bfq string) bool {
 	// If only a single number (default weight) if read back, we have older kernel.
-	_, err := strconv.ParseInt(string(bytes.TrimSpace(buf)), 10, 64)
+	_, err := strconv.ParseInt(strings.TrimSpace(bfq), 10, 64)
 	return err != nil
 }
 
-func setIo(dirPath string, r *cgroups.Resources) error {
+// bfqSupported tells whether the BFQ IO scheduler is available in
+// dirPath, and whether it supports per-device weights.
+func bfqSupported(dirPath string) (bfq, perDevice bool, err error) {
+	data, err := cgroups.ReadFile(dirPath, "io.bfq.weight")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return true, bfqDeviceWeightSupported(data), nil
+}
+
+// checkIo returns an [*cgroups.UnsupportedError] of manager type typ if r
+// has io limits which can not be set in dirPath. It is called before
+// anything is written, so that Set does not partially apply r.
+func checkIo(dirPath string, r *cgroups.Resources, typ string) error {
+	if len(r.BlkioWeightDevice) == 0 {
+		return nil
+	}
+	_, perDevice, err := bfqSupported(dirPath)
+	if err != nil {
+		return err
+	}
+	if !perDevice {
+		// Unlike IOWeightDevice, these weights are in the BFQ range,
+		// and io.weight has no equivalent.
+		return &cgroups.UnsupportedError{
+			Manager: typ,
+			Field:   "BlkioWeightDevice",
+			Reason:  "io.bfq.weight does not support per-device weights (requires Linux 5.4+ and the BFQ scheduler)",
+		}
+	}
+	return nil
+}
+
+func setIo(w fscommon.Writer, dirPath string, r *cgroups.Resources) error {
 	if !isIoSet(r) {
 		return nil
 	}
 
 	// If BFQ IO scheduler is available, use it.
-	var bfq *os.File
-	if r.BlkioWeight != 0 || len(r.BlkioWeightDevice) > 0 {
+	var bfq, bfqPerDevice bool
+	if r.BlkioWeight != 0 || len(r.BlkioWeightDevice) > 0 || len(r.IOWeightDevice) > 0 {
 		var err error
-		bfq, err = cgroups.OpenFile(dirPath, "io.bfq.weight", os.O_RDWR)
-		if err == nil {
-			defer bfq.Close()
-		} else if !os.IsNotExist(err) {
+		bfq, bfqPerDevice, err = bfqSupported(dirPath)
+		if err != nil {
 			return err
 		}
 	}
 
 	if r.BlkioWeight != 0 {
-		if bfq != nil { // Use BFQ.
-			if _, err := bfq.WriteString(strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
+		if bfq { // Use BFQ.
+			if err := w.WriteFile(dirPath, "io.bfq.weight", strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
 				return err
 			}
 		} else {
 			// Fallback to io.weight with a conversion scheme.
 			v := cgroups.ConvertBlkIOToIOWeightValue(r.BlkioWeight)
-			if err := cgroups.WriteFile(dirPath, "io.weight", strconv.FormatUint(v, 10)); err != nil {
+			if err := w.WriteFile(dirPath, "io.weight", strconv.FormatUint(v, 10)); err != nil {
 				return err
 			}
 		}
 	}
-	if bfqDeviceWeightSupported(bfq) {
+	if bfqPerDevice {
 		for _, wd := range r.BlkioWeightDevice {
-			if _, err := bfq.WriteString(wd.WeightString() + "\n"); err != nil {
+			if err := w.WriteFile(dirPath, "io.bfq.weight", wd.WeightString()); err != nil {
 				return fmt.Errorf("setting device weight %q: %w", wd.WeightString(), err)
 			}
 		}
 	}
+	if err := setIOWeightDevice(w, dirPath, bfqPerDevice, r.IOWeightDevice); err != nil {
+		return err
+	}
 	for _, td := range r.BlkioThrottleReadBpsDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("rbps")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("rbps")); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteBpsDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("wbps")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("wbps")); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleReadIOPSDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("riops")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("riops")); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteIOPSDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("wiops")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("wiops")); err != nil {
 			return err
 		}
 	}
+	for _, ld := range r.IOLatencyDevice {
+		if err := w.WriteFile(dirPath, "io.latency", ld.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// setIOWeightDevice sets per-device weights to io.weight, and, if BFQ
+// supports per-device weights, to io.bfq.weight, so they are in effect
+// whichever of iocost or BFQ is used for the device. It is an error if
+// neither is available.
+func setIOWeightDevice(w fscommon.Writer, dirPath string, bfqPerDevice bool, devices []*cgroups.IOWeightDevice) error {
+	for _, wd := range devices {
+		if bfqPerDevice {
+			if err := w.WriteFile(dirPath, "io.bfq.weight", wd.BFQString()); err != nil {
+				return fmt.Errorf("setting device weight %q: %w", wd.BFQString(), err)
+			}
+		}
+		if err := w.WriteFile(dirPath, "io.weight", wd.String()); err != nil {
+			if !bfqPerDevice || !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("setting device weight %q: %w", wd.String(), err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -165,6 +224,13 @@ func statIo(dirPath string, stats *cgroups.Stats) error {
 			case "wios":
 				op = "Write"
 				targetTable = &parsedStats.IoServicedRecursive
+			// io.latency stats.
+			case "avg_lat":
+				op = "AvgLat"
+				targetTable = &parsedStats.IoLatencyRecursive
+			case "win":
+				op = "Win"
+				targetTable = &parsedStats.IoLatencyRecursive
 			default:
 				// Skip over entries we cannot map to cgroupv1 stats for now.
 				// In the future we should expand the stats struct to include
@@ -1,6 +1,7 @@
 package fs2
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -8,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 const exampleIoStatData = `254:1 rbytes=6901432320 wbytes=14245535744 rios=263278 wios=248603 dbytes=0 dios=0
@@ -79,3 +81,125 @@ func TestStatIo(t *testing.T) {
 		t.Errorf("parsed cgroupv2 io.stat doesn't match expected result: \ngot %#v\nexpected %#v\n", gotStats.BlkioStats, exampleIoStatsParsed)
 	}
 }
+
+func TestSetIOWeightDevice(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	r := &cgroups.Resources{
+		IOWeightDevice: []*cgroups.IOWeightDevice{cgroups.NewIOWeightDevice(8, 0, 5050)},
+	}
+
+	// Without BFQ, only io.weight is written.
+	dir := t.TempDir()
+	if err := setIo(fscommon.FileWriter{}, dir, r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cgroups.ReadFile(dir, "io.weight"); got != "8:0 5050" {
+		t.Errorf("io.weight: expected %q, got %q", "8:0 5050", got)
+	}
+
+	// With per-device BFQ weights, both are written.
+	dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "io.bfq.weight"), []byte("default 100\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setIo(fscommon.FileWriter{}, dir, r); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cgroups.ReadFile(dir, "io.bfq.weight"); got != "8:0 550" {
+		t.Errorf("io.bfq.weight: expected %q, got %q", "8:0 550", got)
+	}
+	if got, _ := cgroups.ReadFile(dir, "io.weight"); got != "8:0 5050" {
+		t.Errorf("io.weight: expected %q, got %q", "8:0 5050", got)
+	}
+}
+
+func TestSetBlkioWeightDeviceUnsupported(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	r := &cgroups.Resources{
+		BlkioWeightDevice: []*cgroups.WeightDevice{cgroups.NewWeightDevice(8, 0, 500, 0)},
+	}
+
+	// Neither a missing BFQ nor BFQ without per-device weights can
+	// apply the weights.
+	for _, bfq := range []string{"", "100\n"} {
+		dir := t.TempDir()
+		if bfq != "" {
+			if err := os.WriteFile(filepath.Join(dir, "io.bfq.weight"), []byte(bfq), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := checkIo(dir, r, cgroups.ManagerTypeFs2)
+		var ue *cgroups.UnsupportedError
+		if !errors.As(err, &ue) || ue.Field != "BlkioWeightDevice" {
+			t.Errorf("io.bfq.weight %q: expected UnsupportedError for BlkioWeightDevice, got %v", bfq, err)
+		}
+	}
+
+	// Set fails before writing anything.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("io pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(&cgroups.Cgroup{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.PidsLimit = 100
+	r.BlkioWeight = 500
+	if err := m.Set(r); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+	for _, name := range []string{"pids.max", "io.weight"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected no write, got %v", name, err)
+		}
+	}
+}
+
+func TestSetIOLatencyDevice(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		target   uint64
+		expected string
+	}{
+		{target: 5000, expected: "8:0 target=5000"},
+		{target: 0, expected: "8:0 target=max"},
+	} {
+		r := &cgroups.Resources{
+			IOLatencyDevice: []*cgroups.IOLatencyDevice{cgroups.NewIOLatencyDevice(8, 0, tc.target)},
+		}
+		if err := setIo(fscommon.FileWriter{}, dir, r); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := cgroups.ReadFile(dir, "io.latency"); got != tc.expected {
+			t.Errorf("io.latency: expected %q, got %q", tc.expected, got)
+		}
+	}
+}
+
+func TestStatIoLatency(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	dir := t.TempDir()
+
+	const data = "8:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0 use_delay=0 delay_nsec=0 depth=1 avg_lat=2500 win=100\n"
+	if err := os.WriteFile(filepath.Join(dir, "io.stat"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stats cgroups.Stats
+	if err := statIo(dir, &stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "AvgLat", Value: 2500},
+		{Major: 8, Minor: 0, Op: "Win", Value: 100},
+	}
+	if !reflect.DeepEqual(stats.BlkioStats.IoLatencyRecursive, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats.BlkioStats.IoLatencyRecursive)
+	}
+}
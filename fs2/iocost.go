@@ -0,0 +1,231 @@
+package fs2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// IOCostQoS is the blk-iocost QoS configuration of a block device, as
+// in the root cgroup's io.cost.qos file. See "io.cost.qos" in
+// https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html.
+//
+// When setting, nil (or empty) fields are left unchanged.
+type IOCostQoS struct {
+	cgroups.BlockIODevice
+	// Enable enables the iocost controller for the device.
+	Enable *bool
+	// Ctrl is either "auto" (kernel defaults) or "user".
+	Ctrl string
+	// RPct and WPct are read and write latency percentiles (0-100).
+	RPct, WPct *float64
+	// RLat and WLat are read and write latency thresholds, in
+	// microseconds.
+	RLat, WLat *uint64
+	// Min and Max are the vrate scaling limits, in percent (1-10000).
+	Min, Max *float64
+}
+
+// String formats q to be writable to io.cost.qos.
+func (q *IOCostQoS) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d:%d", q.Major, q.Minor)
+	if q.Enable != nil {
+		b.WriteString(" enable=" + formatBool(*q.Enable))
+	}
+	if q.Ctrl != "" {
+		b.WriteString(" ctrl=" + q.Ctrl)
+	}
+	writeFloat(&b, "rpct", q.RPct)
+	writeUint(&b, "rlat", q.RLat)
+	writeFloat(&b, "wpct", q.WPct)
+	writeUint(&b, "wlat", q.WLat)
+	writeFloat(&b, "min", q.Min)
+	writeFloat(&b, "max", q.Max)
+	return b.String()
+}
+
+// IOCostModel is the blk-iocost cost model of a block device, as in the
+// root cgroup's io.cost.model file. See "io.cost.model" in
+// https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html.
+//
+// When setting, nil (or empty) fields are left unchanged.
+type IOCostModel struct {
+	cgroups.BlockIODevice
+	// Ctrl is either "auto" (kernel defaults) or "user".
+	Ctrl string
+	// Model is the cost model type; only "linear" is supported by
+	// the kernel.
+	Model string
+	// Maximum sequential IO throughput (bytes per second), and
+	// sequential and random IO rates (IOs per second).
+	RBps, RSeqIOPS, RRandIOPS *uint64
+	WBps, WSeqIOPS, WRandIOPS *uint64
+}
+
+// String formats m to be writable to io.cost.model.
+func (m *IOCostModel) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d:%d", m.Major, m.Minor)
+	if m.Ctrl != "" {
+		b.WriteString(" ctrl=" + m.Ctrl)
+	}
+	if m.Model != "" {
+		b.WriteString(" model=" + m.Model)
+	}
+	writeUint(&b, "rbps", m.RBps)
+	writeUint(&b, "rseqiops", m.RSeqIOPS)
+	writeUint(&b, "rrandiops", m.RRandIOPS)
+	writeUint(&b, "wbps", m.WBps)
+	writeUint(&b, "wseqiops", m.WSeqIOPS)
+	writeUint(&b, "wrandiops", m.WRandIOPS)
+	return b.String()
+}
+
+// GetIOCostQoS reads the iocost QoS configuration of all the configured
+// block devices from the cgroup v2 root directory root (normally
+// [UnifiedMountpoint]).
+func GetIOCostQoS(root string) ([]IOCostQoS, error) {
+	var list []IOCostQoS
+	err := readIOCostFile(root, "io.cost.qos", func(dev cgroups.BlockIODevice, params map[string]string) error {
+		q := IOCostQoS{BlockIODevice: dev, Ctrl: params["ctrl"]}
+		if v, ok := params["enable"]; ok {
+			enable := v == "1"
+			q.Enable = &enable
+		}
+		for key, ptr := range map[string]**float64{"rpct": &q.RPct, "wpct": &q.WPct, "min": &q.Min, "max": &q.Max} {
+			if err := parseFloatParam(params, key, ptr); err != nil {
+				return err
+			}
+		}
+		for key, ptr := range map[string]**uint64{"rlat": &q.RLat, "wlat": &q.WLat} {
+			if err := parseUintParam(params, key, ptr); err != nil {
+				return err
+			}
+		}
+		list = append(list, q)
+		return nil
+	})
+	return list, err
+}
+
+// SetIOCostQoS writes the iocost QoS configuration for the block devices
+// to the cgroup v2 root directory root (normally [UnifiedMountpoint]).
+func SetIOCostQoS(root string, qos ...IOCostQoS) error {
+	for _, q := range qos {
+		if err := cgroups.WriteFile(root, "io.cost.qos", q.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetIOCostModel reads the iocost cost models of all the configured
+// block devices from the cgroup v2 root directory root (normally
+// [UnifiedMountpoint]).
+func GetIOCostModel(root string) ([]IOCostModel, error) {
+	var list []IOCostModel
+	err := readIOCostFile(root, "io.cost.model", func(dev cgroups.BlockIODevice, params map[string]string) error {
+		m := IOCostModel{BlockIODevice: dev, Ctrl: params["ctrl"], Model: params["model"]}
+		for key, ptr := range map[string]**uint64{
+			"rbps": &m.RBps, "rseqiops": &m.RSeqIOPS, "rrandiops": &m.RRandIOPS,
+			"wbps": &m.WBps, "wseqiops": &m.WSeqIOPS, "wrandiops": &m.WRandIOPS,
+		} {
+			if err := parseUintParam(params, key, ptr); err != nil {
+				return err
+			}
+		}
+		list = append(list, m)
+		return nil
+	})
+	return list, err
+}
+
+// SetIOCostModel writes the iocost cost models for the block devices to
+// the cgroup v2 root directory root (normally [UnifiedMountpoint]).
+func SetIOCostModel(root string, models ...IOCostModel) error {
+	for _, m := range models {
+		if err := cgroups.WriteFile(root, "io.cost.model", m.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIOCostFile parses the io.cost.* file, which consists of lines in
+// the "MAJ:MIN KEY=VALUE..." format, calling fn for every line.
+func readIOCostFile(root, file string, fn func(cgroups.BlockIODevice, map[string]string) error) error {
+	data, err := cgroups.ReadFile(root, file)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var dev cgroups.BlockIODevice
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &dev.Major, &dev.Minor); err != nil {
+			return &parseError{Path: root, File: file, Err: err}
+		}
+		params := make(map[string]string, len(fields)-1)
+		for _, f := range fields[1:] {
+			key, val, ok := strings.Cut(f, "=")
+			if !ok {
+				return &parseError{Path: root, File: file, Err: fmt.Errorf("invalid parameter %q", f)}
+			}
+			params[key] = val
+		}
+		if err := fn(dev, params); err != nil {
+			return &parseError{Path: root, File: file, Err: err}
+		}
+	}
+	return nil
+}
+
+func parseFloatParam(params map[string]string, key string, ptr **float64) error {
+	v, ok := params[key]
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s value: %w", key, err)
+	}
+	*ptr = &f
+	return nil
+}
+
+func parseUintParam(params map[string]string, key string, ptr **uint64) error {
+	v, ok := params[key]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s value: %w", key, err)
+	}
+	*ptr = &n
+	return nil
+}
+
+func formatBool(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func writeFloat(b *strings.Builder, key string, v *float64) {
+	if v != nil {
+		b.WriteString(" " + key + "=" + strconv.FormatFloat(*v, 'f', 2, 64))
+	}
+}
+
+func writeUint(b *strings.Builder, key string, v *uint64) {
+	if v != nil {
+		b.WriteString(" " + key + "=" + strconv.FormatUint(*v, 10))
+	}
+}
@@ -0,0 +1,73 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestIOCost(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	root := t.TempDir()
+
+	const (
+		qosData   = "8:0 enable=1 ctrl=user rpct=95.00 rlat=5000 wpct=95.00 wlat=5000 min=50.00 max=150.00\n"
+		modelData = "8:0 ctrl=auto model=linear rbps=174019176 rseqiops=41708 rrandiops=370 wbps=178075866 wseqiops=42705 wrandiops=378\n"
+	)
+	if err := os.WriteFile(filepath.Join(root, "io.cost.qos"), []byte(qosData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "io.cost.model"), []byte(modelData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	qos, err := GetIOCostQoS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enable, pct, lat, vmin, vmax := true, 95.0, uint64(5000), 50.0, 150.0
+	expQoS := []IOCostQoS{{
+		BlockIODevice: cgroups.BlockIODevice{Major: 8, Minor: 0},
+		Enable:        &enable,
+		Ctrl:          "user",
+		RPct:          &pct, WPct: &pct,
+		RLat: &lat, WLat: &lat,
+		Min: &vmin, Max: &vmax,
+	}}
+	if !reflect.DeepEqual(qos, expQoS) {
+		t.Errorf("expected %+v, got %+v", expQoS, qos)
+	}
+	if s := qos[0].String() + "\n"; s != qosData {
+		t.Errorf("expected %q, got %q", qosData, s)
+	}
+
+	models, err := GetIOCostModel(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 || models[0].Model != "linear" || models[0].RRandIOPS == nil || *models[0].RRandIOPS != 370 {
+		t.Errorf("unexpected model %+v", models)
+	}
+	if s := models[0].String() + "\n"; s != modelData {
+		t.Errorf("expected %q, got %q", modelData, s)
+	}
+
+	// Only the fields set are written.
+	wlat := uint64(10000)
+	if err := SetIOCostQoS(root, IOCostQoS{BlockIODevice: cgroups.BlockIODevice{Major: 8, Minor: 16}, WLat: &wlat}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cgroups.ReadFile(root, "io.cost.qos"); got != "8:16 wlat=10000" {
+		t.Errorf("io.cost.qos: expected %q, got %q", "8:16 wlat=10000", got)
+	}
+	if err := SetIOCostModel(root, IOCostModel{BlockIODevice: cgroups.BlockIODevice{Major: 8, Minor: 16}, Ctrl: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cgroups.ReadFile(root, "io.cost.model"); got != "8:16 ctrl=auto" {
+		t.Errorf("io.cost.model: expected %q, got %q", "8:16 ctrl=auto", got)
+	}
+}
@@ -28,11 +28,71 @@ func numToStr(value int64) string {
 	return strconv.FormatInt(value, 10)
 }
 
+// limitToStr is like numToStr, except that 0 is kept, for the limits
+// where it is meaningful.
+func limitToStr(value int64) string {
+	if value == -1 {
+		return "max"
+	}
+	return strconv.FormatInt(value, 10)
+}
+
 func isMemorySet(r *cgroups.Resources) bool {
-	return r.MemoryReservation != 0 || r.Memory != 0 || r.MemorySwap != 0
+	return r.MemoryReservation != 0 || r.Memory != 0 || r.MemorySwap != 0 ||
+		r.MemorySwapHigh != nil || r.MemoryZswapMax != nil || r.MemoryZswapWriteback != nil
+}
+
+// memoryFeature is a write to a memory controller file which is only
+// available on newer kernels.
+type memoryFeature struct {
+	file, field, value string
+}
+
+// memoryFeatureKernel lists the kernel versions which added the optional
+// memory controller files.
+var memoryFeatureKernel = map[string]string{
+	"memory.swap.high":       "5.8",
+	"memory.zswap.max":       "5.19",
+	"memory.zswap.writeback": "6.8",
 }
 
-func setMemory(dirPath string, r *cgroups.Resources) error {
+// memoryFeatures returns the writes to optional memory controller files
+// needed to apply r.
+func memoryFeatures(r *cgroups.Resources) []memoryFeature {
+	var fs []memoryFeature
+	if r.MemorySwapHigh != nil {
+		fs = append(fs, memoryFeature{"memory.swap.high", "MemorySwapHigh", limitToStr(*r.MemorySwapHigh)})
+	}
+	if r.MemoryZswapMax != nil {
+		fs = append(fs, memoryFeature{"memory.zswap.max", "MemoryZswapMax", limitToStr(*r.MemoryZswapMax)})
+	}
+	if r.MemoryZswapWriteback != nil {
+		val := "0"
+		if *r.MemoryZswapWriteback {
+			val = "1"
+		}
+		fs = append(fs, memoryFeature{"memory.zswap.writeback", "MemoryZswapWriteback", val})
+	}
+	return fs
+}
+
+// setMemoryFeature writes an optional memory controller file, reporting
+// its absence as an [*cgroups.UnsupportedError] of manager type typ.
+func setMemoryFeature(w fscommon.Writer, dirPath string, f memoryFeature, typ string) error {
+	err := w.WriteFile(dirPath, f.file, f.value)
+	if errors.Is(err, os.ErrNotExist) {
+		return &cgroups.UnsupportedError{
+			Manager: typ,
+			Field:   f.field,
+			Reason:  f.file + " not found (requires Linux " + memoryFeatureKernel[f.file] + "+ and kernel support)",
+		}
+	}
+	return err
+}
+
+// setMemory sets the memory limits; typ is the manager type to report in
+// errors.
+func setMemory(w fscommon.Writer, dirPath string, r *cgroups.Resources, typ string) error {
 	if !isMemorySet(r) {
 		return nil
 	}
@@ -52,7 +112,7 @@ func setMemory(dirPath string, r *cgroups.Resources) error {
 	}
 	// never write empty string to `memory.swap.max`, it means set to 0.
 	if swapStr != "" {
-		if err := cgroups.WriteFile(dirPath, "memory.swap.max", swapStr); err != nil {
+		if err := w.WriteFile(dirPath, "memory.swap.max", swapStr); err != nil {
 			// If swap is not enabled, silently ignore setting to max or disabling it.
 			if !(errors.Is(err, os.ErrNotExist) && (swapStr == "max" || swapStr == "0")) { //nolint:staticcheck // Ignore "QF1001: could apply De Morgan's law".
 				return err
@@ -61,7 +121,7 @@ func setMemory(dirPath string, r *cgroups.Resources) error {
 	}
 
 	if val := numToStr(r.Memory); val != "" {
-		if err := cgroups.WriteFile(dirPath, "memory.max", val); err != nil {
+		if err := w.WriteFile(dirPath, "memory.max", val); err != nil {
 			return err
 		}
 	}
@@ -69,7 +129,13 @@ func setMemory(dirPath string, r *cgroups.Resources) error {
 	// cgroup.Resources.KernelMemory is ignored
 
 	if val := numToStr(r.MemoryReservation); val != "" {
-		if err := cgroups.WriteFile(dirPath, "memory.low", val); err != nil {
+		if err := w.WriteFile(dirPath, "memory.low", val); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range memoryFeatures(r) {
+		if err := setMemoryFeature(w, dirPath, f, typ); err != nil {
 			return err
 		}
 	}
@@ -97,6 +163,11 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 		return &parseError{Path: dirPath, File: file, Err: err}
 	}
 	stats.MemoryStats.Cache = stats.MemoryStats.Stats["file"]
+	stats.MemoryStats.Zswap = stats.MemoryStats.Stats["zswap"]
+	stats.MemoryStats.Zswapped = stats.MemoryStats.Stats["zswapped"]
+	stats.MemoryStats.Zswpin = stats.MemoryStats.Stats["zswpin"]
+	stats.MemoryStats.Zswpout = stats.MemoryStats.Stats["zswpout"]
+	stats.MemoryStats.Zswpwb = stats.MemoryStats.Stats["zswpwb"]
 	// Unlike cgroup v1 which has memory.use_hierarchy binary knob,
 	// cgroup v2 is always hierarchical.
 	stats.MemoryStats.UseHierarchy = true
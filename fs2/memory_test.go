@@ -1,12 +1,14 @@
 package fs2
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 const exampleMemoryStatData = `anon 790425600
@@ -48,7 +50,12 @@ pgdeactivate 292
 pglazyfree 267
 pglazyfreed 0
 thp_fault_alloc 57411
-thp_collapse_alloc 443`
+thp_collapse_alloc 443
+zswap 1048576
+zswapped 4194304
+zswpin 12
+zswpout 34
+zswpwb 5`
 
 func TestStatMemoryPodCgroupNotFound(t *testing.T) {
 	// We're using a fake cgroupfs.
@@ -123,6 +130,59 @@ func TestStatMemoryPodCgroup(t *testing.T) {
 	if gotStats.MemoryStats.Usage.MaxUsage != expectedMaxUsageBytes {
 		t.Errorf("parsed cgroupv2 memory.stat doesn't match expected result: \ngot %#v\nexpected %#v\n", gotStats.MemoryStats.Usage.MaxUsage, expectedMaxUsageBytes)
 	}
+
+	// zswap stats should be parsed from "memory.stat"
+	ms := gotStats.MemoryStats
+	if ms.Zswap != 1048576 || ms.Zswapped != 4194304 || ms.Zswpin != 12 || ms.Zswpout != 34 || ms.Zswpwb != 5 {
+		t.Errorf("wrong zswap stats: got %d %d %d %d %d", ms.Zswap, ms.Zswapped, ms.Zswpin, ms.Zswpout, ms.Zswpwb)
+	}
+}
+
+func TestSetMemoryZswap(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	swapHigh, zswapMax, writeback := int64(0), int64(0), false
+	r := &cgroups.Resources{
+		MemorySwapHigh:       &swapHigh,
+		MemoryZswapMax:       &zswapMax,
+		MemoryZswapWriteback: &writeback,
+	}
+	if err := setMemory(fscommon.FileWriter{}, fakeCgroupDir, r, cgroups.ManagerTypeFs2); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"memory.swap.high":       "0",
+		"memory.zswap.max":       "0",
+		"memory.zswap.writeback": "0",
+	} {
+		data, err := cgroups.ReadFile(fakeCgroupDir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, data)
+		}
+	}
+}
+
+func TestSetMemoryFeatureUnsupported(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	// The fake cgroupfs creates the files being written, so use
+	// a non-existent directory to emulate a missing file.
+	fakeCgroupDir := filepath.Join(t.TempDir(), "missing")
+
+	writeback := true
+	err := setMemory(fscommon.FileWriter{}, fakeCgroupDir, &cgroups.Resources{MemoryZswapWriteback: &writeback}, cgroups.ManagerTypeSystemd)
+	var ue *cgroups.UnsupportedError
+	if !errors.As(err, &ue) || ue.Field != "MemoryZswapWriteback" || ue.Manager != cgroups.ManagerTypeSystemd {
+		t.Fatalf("expected UnsupportedError for MemoryZswapWriteback, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "requires Linux 6.8+") {
+		t.Errorf("expected the error to mention the kernel version, got %q", err)
+	}
 }
 
 func TestRootStatsFromMeminfo(t *testing.T) {
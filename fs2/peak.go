@@ -0,0 +1,115 @@
+package fs2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+// peakTracker is a [cgroups.PeakTracker] using the per file descriptor
+// peaks of memory.peak and memory.swap.peak: after a write to the file,
+// reads from the same file descriptor return the peak since the write.
+type peakTracker struct {
+	memory, swap *os.File
+}
+
+// OpenPeakTracker returns a [cgroups.PeakTracker] for the cgroup, with its
+// window started. Unlike cgroup v1, resetting it does not affect the
+// peaks seen by others (including MaxUsage in [cgroups.MemoryStats]).
+//
+// This requires Linux 6.12 or later; otherwise, the error returned
+// matches [errors.ErrUnsupported].
+func (m *Manager) OpenPeakTracker() (cgroups.PeakTracker, error) {
+	memory, err := openPeak(m.dirPath, "memory.peak")
+	if err != nil {
+		// Before Linux 5.19, there's no memory.peak.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: memory.peak not found (requires Linux 6.12) (%w)", errors.ErrUnsupported, err)
+		}
+		return nil, err
+	}
+	t := &peakTracker{memory: memory}
+	// There's no memory.swap.peak if swap accounting is disabled.
+	t.swap, err = openPeak(m.dirPath, "memory.swap.peak")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = t.Close()
+		return nil, err
+	}
+	if err := t.Reset(); err != nil {
+		_ = t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func openPeak(dirPath, file string) (*os.File, error) {
+	fd, err := cgroups.OpenFile(dirPath, file, unix.O_RDWR)
+	if err != nil {
+		// Before Linux 6.12, the file is read-only.
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w: resetting %s requires Linux 6.12 (%w)", errors.ErrUnsupported, file, err)
+		}
+		return nil, err
+	}
+	return fd, nil
+}
+
+func (t *peakTracker) Reset() error {
+	for _, fd := range []*os.File{t.memory, t.swap} {
+		if fd == nil {
+			continue
+		}
+		// Any non-empty string resets the peak.
+		if _, err := fd.WriteAt([]byte("reset\n"), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *peakTracker) Peak() (cgroups.PeakUsage, error) {
+	var (
+		p   cgroups.PeakUsage
+		err error
+	)
+	if p.Memory, err = readPeak(t.memory); err != nil {
+		return p, err
+	}
+	if t.swap != nil {
+		if p.Swap, err = readPeak(t.swap); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func readPeak(fd *os.File) (uint64, error) {
+	buf := make([]byte, 32)
+	n, err := fd.ReadAt(buf, 0)
+	if n == 0 && err != nil {
+		return 0, err
+	}
+	val, err := fscommon.ParseUint(strings.TrimSpace(string(buf[:n])), 10, 64)
+	if err != nil {
+		dir, file := filepath.Split(fd.Name())
+		return 0, &parseError{Path: filepath.Clean(dir), File: file, Err: err}
+	}
+	return val, nil
+}
+
+func (t *peakTracker) Close() error {
+	var errs []error
+	for _, fd := range []*os.File{t.memory, t.swap} {
+		if fd != nil {
+			errs = append(errs, fd.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
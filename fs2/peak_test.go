@@ -0,0 +1,107 @@
+package fs2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestPeakTracker(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	write := func(files map[string]string) {
+		t.Helper()
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(fakeCgroupDir, name), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write(map[string]string{
+		"cgroup.controllers": "memory\n",
+		"memory.peak":        "1048576\n",
+		"memory.swap.peak":   "4096\n",
+	})
+	m, err := NewManager(&cgroups.Cgroup{}, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := m.OpenPeakTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	// Opening starts the window.
+	for _, file := range []string{"memory.peak", "memory.swap.peak"} {
+		data, err := os.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "reset") {
+			t.Errorf("%s is not reset: %q", file, data)
+		}
+	}
+
+	// The kernel returns the peak since the reset.
+	write(map[string]string{
+		"memory.peak":      "65536\n",
+		"memory.swap.peak": "0\n",
+	})
+	p, err := tr.Peak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (cgroups.PeakUsage{Memory: 65536}); p != expected {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+}
+
+func TestPeakTrackerNoSwap(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "memory.peak"), []byte("0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(&cgroups.Cgroup{}, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := m.OpenPeakTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "memory.peak"), []byte("4096\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := tr.Peak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (cgroups.PeakUsage{Memory: 4096}); p != expected {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+}
+
+func TestPeakTrackerUnsupported(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	m, err := NewManager(&cgroups.Cgroup{}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No memory.peak (Linux < 5.19).
+	if _, err := m.OpenPeakTracker(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
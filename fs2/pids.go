@@ -16,12 +16,12 @@ func isPidsSet(r *cgroups.Resources) bool {
 	return r.PidsLimit != 0
 }
 
-func setPids(dirPath string, r *cgroups.Resources) error {
+func setPids(w fscommon.Writer, dirPath string, r *cgroups.Resources) error {
 	if !isPidsSet(r) {
 		return nil
 	}
 	if val := numToStr(r.PidsLimit); val != "" {
-		if err := cgroups.WriteFile(dirPath, "pids.max", val); err != nil {
+		if err := w.WriteFile(dirPath, "pids.max", val); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,36 @@
+package fs2
+
+import (
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+// Plan returns the file writes Set would perform to apply r, in order,
+// without changing anything. Plan runs the same code as Set, except the
+// writes are recorded rather than performed, and the old values are read
+// from the cgroup files.
+//
+// Device rules (which are not set via cgroup files) are not included.
+// As the recorded writes always succeed (unless the file does not
+// exist), the writes Set retries after an error are not included either
+// (e.g. cpu.max.burst is written again after cpu.max if the first write
+// was rejected).
+func (m *Manager) Plan(r *cgroups.Resources) ([]cgroups.Operation, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if err := cgroups.CheckResourcesV2(r, m.managerType()); err != nil {
+		return nil, err
+	}
+	if err := m.getControllers(); err != nil {
+		return nil, err
+	}
+	if err := checkIo(m.dirPath, r, m.managerType()); err != nil {
+		return nil, err
+	}
+	rec := &fscommon.Recorder{}
+	if err := m.set(rec, r); err != nil {
+		return nil, err
+	}
+	return rec.Ops, nil
+}
@@ -0,0 +1,82 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestPlan(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"cgroup.controllers": "cpu memory pids\n",
+		"pids.max":           "max\n",
+		"memory.max":         "max\n",
+		"memory.swap.max":    "max\n",
+		"memory.high":        "max\n",
+		"cpu.weight":         "100\n",
+		"cpu.max":            "max 100000\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewManager(&cgroups.Cgroup{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := m.Plan(&cgroups.Resources{
+		PidsLimit:  -1,
+		Memory:     1 << 30,
+		MemorySwap: 3 << 29,
+		CpuWeight:  cgroups.ConvertCPUSharesToCgroupV2Value(512),
+		CpuQuota:   50000,
+		Unified: map[string]string{
+			"pids.max":    "200",
+			"memory.high": "900000000",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := func(file, old, new string) cgroups.Operation {
+		return cgroups.Operation{Path: dir, File: file, Old: old, New: new}
+	}
+	expected := []cgroups.Operation{
+		op("pids.max", "max", "max"),
+		op("memory.swap.max", "max", "536870912"),
+		op("memory.max", "max", "1073741824"),
+		op("cpu.weight", "100", "59"),
+		op("cpu.max", "max 100000", "50000 100000"),
+		op("memory.high", "max", "900000000"),
+		op("pids.max", "max", "200"),
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, ops)
+	}
+
+	// Nothing is changed.
+	for name, data := range files {
+		if got, err := cgroups.ReadFile(dir, name); err != nil || got != data {
+			t.Errorf("%s: expected %q, got %q (error: %v)", name, data, got, err)
+		}
+	}
+
+	// Like Set, Plan fails if a file does not exist.
+	if _, err := m.Plan(&cgroups.Resources{Unified: map[string]string{"io.max": "8:0 rbps=1"}}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	// Invalid resources are rejected.
+	if _, err := m.Plan(&cgroups.Resources{Memory: 1 << 30, MemorySwap: 1 << 20}); err == nil {
+		t.Error("expected an error for MemorySwap < Memory")
+	}
+}
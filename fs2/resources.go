@@ -0,0 +1,357 @@
+package fs2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+// ReadResources reads the current resource configuration of the cgroup
+// v2 directory dirPath into [cgroups.Resources], such that Set of the
+// result reapplies the same configuration. Unlike GetCgroups, which
+// returns the configuration the manager was created with, this reflects
+// the actual cgroup state.
+//
+// Unlimited ("max") values are converted to -1 where the Resources field
+// supports it, and are omitted otherwise. Files which do not exist (e.g.
+// because the controller is not enabled) are skipped. Values which have
+// no Resources field (memory.high), or can't be converted to one exactly
+// (the default io.weight), are returned in Unified. Device rules and freezer state
+// are not read.
+func ReadResources(dirPath string) (*cgroups.Resources, error) {
+	r := &cgroups.Resources{}
+	for _, read := range []func(string, *cgroups.Resources) error{
+		readMemoryResources,
+		readCPUResources,
+		readCpusetResources,
+		readPidsResources,
+		readIoResources,
+		readHugeTlbResources,
+		fscommon.RdmaGet,
+	} {
+		if err := read(dirPath, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// readOptional returns the trimmed contents of a cgroup file, or an
+// empty string if the file does not exist.
+func readOptional(dirPath, file string) (string, error) {
+	data, err := cgroups.ReadFile(dirPath, file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(data), nil
+}
+
+// readLimit reads a single value cgroup file, converting "max" to -1.
+// It returns 0 if the file does not exist.
+func readLimit(dirPath, file string) (int64, error) {
+	str, err := readOptional(dirPath, file)
+	if err != nil || str == "" {
+		return 0, err
+	}
+	if str == "max" {
+		return -1, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, &parseError{Path: dirPath, File: file, Err: err}
+	}
+	return val, nil
+}
+
+// readOptionalLimit is like readLimit, but it returns nil if the file
+// does not exist.
+func readOptionalLimit(dirPath, file string) (*int64, error) {
+	str, err := readOptional(dirPath, file)
+	if err != nil || str == "" {
+		return nil, err
+	}
+	val := int64(-1)
+	if str != "max" {
+		if val, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return nil, &parseError{Path: dirPath, File: file, Err: err}
+		}
+	}
+	return &val, nil
+}
+
+// readOptionalInt reads a single integer value cgroup file. It returns
+// nil if the file does not exist.
+func readOptionalInt(dirPath, file string) (*int64, error) {
+	str, err := readOptional(dirPath, file)
+	if err != nil || str == "" {
+		return nil, err
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return nil, &parseError{Path: dirPath, File: file, Err: err}
+	}
+	return &val, nil
+}
+
+func readMemoryResources(dirPath string, r *cgroups.Resources) error {
+	var err error
+	if r.Memory, err = readLimit(dirPath, "memory.max"); err != nil {
+		return err
+	}
+	if r.MemoryReservation, err = readLimit(dirPath, "memory.low"); err != nil {
+		return err
+	}
+	swap, err := readLimit(dirPath, "memory.swap.max")
+	if err != nil {
+		return err
+	}
+	// The reverse of ConvertMemorySwapToCgroupV2Value.
+	switch {
+	case swap == -1, r.Memory == -1:
+		r.MemorySwap = swap
+	case r.Memory > 0:
+		r.MemorySwap = r.Memory + swap
+	}
+	// Unlike the other limits, swap.high and zswap.max of 0 are meaningful.
+	if r.MemorySwapHigh, err = readOptionalLimit(dirPath, "memory.swap.high"); err != nil {
+		return err
+	}
+	if r.MemoryZswapMax, err = readOptionalLimit(dirPath, "memory.zswap.max"); err != nil {
+		return err
+	}
+	writeback, err := readOptional(dirPath, "memory.zswap.writeback")
+	if err != nil {
+		return err
+	}
+	if writeback != "" {
+		wb := writeback != "0"
+		r.MemoryZswapWriteback = &wb
+	}
+	high, err := readOptional(dirPath, "memory.high")
+	if err != nil {
+		return err
+	}
+	if high != "" {
+		setUnified(r, "memory.high", high)
+	}
+	return nil
+}
+
+func readCPUResources(dirPath string, r *cgroups.Resources) error {
+	weight, err := readLimit(dirPath, "cpu.weight")
+	if err != nil {
+		return err
+	}
+	r.CpuWeight = uint64(weight)
+
+	if str, err := readOptional(dirPath, "cpu.max"); err != nil {
+		return err
+	} else if str != "" {
+		quota, period, _ := strings.Cut(str, " ")
+		if quota == "max" {
+			r.CpuQuota = -1
+		} else if r.CpuQuota, err = strconv.ParseInt(quota, 10, 64); err != nil {
+			return &parseError{Path: dirPath, File: "cpu.max", Err: err}
+		}
+		if r.CpuPeriod, err = strconv.ParseUint(period, 10, 64); err != nil {
+			return &parseError{Path: dirPath, File: "cpu.max", Err: err}
+		}
+	}
+
+	burst, err := readOptionalInt(dirPath, "cpu.max.burst")
+	if err != nil {
+		return err
+	}
+	if burst != nil {
+		b := uint64(*burst)
+		r.CpuBurst = &b
+	}
+	r.CPUIdle, err = readOptionalInt(dirPath, "cpu.idle")
+	return err
+}
+
+func readCpusetResources(dirPath string, r *cgroups.Resources) error {
+	var err error
+	if r.CpusetCpus, err = readOptional(dirPath, "cpuset.cpus"); err != nil {
+		return err
+	}
+	r.CpusetMems, err = readOptional(dirPath, "cpuset.mems")
+	return err
+}
+
+func readPidsResources(dirPath string, r *cgroups.Resources) error {
+	var err error
+	r.PidsLimit, err = readLimit(dirPath, "pids.max")
+	return err
+}
+
+func readIoResources(dirPath string, r *cgroups.Resources) error {
+	// As setIo, prefer BFQ if available.
+	bfq, err := readOptional(dirPath, "io.bfq.weight")
+	if err != nil {
+		return err
+	}
+	if bfq != "" {
+		for _, line := range strings.Split(bfq, "\n") {
+			key, val, ok := strings.Cut(line, " ")
+			if !ok {
+				// Older kernels only have the default weight.
+				key, val = "default", line
+			}
+			weight, err := strconv.ParseUint(val, 10, 16)
+			if err != nil {
+				return &parseError{Path: dirPath, File: "io.bfq.weight", Err: err}
+			}
+			if key == "default" {
+				r.BlkioWeight = uint16(weight)
+				continue
+			}
+			var major, minor int64
+			if _, err := fmt.Sscanf(key, "%d:%d", &major, &minor); err != nil {
+				return &parseError{Path: dirPath, File: "io.bfq.weight", Err: err}
+			}
+			r.BlkioWeightDevice = append(r.BlkioWeightDevice, cgroups.NewWeightDevice(major, minor, uint16(weight), 0))
+		}
+	}
+	weight, err := readOptional(dirPath, "io.weight")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(weight, "\n") {
+		key, _, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if key == "default" {
+			// The default io.weight can't be converted to BlkioWeight
+			// exactly, and BlkioWeight is written to io.bfq.weight
+			// if BFQ is available.
+			if bfq == "" {
+				setUnified(r, "io.weight", line)
+			}
+			continue
+		}
+		var major, minor int64
+		var w uint64
+		if _, err := fmt.Sscanf(line, "%d:%d %d", &major, &minor, &w); err != nil {
+			return &parseError{Path: dirPath, File: "io.weight", Err: err}
+		}
+		r.IOWeightDevice = append(r.IOWeightDevice, cgroups.NewIOWeightDevice(major, minor, w))
+	}
+	// Set writes IOWeightDevice to io.bfq.weight too (after
+	// BlkioWeightDevice), so the BFQ weights of such devices are
+	// overridden anyway. Note it means the BFQ weight set independently
+	// of io.weight for a device is not preserved.
+	r.BlkioWeightDevice = slices.DeleteFunc(r.BlkioWeightDevice, func(wd *cgroups.WeightDevice) bool {
+		return slices.ContainsFunc(r.IOWeightDevice, func(iwd *cgroups.IOWeightDevice) bool {
+			return iwd.Major == wd.Major && iwd.Minor == wd.Minor
+		})
+	})
+	if len(r.BlkioWeightDevice) == 0 {
+		r.BlkioWeightDevice = nil
+	}
+
+	latency, err := readOptional(dirPath, "io.latency")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(latency, "\n") {
+		if line == "" {
+			continue
+		}
+		var major, minor int64
+		var target uint64
+		if _, err := fmt.Sscanf(line, "%d:%d target=%d", &major, &minor, &target); err != nil {
+			return &parseError{Path: dirPath, File: "io.latency", Err: err}
+		}
+		r.IOLatencyDevice = append(r.IOLatencyDevice, cgroups.NewIOLatencyDevice(major, minor, target))
+	}
+
+	str, err := readOptional(dirPath, "io.max")
+	if err != nil || str == "" {
+		return err
+	}
+	for _, line := range strings.Split(str, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var major, minor int64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			return &parseError{Path: dirPath, File: "io.max", Err: err}
+		}
+		for _, kv := range fields[1:] {
+			key, val, _ := strings.Cut(kv, "=")
+			if val == "max" {
+				continue
+			}
+			rate, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return &parseError{Path: dirPath, File: "io.max", Err: err}
+			}
+			td := cgroups.NewThrottleDevice(major, minor, rate)
+			switch key {
+			case "rbps":
+				r.BlkioThrottleReadBpsDevice = append(r.BlkioThrottleReadBpsDevice, td)
+			case "wbps":
+				r.BlkioThrottleWriteBpsDevice = append(r.BlkioThrottleWriteBpsDevice, td)
+			case "riops":
+				r.BlkioThrottleReadIOPSDevice = append(r.BlkioThrottleReadIOPSDevice, td)
+			case "wiops":
+				r.BlkioThrottleWriteIOPSDevice = append(r.BlkioThrottleWriteIOPSDevice, td)
+			}
+		}
+	}
+	return nil
+}
+
+func readHugeTlbResources(dirPath string, r *cgroups.Resources) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		pagesize, ok := strings.CutPrefix(e.Name(), "hugetlb.")
+		if !ok {
+			continue
+		}
+		if pagesize, ok = strings.CutSuffix(pagesize, ".max"); !ok || strings.Contains(pagesize, ".") {
+			continue
+		}
+		limit, err := fscommon.GetCgroupParamUint(dirPath, e.Name())
+		if err != nil {
+			return err
+		}
+		l := &cgroups.HugepageLimit{Pagesize: pagesize, Limit: limit}
+		rsvd, err := fscommon.GetCgroupParamUint(dirPath, "hugetlb."+pagesize+".rsvd.max")
+		if err == nil {
+			if rsvd != limit {
+				l.RsvdLimit = &rsvd
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if limit == math.MaxUint64 && l.RsvdLimit == nil {
+			continue
+		}
+		r.HugetlbLimit = append(r.HugetlbLimit, l)
+	}
+	return nil
+}
+
+func setUnified(r *cgroups.Resources, key, value string) {
+	if r.Unified == nil {
+		r.Unified = make(map[string]string)
+	}
+	r.Unified[key] = value
+}
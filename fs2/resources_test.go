@@ -0,0 +1,140 @@
+package fs2
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestReadResources(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+
+	files := map[string]string{
+		"cgroup.controllers":     "cpu cpuset io memory pids hugetlb rdma\n",
+		"memory.max":             "1073741824\n",
+		"memory.low":             "0\n",
+		"memory.high":            "max\n",
+		"memory.swap.max":        "536870912\n",
+		"memory.swap.high":       "max\n",
+		"memory.zswap.max":       "0\n",
+		"memory.zswap.writeback": "1\n",
+		"cpu.max":                "max 100000\n",
+		"cpu.weight":             "59\n",
+		"cpu.idle":               "0\n",
+		"cpu.max.burst":          "1000\n",
+		"cpuset.cpus":            "0-1\n",
+		"cpuset.mems":            "\n",
+		"pids.max":               "max\n",
+		"io.weight":              "default 100\n",
+		"io.max":                 "8:0 rbps=1048576 wbps=max riops=max wiops=max\n",
+		"io.latency":             "8:0 target=2000\n",
+		"hugetlb.2MB.max":        "max\n",
+		"hugetlb.2MB.rsvd.max":   "2097152\n",
+		"hugetlb.1GB.max":        "1073741824\n",
+		"hugetlb.1GB.rsvd.max":   "1073741824\n",
+		"hugetlb.64KB.max":       "max\n",
+		"rdma.max":               "mlx4_0 hca_handle=2 hca_object=2000\n",
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := ReadResources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	burst, idle, handles, objects := uint64(1000), int64(0), uint32(2), uint32(2000)
+	rsvd := uint64(2 << 20)
+	swapHigh, zswapMax, writeback := int64(-1), int64(0), true
+	expected := &cgroups.Resources{
+		Memory:                     1 << 30,
+		MemorySwap:                 3 << 29,
+		MemorySwapHigh:             &swapHigh,
+		MemoryZswapMax:             &zswapMax,
+		MemoryZswapWriteback:       &writeback,
+		CpuQuota:                   -1,
+		CpuPeriod:                  100000,
+		CpuWeight:                  59,
+		CPUIdle:                    &idle,
+		CpuBurst:                   &burst,
+		CpusetCpus:                 "0-1",
+		PidsLimit:                  -1,
+		BlkioThrottleReadBpsDevice: []*cgroups.ThrottleDevice{cgroups.NewThrottleDevice(8, 0, 1048576)},
+		IOLatencyDevice:            []*cgroups.IOLatencyDevice{cgroups.NewIOLatencyDevice(8, 0, 2000)},
+		HugetlbLimit: []*cgroups.HugepageLimit{
+			{Pagesize: "1GB", Limit: 1 << 30},
+			{Pagesize: "2MB", Limit: math.MaxUint64, RsvdLimit: &rsvd},
+		},
+		Rdma: map[string]cgroups.LinuxRdma{"mlx4_0": {HcaHandles: &handles, HcaObjects: &objects}},
+		Unified: map[string]string{
+			"memory.high": "max",
+			"io.weight":   "default 100",
+		},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, r)
+	}
+
+	// Set of the result writes the same values.
+	dir2 := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir2, "cgroup.controllers"), []byte(files["cgroup.controllers"]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(&cgroups.Cgroup{}, dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ReadResources(dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r2, r) {
+		t.Errorf("round trip mismatch: expected\n%+v\ngot\n%+v", r, r2)
+	}
+
+	// Attach reads the resources, too.
+	m, err = Attach(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.config.Resources, expected) {
+		t.Errorf("Attach: expected\n%+v\ngot\n%+v", expected, m.config.Resources)
+	}
+}
+
+func TestReadResourcesBFQ(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"io.bfq.weight": "default 100\n8:0 200\n8:16 300\n",
+		"io.weight":     "default 100\n8:0 500\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := ReadResources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The BFQ weight of 8:0 is overridden by its io.weight.
+	expected := &cgroups.Resources{
+		BlkioWeight:       100,
+		BlkioWeightDevice: []*cgroups.WeightDevice{cgroups.NewWeightDevice(8, 16, 300, 0)},
+		IOWeightDevice:    []*cgroups.IOWeightDevice{cgroups.NewIOWeightDevice(8, 0, 500)},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected\n%+v\ngot\n%+v", expected, r)
+	}
+}
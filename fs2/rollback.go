@@ -0,0 +1,37 @@
+package fs2
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fscommon"
+)
+
+// snapshot saves the files in dirPath which Set may modify to apply r,
+// in the order they are written. Device rules and freezer state are not
+// saved (see [cgroups.Resources] RollbackOnError), nor are the cgroup core
+// (cgroup.*) files set via Unified, as their contents can not be written
+// back (e.g. cgroup.subtree_control reads "cpu memory", but needs "+cpu").
+func snapshot(dirPath string, r *cgroups.Resources) *fscommon.Snapshot {
+	s := &fscommon.Snapshot{}
+	s.Save(dirPath,
+		"pids.max",
+		"memory.swap.max", "memory.max", "memory.low",
+		"memory.swap.high", "memory.zswap.max", "memory.zswap.writeback",
+		"io.bfq.weight", "io.weight", "io.max", "io.latency",
+		"cpu.idle", "cpu.weight", "cpu.max.burst", "cpu.max",
+		"cpuset.cpus", "cpuset.mems")
+	for _, l := range r.HugetlbLimit {
+		prefix := "hugetlb." + l.Pagesize
+		s.Save(dirPath, prefix+".max", prefix+".rsvd.max")
+	}
+	s.Save(dirPath, "rdma.max")
+	for _, k := range slices.Sorted(maps.Keys(r.Unified)) {
+		if !strings.Contains(k, "/") && !strings.HasPrefix(k, "cgroup.") {
+			s.Save(dirPath, k)
+		}
+	}
+	return s
+}
@@ -3,8 +3,9 @@ package fscommon
 import (
 	"bufio"
 	"errors"
-	"math"
+	"maps"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -24,7 +25,7 @@ func parseRdmaKV(raw string, entry *cgroups.RdmaEntry) error {
 	}
 
 	if v == "max" {
-		value = math.MaxUint32
+		value = cgroups.RdmaUnlimited
 	} else {
 		val64, err := strconv.ParseUint(v, 10, 32)
 		if err != nil {
@@ -99,22 +100,73 @@ func RdmaGetStats(path string, stats *cgroups.Stats) error {
 }
 
 func createCmdString(device string, limits cgroups.LinuxRdma) string {
+	if limits.HcaHandles == nil && limits.HcaObjects == nil {
+		// Remove all the limits for the device.
+		return device + " hca_handle=max hca_object=max"
+	}
 	cmdString := device
 	if limits.HcaHandles != nil {
-		cmdString += " hca_handle=" + strconv.FormatUint(uint64(*limits.HcaHandles), 10)
+		cmdString += " hca_handle=" + formatRdmaLimit(*limits.HcaHandles)
 	}
 	if limits.HcaObjects != nil {
-		cmdString += " hca_object=" + strconv.FormatUint(uint64(*limits.HcaObjects), 10)
+		cmdString += " hca_object=" + formatRdmaLimit(*limits.HcaObjects)
 	}
 	return cmdString
 }
 
-// RdmaSet sets RDMA resources.
+func formatRdmaLimit(v uint32) string {
+	if v == cgroups.RdmaUnlimited {
+		return "max"
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// RdmaLines returns the lines to be written to rdma.max to set the RDMA
+// resources, sorted by device name.
+func RdmaLines(r *cgroups.Resources) []string {
+	lines := make([]string, 0, len(r.Rdma))
+	for _, device := range slices.Sorted(maps.Keys(r.Rdma)) {
+		lines = append(lines, createCmdString(device, r.Rdma[device]))
+	}
+	return lines
+}
+
+// RdmaSet sets RDMA resources. See [cgroups.LinuxRdma] for how to remove
+// the limits.
 func RdmaSet(path string, r *cgroups.Resources) error {
-	for device, limits := range r.Rdma {
-		if err := cgroups.WriteFile(path, "rdma.max", createCmdString(device, limits)); err != nil {
+	for _, line := range RdmaLines(r) {
+		if err := cgroups.WriteFile(path, "rdma.max", line); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// RdmaGet reads the RDMA limits from rdma.max into r.Rdma. Devices with
+// no limits are omitted, as are unlimited ("max") values.
+func RdmaGet(path string, r *cgroups.Resources) error {
+	entries, err := readRdmaEntries(path, "rdma.max")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		var limits cgroups.LinuxRdma
+		if e.HcaHandles != cgroups.RdmaUnlimited {
+			limits.HcaHandles = &e.HcaHandles
+		}
+		if e.HcaObjects != cgroups.RdmaUnlimited {
+			limits.HcaObjects = &e.HcaObjects
+		}
+		if limits.HcaHandles == nil && limits.HcaObjects == nil {
+			continue
+		}
+		if r.Rdma == nil {
+			r.Rdma = make(map[string]cgroups.LinuxRdma)
+		}
+		r.Rdma[e.Device] = limits
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package fscommon
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/opencontainers/cgroups"
@@ -55,3 +56,84 @@ func TestRdmaSet(t *testing.T) {
 		t.Fatalf("rdma_test: Got the wrong value for hca_Objects")
 	}
 }
+
+func TestRdmaSetUnlimited(t *testing.T) {
+	path := t.TempDir()
+	handles, objects := cgroups.RdmaUnlimited, uint32(300)
+
+	for _, tc := range []struct {
+		limits   cgroups.LinuxRdma
+		expected string
+	}{
+		{
+			limits:   cgroups.LinuxRdma{HcaHandles: &handles, HcaObjects: &objects},
+			expected: "mlx5_1 hca_handle=max hca_object=300",
+		},
+		{
+			// Removal of all the limits.
+			limits:   cgroups.LinuxRdma{},
+			expected: "mlx5_1 hca_handle=max hca_object=max",
+		},
+	} {
+		r := &cgroups.Resources{Rdma: map[string]cgroups.LinuxRdma{"mlx5_1": tc.limits}}
+		if err := RdmaSet(path, r); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(path, "rdma.max"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, data)
+		}
+	}
+}
+
+func TestRdmaGetStats(t *testing.T) {
+	path := t.TempDir()
+	for file, data := range map[string]string{
+		"rdma.max":     "mlx5_1 hca_handle=max hca_object=0\n",
+		"rdma.current": "mlx5_1 hca_handle=1 hca_object=0\n",
+	} {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := cgroups.NewStats()
+	if err := RdmaGetStats(path, stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := cgroups.RdmaStats{
+		RdmaLimit:   []cgroups.RdmaEntry{{Device: "mlx5_1", HcaHandles: cgroups.RdmaUnlimited, HcaObjects: 0}},
+		RdmaCurrent: []cgroups.RdmaEntry{{Device: "mlx5_1", HcaHandles: 1, HcaObjects: 0}},
+	}
+	if !reflect.DeepEqual(stats.RdmaStats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats.RdmaStats)
+	}
+}
+
+func TestRdmaGet(t *testing.T) {
+	path := t.TempDir()
+	data := "mlx5_1 hca_handle=100 hca_object=max\nmlx5_2 hca_handle=max hca_object=max\n"
+	if err := os.WriteFile(filepath.Join(path, "rdma.max"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &cgroups.Resources{}
+	if err := RdmaGet(path, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Rdma) != 1 {
+		t.Fatalf("expected only mlx5_1 to be limited, got %v", r.Rdma)
+	}
+	limits := r.Rdma["mlx5_1"]
+	if limits.HcaHandles == nil || *limits.HcaHandles != 100 || limits.HcaObjects != nil {
+		t.Errorf("unexpected mlx5_1 limits: %+v", limits)
+	}
+
+	// A missing file is not an error.
+	if err := RdmaGet(t.TempDir(), &cgroups.Resources{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,146 @@
+package fscommon
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// Snapshot holds the saved contents of cgroup files, so they can be
+// restored if a cgroup update fails midway (see [cgroups.Resources]
+// RollbackOnError field).
+type Snapshot struct {
+	files []savedFile
+}
+
+type savedFile struct {
+	dir, name, data string
+}
+
+// keyedFiles are the files consisting of lines with per-key (usually
+// per-device) settings, mapped to a function returning a line which
+// removes the setting for a key (or nil, if every key is always there).
+// For these files, restoring means writing the saved lines one by one,
+// and removing the settings for keys which were not there.
+var keyedFiles = map[string]func(key string) string{
+	"io.max":                           func(k string) string { return k + " rbps=max wbps=max riops=max wiops=max" },
+	"io.weight":                        func(k string) string { return k + " default" },
+	"io.bfq.weight":                    func(k string) string { return k + " default" },
+	"io.latency":                       func(k string) string { return k + " target=max" },
+	"blkio.weight_device":              func(k string) string { return k + " 0" },
+	"blkio.leaf_weight_device":         func(k string) string { return k + " 0" },
+	"blkio.bfq.weight_device":          func(k string) string { return k + " 0" },
+	"blkio.throttle.read_bps_device":   func(k string) string { return k + " 0" },
+	"blkio.throttle.write_bps_device":  func(k string) string { return k + " 0" },
+	"blkio.throttle.read_iops_device":  func(k string) string { return k + " 0" },
+	"blkio.throttle.write_iops_device": func(k string) string { return k + " 0" },
+	"rdma.max":                         nil,
+	"net_prio.ifpriomap":               nil,
+}
+
+// Save saves the current contents of the named files in dir. Files which
+// can not be read (e.g. do not exist) are skipped, as they can not be
+// written either.
+func (s *Snapshot) Save(dir string, names ...string) {
+	for _, name := range names {
+		data, err := cgroups.ReadFile(dir, name)
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, savedFile{dir: dir, name: name, data: data})
+	}
+}
+
+// Restore writes back the saved contents of the files which were changed
+// since they were saved, in reverse order. As the order of writes may
+// matter (e.g. cgroup v1 memory limit can't be higher than memory+swap
+// limit), files which can not be restored are retried once after the
+// rest is restored.
+func (s *Snapshot) Restore() error {
+	pending := slices.Clone(s.files)
+	slices.Reverse(pending)
+	var errs []error
+	for range 2 {
+		var failed []savedFile
+		errs = nil
+		for _, f := range pending {
+			if err := f.restore(); err != nil {
+				failed = append(failed, f)
+				errs = append(errs, err)
+			}
+		}
+		if len(failed) == 0 {
+			break
+		}
+		pending = failed
+	}
+	return errors.Join(errs...)
+}
+
+// Rollback restores the saved files (see Restore) after a failed update,
+// and returns a [*cgroups.RollbackError] describing both the update error
+// err and the restore error, if any.
+func (s *Snapshot) Rollback(err error) error {
+	return &cgroups.RollbackError{Err: err, RollbackErr: s.Restore()}
+}
+
+func (f *savedFile) restore() error {
+	cur, err := cgroups.ReadFile(f.dir, f.name)
+	if err != nil {
+		return err
+	}
+	if cur == f.data {
+		return nil
+	}
+
+	if f.name == "memory.oom_control" {
+		// The file has a few "key value" lines, but only the
+		// oom_kill_disable value is written.
+		for _, line := range strings.Split(f.data, "\n") {
+			if v, ok := strings.CutPrefix(line, "oom_kill_disable "); ok {
+				return cgroups.WriteFile(f.dir, f.name, v)
+			}
+		}
+		return nil
+	}
+
+	reset, ok := keyedFiles[f.name]
+	if !ok && !strings.Contains(strings.TrimSpace(f.data), "\n") {
+		return cgroups.WriteFile(f.dir, f.name, strings.TrimSpace(f.data))
+	}
+
+	saved := lines(f.data)
+	if reset != nil {
+		keys := make(map[string]bool, len(saved))
+		for _, line := range saved {
+			keys[lineKey(line)] = true
+		}
+		for _, line := range lines(cur) {
+			if k := lineKey(line); !keys[k] {
+				if err := cgroups.WriteFile(f.dir, f.name, reset(k)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, line := range saved {
+		if err := cgroups.WriteFile(f.dir, f.name, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lines returns the non-empty lines of data.
+func lines(data string) []string {
+	return slices.DeleteFunc(strings.Split(data, "\n"), func(s string) bool {
+		return strings.TrimSpace(s) == ""
+	})
+}
+
+func lineKey(line string) string {
+	k, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+	return k
+}
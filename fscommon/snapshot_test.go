@@ -0,0 +1,103 @@
+package fscommon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"pids.max":           "max\n",
+		"io.max":             "8:0 rbps=1000 wbps=max riops=max wiops=max\n",
+		"memory.oom_control": "oom_kill_disable 0\nunder_oom 0\n",
+		"cpu.weight":         "100\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Snapshot{}
+	s.Save(dir, "pids.max", "io.max", "memory.oom_control", "cpu.weight", "no.such.file")
+	if len(s.files) != 4 {
+		t.Fatalf("expected 4 saved files, got %d", len(s.files))
+	}
+
+	for name, data := range map[string]string{
+		"pids.max":           "100",
+		"io.max":             "8:16 rbps=max wbps=2000 riops=max wiops=max",
+		"memory.oom_control": "1",
+	} {
+		if err := cgroups.WriteFile(dir, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake cgroupfs keeps the last written line only.
+	for name, want := range map[string]string{
+		"pids.max":           "max",
+		"io.max":             "8:0 rbps=1000 wbps=max riops=max wiops=max",
+		"memory.oom_control": "0",
+		"cpu.weight":         "100\n", // Unchanged, so not written.
+	} {
+		got, err := cgroups.ReadFile(dir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestSnapshotRollback(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"pids.max", "cpu.max"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("max\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Snapshot{}
+	s.Save(dir, "pids.max", "cpu.max")
+	if err := cgroups.WriteFile(dir, "pids.max", "10"); err != nil {
+		t.Fatal(err)
+	}
+	setErr := errors.New("write failed")
+
+	err := s.Rollback(setErr)
+	var rbErr *cgroups.RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("expected RollbackError, got %v", err)
+	}
+	if !errors.Is(err, setErr) || rbErr.RollbackErr != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A file which can not be restored is reported.
+	if err := cgroups.WriteFile(dir, "pids.max", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "cpu.max")); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Rollback(setErr)
+	if !errors.As(err, &rbErr) || rbErr.RollbackErr == nil {
+		t.Fatalf("expected a rollback failure, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "cpu.max") {
+		t.Errorf("expected the error to mention cpu.max, got %v", err)
+	}
+	if got, _ := cgroups.ReadFile(dir, "pids.max"); got != "max" {
+		t.Errorf("expected pids.max to be restored, got %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+package fscommon
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// Writer writes cgroup files on behalf of the code setting the cgroup
+// resources, so that the managers' Set (using a [FileWriter]) and Plan
+// (using a [Recorder]) run the same code.
+type Writer interface {
+	WriteFile(dir, file, data string) error
+	WriteFileByLine(dir, file, data string) error
+	// Recording tells that the writes are only recorded, so their
+	// effect can not be checked.
+	Recording() bool
+}
+
+// FileWriter is a [Writer] which writes the cgroup files.
+type FileWriter struct{}
+
+func (FileWriter) WriteFile(dir, file, data string) error {
+	return cgroups.WriteFile(dir, file, data)
+}
+
+func (FileWriter) WriteFileByLine(dir, file, data string) error {
+	return cgroups.WriteFileByLine(dir, file, data)
+}
+
+func (FileWriter) Recording() bool {
+	return false
+}
+
+// Recorder is a [Writer] which records the writes as operations, without
+// changing anything.
+type Recorder struct {
+	Ops []cgroups.Operation
+}
+
+func (rec *Recorder) WriteFile(dir, file, data string) error {
+	old, err := cgroups.ReadFile(dir, file)
+	// Like an actual write, fail if the file does not exist.
+	if errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	rec.Ops = append(rec.Ops, cgroups.Operation{
+		Path: dir,
+		File: file,
+		Old:  strings.TrimSpace(old),
+		New:  data,
+	})
+	return nil
+}
+
+func (rec *Recorder) WriteFileByLine(dir, file, data string) error {
+	return rec.WriteFile(dir, file, data)
+}
+
+func (rec *Recorder) Recording() bool {
+	return true
+}
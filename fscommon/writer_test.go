@@ -0,0 +1,33 @@
+package fscommon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte("max\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &Recorder{}
+	if err := rec.WriteFile(dir, "pids.max", "100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.WriteFile(dir, "no.such.file", "1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	expected := []cgroups.Operation{{Path: dir, File: "pids.max", Old: "max", New: "100"}}
+	if !reflect.DeepEqual(rec.Ops, expected) {
+		t.Errorf("expected %v, got %v", expected, rec.Ops)
+	}
+	if got, err := cgroups.ReadFile(dir, "pids.max"); err != nil || got != "max\n" {
+		t.Errorf("pids.max: expected no change, got %q (error: %v)", got, err)
+	}
+}
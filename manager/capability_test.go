@@ -0,0 +1,434 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fs"
+	"github.com/opencontainers/cgroups/fs2"
+	"github.com/opencontainers/cgroups/systemd"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// capabilities is the matrix of Resources fields support by cgroup
+// managers. A field is either applied (written to the given v1 or v2
+// cgroup file), or rejected with an UnsupportedError.
+var capabilities = []struct {
+	field string
+	set   func(*cgroups.Resources)
+	// v1File is "controller/file" for cgroup v1, and v2File is the
+	// file for cgroup v2; empty means unsupported.
+	v1File, v2File string
+}{
+	{
+		field:  "Memory",
+		set:    func(r *cgroups.Resources) { r.Memory = 1 << 30 },
+		v1File: "memory/memory.limit_in_bytes", v2File: "memory.max",
+	},
+	{
+		field: "MemorySwap",
+		set: func(r *cgroups.Resources) {
+			r.Memory = 1 << 30
+			r.MemorySwap = 2 << 30
+		},
+		v1File: "memory/memory.memsw.limit_in_bytes", v2File: "memory.swap.max",
+	},
+	{
+		field:  "MemoryReservation",
+		set:    func(r *cgroups.Resources) { r.MemoryReservation = 1 << 29 },
+		v1File: "memory/memory.soft_limit_in_bytes", v2File: "memory.low",
+	},
+	{
+		field:  "PidsLimit",
+		set:    func(r *cgroups.Resources) { r.PidsLimit = 42 },
+		v1File: "pids/pids.max", v2File: "pids.max",
+	},
+	{
+		field:  "CpuBurst",
+		set:    func(r *cgroups.Resources) { r.CpuBurst = ptr(uint64(10000)) },
+		v1File: "cpu/cpu.cfs_burst_us", v2File: "cpu.max.burst",
+	},
+	{
+		field:  "CPUIdle",
+		set:    func(r *cgroups.Resources) { r.CPUIdle = ptr(int64(1)) },
+		v1File: "cpu/cpu.idle", v2File: "cpu.idle",
+	},
+	{
+		field:  "CpuShares",
+		set:    func(r *cgroups.Resources) { r.CpuShares = 512 },
+		v1File: "cpu/cpu.shares",
+	},
+	{
+		field:  "CpuWeight",
+		set:    func(r *cgroups.Resources) { r.CpuWeight = 50 },
+		v2File: "cpu.weight",
+	},
+	{
+		field: "CpuQuota",
+		set: func(r *cgroups.Resources) {
+			r.CpuQuota = 50000
+			r.CpuPeriod = 100000
+		},
+		v1File: "cpu/cpu.cfs_quota_us", v2File: "cpu.max",
+	},
+	{
+		field:  "CpuPeriod",
+		set:    func(r *cgroups.Resources) { r.CpuPeriod = 200000 },
+		v1File: "cpu/cpu.cfs_period_us", v2File: "cpu.max",
+	},
+	{
+		field:  "CpusetCpus",
+		set:    func(r *cgroups.Resources) { r.CpusetCpus = "0" },
+		v1File: "cpuset/cpuset.cpus", v2File: "cpuset.cpus",
+	},
+	{
+		field:  "CpusetMems",
+		set:    func(r *cgroups.Resources) { r.CpusetMems = "0" },
+		v1File: "cpuset/cpuset.mems", v2File: "cpuset.mems",
+	},
+	{
+		field:  "CpuRtRuntime",
+		set:    func(r *cgroups.Resources) { r.CpuRtRuntime = 1000 },
+		v1File: "cpu/cpu.rt_runtime_us",
+	},
+	{
+		field:  "CpuRtPeriod",
+		set:    func(r *cgroups.Resources) { r.CpuRtPeriod = 100000 },
+		v1File: "cpu/cpu.rt_period_us",
+	},
+	{
+		field:  "BlkioWeight",
+		set:    func(r *cgroups.Resources) { r.BlkioWeight = 500 },
+		v1File: "blkio/blkio.weight", v2File: "io.weight",
+	},
+	{
+		field:  "BlkioLeafWeight",
+		set:    func(r *cgroups.Resources) { r.BlkioLeafWeight = 100 },
+		v1File: "blkio/blkio.leaf_weight",
+	},
+	{
+		// Needs per-device BFQ weights on cgroup v2, which the fake
+		// cgroupfs lacks.
+		field: "BlkioWeightDevice",
+		set: func(r *cgroups.Resources) {
+			r.BlkioWeightDevice = []*cgroups.WeightDevice{cgroups.NewWeightDevice(8, 0, 500, 0)}
+		},
+		v1File: "blkio/blkio.weight_device",
+	},
+	{
+		// Leaf weights are not supported on cgroup v2.
+		field: "BlkioWeightDevice",
+		set: func(r *cgroups.Resources) {
+			r.BlkioWeightDevice = []*cgroups.WeightDevice{cgroups.NewWeightDevice(8, 0, 0, 500)}
+		},
+		v1File: "blkio/blkio.leaf_weight_device",
+	},
+	{
+		field: "BlkioThrottleReadBpsDevice",
+		set: func(r *cgroups.Resources) {
+			r.BlkioThrottleReadBpsDevice = []*cgroups.ThrottleDevice{cgroups.NewThrottleDevice(8, 0, 1<<20)}
+		},
+		v1File: "blkio/blkio.throttle.read_bps_device", v2File: "io.max",
+	},
+	{
+		field: "BlkioThrottleWriteBpsDevice",
+		set: func(r *cgroups.Resources) {
+			r.BlkioThrottleWriteBpsDevice = []*cgroups.ThrottleDevice{cgroups.NewThrottleDevice(8, 0, 1<<20)}
+		},
+		v1File: "blkio/blkio.throttle.write_bps_device", v2File: "io.max",
+	},
+	{
+		field: "BlkioThrottleReadIOPSDevice",
+		set: func(r *cgroups.Resources) {
+			r.BlkioThrottleReadIOPSDevice = []*cgroups.ThrottleDevice{cgroups.NewThrottleDevice(8, 0, 100)}
+		},
+		v1File: "blkio/blkio.throttle.read_iops_device", v2File: "io.max",
+	},
+	{
+		field: "BlkioThrottleWriteIOPSDevice",
+		set: func(r *cgroups.Resources) {
+			r.BlkioThrottleWriteIOPSDevice = []*cgroups.ThrottleDevice{cgroups.NewThrottleDevice(8, 0, 100)}
+		},
+		v1File: "blkio/blkio.throttle.write_iops_device", v2File: "io.max",
+	},
+	{
+		field: "IOWeightDevice",
+		set: func(r *cgroups.Resources) {
+			r.IOWeightDevice = []*cgroups.IOWeightDevice{cgroups.NewIOWeightDevice(8, 0, 200)}
+		},
+		v2File: "io.weight",
+	},
+	{
+		field: "IOLatencyDevice",
+		set: func(r *cgroups.Resources) {
+			r.IOLatencyDevice = []*cgroups.IOLatencyDevice{cgroups.NewIOLatencyDevice(8, 0, 1000)}
+		},
+		v2File: "io.latency",
+	},
+	{
+		field:  "OomKillDisable",
+		set:    func(r *cgroups.Resources) { r.OomKillDisable = true },
+		v1File: "memory/memory.oom_control",
+	},
+	{
+		field:  "MemorySwappiness",
+		set:    func(r *cgroups.Resources) { r.MemorySwappiness = ptr(uint64(10)) },
+		v1File: "memory/memory.swappiness",
+	},
+	{
+		field:  "MemorySwapHigh",
+		set:    func(r *cgroups.Resources) { r.MemorySwapHigh = ptr(int64(0)) },
+		v2File: "memory.swap.high",
+	},
+	{
+		field:  "MemoryZswapMax",
+		set:    func(r *cgroups.Resources) { r.MemoryZswapMax = ptr(int64(0)) },
+		v2File: "memory.zswap.max",
+	},
+	{
+		field:  "MemoryZswapWriteback",
+		set:    func(r *cgroups.Resources) { r.MemoryZswapWriteback = ptr(false) },
+		v2File: "memory.zswap.writeback",
+	},
+	{
+		field: "HugetlbLimit",
+		set: func(r *cgroups.Resources) {
+			r.HugetlbLimit = []*cgroups.HugepageLimit{{Pagesize: "2MB", Limit: 1 << 30}}
+		},
+		v1File: "hugetlb/hugetlb.2MB.limit_in_bytes", v2File: "hugetlb.2MB.max",
+	},
+	{
+		field: "Rdma",
+		set: func(r *cgroups.Resources) {
+			r.Rdma = map[string]cgroups.LinuxRdma{"mlx5_0": {HcaHandles: ptr(uint32(10))}}
+		},
+		v1File: "rdma/rdma.max", v2File: "rdma.max",
+	},
+	{
+		field:  "NetClsClassid",
+		set:    func(r *cgroups.Resources) { r.NetClsClassid = 0x100001 },
+		v1File: "net_cls/net_cls.classid",
+	},
+	{
+		field: "NetPrioIfpriomap",
+		set: func(r *cgroups.Resources) {
+			r.NetPrioIfpriomap = []*cgroups.IfPrioMap{{Interface: "lo", Priority: 1}}
+		},
+		v1File: "net_prio/net_prio.ifpriomap",
+	},
+	{
+		field:  "Freezer",
+		set:    func(r *cgroups.Resources) { r.Freezer = cgroups.Thawed },
+		v1File: "freezer/freezer.state", v2File: "cgroup.freeze",
+	},
+}
+
+var v1TestControllers = []string{"blkio", "cpu", "cpuset", "devices", "freezer", "hugetlb", "memory", "net_cls", "net_prio", "pids", "rdma"}
+
+// seedV1 creates the cgroup v1 files (in dir, and, for cpuset, in its
+// ancestors) which are read before being written.
+func seedV1(t *testing.T, dir, cgPath string) {
+	t.Helper()
+	files := map[string]map[string]string{
+		"blkio":  {"blkio.weight": "500\n", "blkio.weight_device": ""},
+		"cpuset": {"cpuset.cpus": "0\n", "cpuset.mems": "0\n"},
+		"memory": {"memory.limit_in_bytes": "9223372036854771712\n"},
+	}
+	for c, cf := range files {
+		p := filepath.Join(dir, c)
+		for _, e := range append([]string{""}, strings.Split(cgPath, "/")...) {
+			p = filepath.Join(p, e)
+			if c != "cpuset" && p != filepath.Join(dir, c, cgPath) {
+				continue
+			}
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for name, data := range cf {
+				if err := os.WriteFile(filepath.Join(p, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+// newTestManager returns a manager of the given type using a fake
+// cgroupfs (and a fake systemd) in dir, and a function returning the
+// cgroupfs path for a v1 controller (or v2, if controller is empty).
+func newTestManager(t *testing.T, typ, dir string) (cgroups.Manager, func(controller string) string) {
+	t.Helper()
+	config := &cgroups.Cgroup{ScopePrefix: "test", Name: "matrix", Resources: &cgroups.Resources{}}
+	const cgPath = "system.slice/test-matrix.scope"
+
+	var (
+		m        cgroups.Manager
+		err      error
+		v1Paths  = make(map[string]string)
+		fake     *systemdtest.Fake
+		pathFunc = func(c string) string { return filepath.Join(dir, c, cgPath) }
+	)
+	switch typ {
+	case cgroups.ManagerTypeFs, cgroups.ManagerTypeFs2:
+		if typ == cgroups.ManagerTypeFs {
+			for _, c := range v1TestControllers {
+				v1Paths[c] = pathFunc(c)
+			}
+			seedV1(t, dir, cgPath)
+			m, err = fs.NewManager(config, v1Paths)
+		} else {
+			m, err = fs2.NewManager(config, pathFunc(""))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range v1TestControllers {
+			if typ == cgroups.ManagerTypeFs2 {
+				c = ""
+			}
+			if err := os.MkdirAll(pathFunc(c), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if typ == cgroups.ManagerTypeFs2 {
+			if err := os.WriteFile(filepath.Join(pathFunc(""), "cgroup.controllers"), []byte("cpu io memory pids\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			seedFrozen(t, pathFunc(""))
+		}
+		return m, pathFunc
+	case cgroups.ManagerTypeSystemd:
+		fake = systemdtest.New(dir)
+		pathFunc = func(string) string { return fake.CgroupDir("", cgPath) }
+		m, err = systemd.NewUnifiedManagerWithBackend(config, pathFunc(""), fake)
+	case cgroups.ManagerTypeSystemdLegacy:
+		fake = systemdtest.NewLegacy(dir)
+		seedV1(t, dir, cgPath)
+		pathFunc = func(c string) string { return fake.CgroupDir(c, cgPath) }
+		for _, c := range v1TestControllers {
+			v1Paths[c] = pathFunc(c)
+		}
+		m, err = systemd.NewLegacyManagerWithBackend(config, v1Paths, fake)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeManager(m) })
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	if typ == cgroups.ManagerTypeSystemd {
+		seedFrozen(t, pathFunc(""))
+	}
+	return m, pathFunc
+}
+
+// seedFrozen makes the cgroup v2 freezer in dir start frozen, so that
+// the Thawed state written by the Freezer case is a visible change.
+func seedFrozen(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.freeze"), []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCapabilityMatrix checks that every cgroup manager either applies
+// a Resources field, or rejects it with an UnsupportedError.
+func TestCapabilityMatrix(t *testing.T) {
+	cgroups.TestMode = true
+	t.Cleanup(func() { cgroups.TestMode = false })
+
+	for _, typ := range []string{
+		cgroups.ManagerTypeFs,
+		cgroups.ManagerTypeFs2,
+		cgroups.ManagerTypeSystemd,
+		cgroups.ManagerTypeSystemdLegacy,
+	} {
+		v2 := typ == cgroups.ManagerTypeFs2 || typ == cgroups.ManagerTypeSystemd
+		for _, c := range capabilities {
+			t.Run(typ+"/"+c.field, func(t *testing.T) {
+				m, path := newTestManager(t, typ, t.TempDir())
+				r := &cgroups.Resources{}
+				c.set(r)
+
+				file := c.v1File
+				if v2 {
+					file = c.v2File
+				}
+				controller := ""
+				if !v2 {
+					controller, file = filepath.Split(file)
+				}
+				filePath := filepath.Join(path(filepath.Clean(controller)), file)
+				before, _ := os.ReadFile(filePath)
+
+				err := m.Set(r)
+				if file == "" {
+					var ue *cgroups.UnsupportedError
+					if !errors.As(err, &ue) || ue.Field != c.field || ue.Manager != typ {
+						t.Fatalf("expected UnsupportedError for %s, got %v", c.field, err)
+					}
+					if !errors.Is(err, errors.ErrUnsupported) {
+						t.Errorf("expected error to match errors.ErrUnsupported")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The values written differ from the initial ones
+				// (if any), which end with a newline.
+				if after, err := os.ReadFile(filePath); err != nil || string(after) == string(before) {
+					t.Errorf("%s is not applied (error: %v)", c.field, err)
+				}
+			})
+		}
+	}
+}
+
+// TestCapabilityMissingFile checks that the fields which depend on
+// optional kernel features are rejected with an UnsupportedError when
+// the cgroup file is absent.
+func TestCapabilityMissingFile(t *testing.T) {
+	cgroups.TestMode = true
+	t.Cleanup(func() { cgroups.TestMode = false })
+
+	for _, tc := range []struct {
+		typ, field string
+		set        func(*cgroups.Resources)
+		controller string
+	}{
+		{
+			typ: cgroups.ManagerTypeFs, field: "CpuBurst",
+			set:        func(r *cgroups.Resources) { r.CpuBurst = ptr(uint64(10000)) },
+			controller: "cpu",
+		},
+		{
+			typ: cgroups.ManagerTypeSystemdLegacy, field: "CpuBurst",
+			set:        func(r *cgroups.Resources) { r.CpuBurst = ptr(uint64(10000)) },
+			controller: "cpu",
+		},
+	} {
+		t.Run(tc.typ+"/"+tc.field, func(t *testing.T) {
+			m, path := newTestManager(t, tc.typ, t.TempDir())
+			// The fake cgroupfs creates the files being written, so
+			// remove the directory to emulate a missing file.
+			if err := os.RemoveAll(path(tc.controller)); err != nil {
+				t.Fatal(err)
+			}
+			r := &cgroups.Resources{}
+			tc.set(r)
+			err := m.Set(r)
+			var ue *cgroups.UnsupportedError
+			if !errors.As(err, &ue) || ue.Field != tc.field || ue.Manager != tc.typ {
+				t.Fatalf("expected UnsupportedError for %s, got %v", tc.field, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fs"
+	"github.com/opencontainers/cgroups/fs2"
+	"github.com/opencontainers/cgroups/systemd"
+)
+
+// Restore returns a cgroup manager from its state, as saved by the
+// manager's MarshalState method (see [cgroups.State] for the format).
+// The manager type must match the local environment (cgroup version,
+// and whether systemd is running).
+//
+// For the systemd managers, the saved unit name must match the saved
+// config (see [systemd.Restore]).
+//
+// Restore neither checks nor modifies the cgroup, so the returned
+// manager can be used as if it was created by [NewWithPaths] (which
+// does not create the cgroup either) with the saved config and paths.
+func Restore(state []byte) (cgroups.Manager, error) {
+	st, err := cgroups.UnmarshalState(state)
+	if err != nil {
+		return nil, err
+	}
+	return restore(st, cgroups.IsCgroup2UnifiedMode(), systemd.IsRunningSystemd)
+}
+
+// restore is the implementation of Restore, with the cgroup version
+// and the systemd presence check given explicitly.
+func restore(st *cgroups.State, unified bool, isRunningSystemd func() bool) (cgroups.Manager, error) {
+	var wantUnified, wantSystemd bool
+	switch st.Type {
+	case cgroups.ManagerTypeFs:
+	case cgroups.ManagerTypeFs2:
+		wantUnified = true
+	case cgroups.ManagerTypeSystemd:
+		wantUnified, wantSystemd = true, true
+	case cgroups.ManagerTypeSystemdLegacy:
+		wantSystemd = true
+	default:
+		return nil, fmt.Errorf("unknown cgroup manager type %q", st.Type)
+	}
+	if wantUnified != unified {
+		return nil, fmt.Errorf("can't restore %s cgroup manager: cgroup version mismatch", st.Type)
+	}
+	if wantSystemd && !isRunningSystemd() {
+		return nil, errors.New("systemd not running on this host, cannot use systemd cgroups manager")
+	}
+	// Keep the Systemd flag consistent with the manager type.
+	st.Config.Systemd = wantSystemd
+
+	if unified {
+		path, err := getUnifiedPath(st.Paths)
+		if err != nil {
+			return nil, fmt.Errorf("manager.Restore: inconsistent paths: %w", err)
+		}
+		if path == "" {
+			return nil, errors.New("manager.Restore: no cgroup path")
+		}
+		if wantSystemd {
+			return systemd.Restore(st)
+		}
+		return fs2.NewManager(st.Config, path)
+	}
+
+	if len(st.Paths) == 0 {
+		return nil, errors.New("manager.Restore: no cgroup paths")
+	}
+	if st.Config.Resources == nil {
+		st.Config.Resources = &cgroups.Resources{}
+	}
+	if wantSystemd {
+		return systemd.Restore(st)
+	}
+	return fs.NewManager(st.Config, st.Paths)
+}
@@ -0,0 +1,261 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fs"
+	"github.com/opencontainers/cgroups/fs2"
+	"github.com/opencontainers/cgroups/systemd"
+)
+
+type stateMarshaler interface {
+	cgroups.Manager
+	MarshalState() ([]byte, error)
+}
+
+func closeManager(m cgroups.Manager) {
+	if c, ok := m.(interface{ Close() error }); ok {
+		_ = c.Close()
+	}
+}
+
+func systemdRunning() bool { return true }
+
+func TestRestoreRoundTrip(t *testing.T) {
+	uid := 1000
+	v2Paths := map[string]string{"": "/sys/fs/cgroup/system.slice/runc-test.scope"}
+	v1Paths := map[string]string{
+		"devices": "/sys/fs/cgroup/devices/system.slice/runc-test.scope",
+		"memory":  "/sys/fs/cgroup/memory/system.slice/runc-test.scope",
+	}
+	newConfig := func() *cgroups.Cgroup {
+		return &cgroups.Cgroup{
+			Name:        "test",
+			Parent:      "system.slice",
+			ScopePrefix: "runc",
+			OwnerUID:    &uid,
+			Resources:   &cgroups.Resources{Memory: 1 << 30, PidsLimit: 100},
+			SystemdProperties: []cgroups.SystemdProperty{
+				{Name: "CollectMode", Value: "inactive-or-failed"},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		typ     string
+		unified bool
+		new     func(*cgroups.Cgroup) (stateMarshaler, error)
+	}{
+		{
+			typ: cgroups.ManagerTypeFs,
+			new: func(c *cgroups.Cgroup) (stateMarshaler, error) { return fs.NewManager(c, v1Paths) },
+		},
+		{
+			typ: cgroups.ManagerTypeFs2, unified: true,
+			new: func(c *cgroups.Cgroup) (stateMarshaler, error) { return fs2.NewManager(c, v2Paths[""]) },
+		},
+		{
+			typ: cgroups.ManagerTypeSystemd, unified: true,
+			new: func(c *cgroups.Cgroup) (stateMarshaler, error) {
+				c.Systemd = true
+				return systemd.NewUnifiedManager(c, v2Paths[""])
+			},
+		},
+		{
+			typ: cgroups.ManagerTypeSystemdLegacy,
+			new: func(c *cgroups.Cgroup) (stateMarshaler, error) {
+				c.Systemd = true
+				return systemd.NewLegacyManager(c, v1Paths)
+			},
+		},
+	} {
+		t.Run(tc.typ, func(t *testing.T) {
+			m, err := tc.new(newConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeManager(m)
+			data, err := m.MarshalState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			st, err := cgroups.UnmarshalState(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Type != tc.typ {
+				t.Errorf("expected type %s, got %s", tc.typ, st.Type)
+			}
+			if (st.Unit != "") != (tc.typ == cgroups.ManagerTypeSystemd || tc.typ == cgroups.ManagerTypeSystemdLegacy) {
+				t.Errorf("unexpected unit %q", st.Unit)
+			}
+
+			// Wrong cgroup version.
+			if _, err := restore(st, !tc.unified, systemdRunning); err == nil {
+				t.Error("expected an error on cgroup version mismatch")
+			}
+
+			r, err := restore(st, tc.unified, systemdRunning)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeManager(r)
+			if !reflect.DeepEqual(r.GetPaths(), m.GetPaths()) {
+				t.Errorf("expected paths %v, got %v", m.GetPaths(), r.GetPaths())
+			}
+			want, _ := m.GetCgroups()
+			got, _ := r.GetCgroups()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected config %+v, got %+v", want, got)
+			}
+			data2, err := r.(stateMarshaler).MarshalState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, data2) {
+				t.Errorf("restored state differs:\n%s\n%s", data, data2)
+			}
+		})
+	}
+}
+
+// TestRestoreCompat checks that states saved in the previous versions of
+// the format can be restored, and are saved the same way.
+func TestRestoreCompat(t *testing.T) {
+	for _, tc := range []struct {
+		file    string
+		unified bool
+		check   func(*testing.T, *cgroups.Cgroup)
+	}{
+		{
+			file: "state-v1-systemd.json", unified: true,
+			check: func(t *testing.T, c *cgroups.Cgroup) {
+				if !c.Systemd || !c.Rootless || c.OwnerUID == nil || *c.OwnerUID != 1000 {
+					t.Errorf("unexpected config %+v", c)
+				}
+				if c.Resources.Unified["memory.high"] != "805306368" || c.Resources.CpuWeight != 200 {
+					t.Errorf("unexpected resources %+v", c.Resources)
+				}
+				if len(c.SystemdProperties) != 2 || c.SystemdProperties[1].Value != uint64(5000000) {
+					t.Errorf("unexpected systemd properties %+v", c.SystemdProperties)
+				}
+			},
+		},
+		{
+			file: "state-v1-fs.json",
+			check: func(t *testing.T, c *cgroups.Cgroup) {
+				if c.Path != "/test" || c.Resources.CpuShares != 512 || c.Resources.Memory != 1<<30 {
+					t.Errorf("unexpected config %+v", c)
+				}
+			},
+		},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st, err := cgroups.UnmarshalState(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := restore(st, tc.unified, systemdRunning)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeManager(m)
+			c, _ := m.GetCgroups()
+			tc.check(t, c)
+
+			saved, err := m.(stateMarshaler).MarshalState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, got any
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(saved, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected state %s, got %s", data, saved)
+			}
+		})
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`{}`,
+		`{"type": "fs", "paths": {}, "config": {}}`,
+		`{"version": 2, "type": "fs", "paths": {}, "config": {}}`,
+		`{"version": 1, "paths": {}, "config": {}}`,
+		`{"version": 1, "type": "fs", "paths": {}}`,
+		`{"version": 1, "type": "fs3", "paths": {"": "/sys/fs/cgroup"}, "config": {}}`,
+		`{"version": 1, "type": "fs", "paths": {}, "config": {}}`,
+	} {
+		if m, err := Restore([]byte(data)); err == nil {
+			closeManager(m)
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+
+	// No systemd.
+	st := &cgroups.State{Version: 1, Type: cgroups.ManagerTypeSystemd, Paths: map[string]string{"": "/sys/fs/cgroup/a"}, Config: &cgroups.Cgroup{}}
+	if _, err := restore(st, true, func() bool { return false }); err == nil {
+		t.Error("expected an error when systemd is not running")
+	}
+
+	// Unit not matching the config.
+	for _, typ := range []string{cgroups.ManagerTypeSystemd, cgroups.ManagerTypeSystemdLegacy} {
+		st := &cgroups.State{
+			Version: 1,
+			Type:    typ,
+			Unit:    "runc-other.scope",
+			Paths:   map[string]string{"": "/sys/fs/cgroup/system.slice/runc-test.scope"},
+			Config:  &cgroups.Cgroup{ScopePrefix: "runc", Name: "test"},
+		}
+		if m, err := restore(st, typ == cgroups.ManagerTypeSystemd, systemdRunning); err == nil {
+			closeManager(m)
+			t.Errorf("%s: expected an error on unit mismatch", typ)
+		}
+	}
+}
+
+func TestRestoreAttached(t *testing.T) {
+	for _, typ := range []string{cgroups.ManagerTypeSystemd, cgroups.ManagerTypeSystemdLegacy} {
+		t.Run(typ, func(t *testing.T) {
+			st := &cgroups.State{
+				Version:  1,
+				Type:     typ,
+				Unit:     "runc-test.scope",
+				Paths:    map[string]string{"": "/sys/fs/cgroup/system.slice/runc-test.scope"},
+				Config:   &cgroups.Cgroup{ScopePrefix: "runc", Name: "test"},
+				Attached: true,
+			}
+			m, err := restore(st, typ == cgroups.ManagerTypeSystemd, systemdRunning)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeManager(m)
+			data, err := m.(stateMarshaler).MarshalState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, err := cgroups.UnmarshalState(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !saved.Attached {
+				t.Errorf("attached flag is lost: %s", data)
+			}
+		})
+	}
+}
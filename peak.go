@@ -0,0 +1,23 @@
+package cgroups
+
+// PeakUsage is the peak memory usage of a cgroup within a measurement
+// window, in bytes.
+type PeakUsage struct {
+	// Memory is the peak memory usage.
+	Memory uint64 `json:"memory"`
+	// Swap is the peak swap usage, or 0 if swap accounting is not
+	// available. Note that on cgroup v1 it is the peak memory+swap
+	// usage (as in [MemoryStats] SwapUsage).
+	Swap uint64 `json:"swap,omitempty"`
+}
+
+// PeakTracker tracks the peak memory usage of a cgroup over measurement
+// windows. It is returned by the fs and fs2 managers' OpenPeakTracker.
+type PeakTracker interface {
+	// Reset starts a new measurement window.
+	Reset() error
+	// Peak returns the peak usage since the last Reset.
+	Peak() (PeakUsage, error)
+	// Close releases the resources held by the tracker.
+	Close() error
+}
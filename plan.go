@@ -0,0 +1,28 @@
+package cgroups
+
+// Operation describes a single change which a cgroup manager's Set
+// would make. It is either a cgroup file write (Path and File are set),
+// or a systemd unit property change (Unit and Property are set).
+type Operation struct {
+	// Path is the cgroup directory, and File is the name of the file
+	// in it to be written.
+	Path string `json:"path,omitempty"`
+	File string `json:"file,omitempty"`
+	// Unit is the systemd unit name, and Property is the name of the
+	// unit property to be set.
+	Unit     string `json:"unit,omitempty"`
+	Property string `json:"property,omitempty"`
+	// Old is the current value (file contents, or property value in
+	// the D-Bus text format), or empty if it can not be obtained.
+	Old string `json:"old,omitempty"`
+	// New is the value to be written (or set, in the D-Bus text format).
+	New string `json:"new"`
+}
+
+func (o Operation) String() string {
+	target := o.Path + "/" + o.File
+	if o.Unit != "" {
+		target = o.Unit + " " + o.Property
+	}
+	return target + ": " + o.Old + " -> " + o.New
+}
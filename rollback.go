@@ -0,0 +1,23 @@
+package cgroups
+
+// RollbackError is returned by cgroup managers' Set method when a cgroup
+// update failed and [Resources] RollbackOnError is set. It wraps the
+// update error.
+type RollbackError struct {
+	// Err is the error which caused the rollback.
+	Err error
+	// RollbackErr is the error restoring the cgroup files, or nil if
+	// all the files were restored.
+	RollbackErr error
+}
+
+func (e *RollbackError) Error() string {
+	if e.RollbackErr == nil {
+		return e.Err.Error() + " (changes rolled back)"
+	}
+	return e.Err.Error() + " (rollback failed: " + e.RollbackErr.Error() + ")"
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
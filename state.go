@@ -0,0 +1,84 @@
+package cgroups
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// StateVersion is the version of the state format produced by the
+// MarshalState methods of cgroup managers (see [State]).
+const StateVersion = 1
+
+// Cgroup manager types, as used in [State].
+const (
+	ManagerTypeFs            = "fs"             // cgroup v1, fs
+	ManagerTypeFs2           = "fs2"            // cgroup v2, fs
+	ManagerTypeSystemd       = "systemd"        // cgroup v2, systemd
+	ManagerTypeSystemdLegacy = "systemd-legacy" // cgroup v1, systemd
+)
+
+// State is the saved state of a cgroup manager, from which the manager
+// can be restored by [github.com/opencontainers/cgroups/manager.Restore],
+// e.g. after a process restart. It is serialized as a JSON object:
+//
+//	{
+//	  "version": 1,
+//	  "type": "systemd",
+//	  "unit": "runc-test.scope",
+//	  "paths": {"": "/sys/fs/cgroup/system.slice/runc-test.scope"},
+//	  "config": {"name": "test", "parent": "system.slice", ...},
+//	  "attached": true
+//	}
+//
+// where version is the format version (see [StateVersion]), type is the
+// manager type (one of ManagerType* constants), unit is the systemd unit
+// name (systemd managers only), paths are the cgroup paths as returned by
+// [Manager.GetPaths], and config is the cgroup configuration as returned
+// by [Manager.GetCgroups] (in the JSON encoding of [Cgroup], so resource
+// fields are inlined), including the last resources set, and the rootless
+// and owner settings. Note that [Cgroup.SystemdProps] are not
+// saved; use [Cgroup.SystemdProperties] instead. Attached is set for a
+// systemd manager of an existing unit (see
+// [github.com/opencontainers/cgroups/systemd.Attach]).
+//
+// Future versions of the format may add fields, which older readers
+// ignore. A state of a newer version than StateVersion is rejected.
+type State struct {
+	Version int               `json:"version"`
+	Type    string            `json:"type"`
+	Unit    string            `json:"unit,omitempty"`
+	Paths   map[string]string `json:"paths"`
+	Config  *Cgroup           `json:"config"`
+	// Attached tells that Apply must not start the unit, but only add
+	// the process to its cgroup.
+	Attached bool `json:"attached,omitempty"`
+}
+
+// MarshalState returns the serialized state st of a cgroup manager, with
+// the version set to StateVersion, to be used by MarshalState methods of
+// cgroup managers.
+func MarshalState(st State) ([]byte, error) {
+	st.Version = StateVersion
+	return json.Marshal(&st)
+}
+
+// UnmarshalState parses the state of a cgroup manager, as returned by
+// MarshalState, and checks its version and required fields.
+func UnmarshalState(data []byte) (*State, error) {
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid cgroup manager state: %w", err)
+	}
+	switch {
+	case st.Version <= 0:
+		return nil, errors.New("invalid cgroup manager state: no version")
+	case st.Version > StateVersion:
+		return nil, fmt.Errorf("unsupported cgroup manager state version %d (newest supported is %d)", st.Version, StateVersion)
+	case st.Type == "":
+		return nil, errors.New("invalid cgroup manager state: no type")
+	case st.Config == nil:
+		return nil, errors.New("invalid cgroup manager state: no config")
+	}
+	return &st, nil
+}
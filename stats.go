@@ -106,6 +106,15 @@ type MemoryStats struct {
 	KernelUsage MemoryData `json:"kernel_usage,omitempty"`
 	// usage of kernel TCP memory
 	KernelTCPUsage MemoryData `json:"kernel_tcp_usage,omitempty"`
+	// zswap statistics from memory.stat (cgroup v2 only): memory used
+	// by the compressed pool, size of the pages stored in it (in bytes),
+	// and the number of pages loaded from, stored to, and written back
+	// from zswap.
+	Zswap    uint64 `json:"zswap,omitempty"`
+	Zswapped uint64 `json:"zswapped,omitempty"`
+	Zswpin   uint64 `json:"zswpin,omitempty"`
+	Zswpout  uint64 `json:"zswpout,omitempty"`
+	Zswpwb   uint64 `json:"zswpwb,omitempty"`
 	// usage of memory pages by NUMA node
 	// see chapter 5.6 of memory controller documentation
 	PageUsageByNUMA PageUsageByNUMA `json:"page_usage_by_numa,omitempty"`
@@ -159,17 +168,38 @@ type BlkioStats struct {
 	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive,omitempty"`
 	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive,omitempty"`
 	PSI                     *PSIStats        `json:"psi,omitempty"`
+
+	// io.latency statistics (cgroup v2 only): the average IO latency
+	// (Op "AvgLat", in microseconds) and the sampling window (Op "Win",
+	// in milliseconds), for devices with a latency target set.
+	IoLatencyRecursive []BlkioStatEntry `json:"io_latency_recursive,omitempty"`
 }
 
 type HugetlbStats struct {
 	// current res_counter usage for hugetlb
+	// (reservation usage if supported by the kernel, otherwise fault usage).
 	Usage uint64 `json:"usage,omitempty"`
 	// maximum usage ever recorded.
 	MaxUsage uint64 `json:"max_usage,omitempty"`
 	// number of times hugetlb usage allocation failure.
 	Failcnt uint64 `json:"failcnt"`
-}
 
+	// page fault counters (hugetlb.<size>.*).
+	FaultUsage    uint64 `json:"fault_usage,omitempty"`
+	FaultMaxUsage uint64 `json:"fault_max_usage,omitempty"`
+	FaultFailcnt  uint64 `json:"fault_failcnt,omitempty"`
+	// reservation counters (hugetlb.<size>.rsvd.*), if supported by the
+	// kernel. Note that cgroup v2 has no max usage counters, and no
+	// reservation failure counter.
+	RsvdUsage    uint64 `json:"rsvd_usage,omitempty"`
+	RsvdMaxUsage uint64 `json:"rsvd_max_usage,omitempty"`
+	RsvdFailcnt  uint64 `json:"rsvd_failcnt,omitempty"`
+	// usage of hugepages by NUMA node (cgroup v2 only, nil if not available).
+	NumaStat *PageStats `json:"numa_stat,omitempty"`
+}
+
+// RdmaEntry is an rdma.max or rdma.current entry. An unlimited ("max")
+// value is represented by [RdmaUnlimited].
 type RdmaEntry struct {
 	Device     string `json:"device,omitempty"`
 	HcaHandles uint32 `json:"hca_handles,omitempty"`
@@ -0,0 +1,162 @@
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fs2"
+)
+
+// Manager is the interface implemented by both [*UnifiedManager] and
+// [*LegacyManager].
+type Manager interface {
+	cgroups.Manager
+
+	// Plan returns the changes Set would make to apply r, without
+	// changing anything (see [UnifiedManager.Plan]).
+	Plan(r *cgroups.Resources) ([]cgroups.Operation, error)
+	// GetUnitResources returns the current resources of the unit.
+	GetUnitResources() (*cgroups.Resources, error)
+	// SetJobTimeout sets the time to wait for systemd jobs.
+	SetJobTimeout(timeout time.Duration)
+	// MarshalState returns the serialized state of the manager.
+	MarshalState() ([]byte, error)
+	// Close releases the systemd connection used by the manager.
+	Close() error
+}
+
+// Attach returns a cgroup manager for an existing systemd unit (a scope,
+// a service, or a slice), for example the one created by an earlier
+// instance of the program. The unit's slice, cgroup path and current
+// resources (see [UnifiedManager.GetUnitResources]) are obtained from
+// systemd; neither the unit nor its cgroup is modified. If rootless is
+// set, the user instance of systemd is used.
+//
+// The returned manager is a [*UnifiedManager] or a [*LegacyManager],
+// depending on the cgroup version in use. Its Apply method does not
+// start the unit, but merely adds the process to the unit's cgroup.
+// Use Close to release the manager's systemd connection.
+func Attach(unitName string, rootless bool) (Manager, error) {
+	return attach(newDbusConnManager(rootless), unitName, rootless, unitCgroupPaths)
+}
+
+// attach is the implementation of Attach. The cgroupPaths function
+// converts the unit's cgroup path (as reported by systemd) to cgroupfs
+// paths, in the format of [cgroups.Manager.GetPaths]. The cm reference
+// is released on error (closing it more than once is harmless).
+func attach(cm *dbusConnManager, unitName string, rootless bool, cgroupPaths func(string) (map[string]string, error)) (_ Manager, Err error) {
+	defer func() {
+		if Err != nil {
+			cm.close()
+		}
+	}()
+
+	config, err := attachConfig(unitName)
+	if err != nil {
+		return nil, err
+	}
+	config.Rootless = rootless
+
+	state, err := getUnitTypeProperty(cm, unitName, "Unit", "ActiveState")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get unit %s state: %w", unitName, err)
+	}
+	var activeState string
+	if err := state.Value.Store(&activeState); err != nil {
+		return nil, fmt.Errorf("unable to get unit %s state: %w", unitName, err)
+	}
+	if activeState != "active" && activeState != "reloading" {
+		return nil, fmt.Errorf("unit %s is not active (state: %s)", unitName, activeState)
+	}
+
+	var cgPath string
+	cg, err := getUnitTypeProperty(cm, unitName, getUnitType(unitName), "ControlGroup")
+	if err == nil {
+		err = cg.Value.Store(&cgPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get unit %s cgroup: %w", unitName, err)
+	}
+	if cgPath == "" {
+		return nil, fmt.Errorf("unit %s has no cgroup", unitName)
+	}
+
+	slice, err := getUnitTypeProperty(cm, unitName, "Unit", "Slice")
+	if err == nil {
+		err = slice.Value.Store(&config.Parent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get unit %s slice: %w", unitName, err)
+	}
+
+	paths, err := cgroupPaths(cgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if path, ok := paths[""]; ok && len(paths) == 1 {
+		m, err := newUnifiedManager(config, path, cm, fs2.UnifiedMountpoint)
+		if err != nil {
+			return nil, err
+		}
+		m.attached = true
+		config.Resources, err = m.GetUnitResources()
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	m, err := newLegacyManager(config, paths, cm)
+	if err != nil {
+		return nil, err
+	}
+	m.attached = true
+	config.Resources, err = m.GetUnitResources()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// attachConfig returns the cgroup configuration for which getUnitName
+// returns unitName.
+func attachConfig(unitName string) (*cgroups.Cgroup, error) {
+	if strings.HasSuffix(unitName, ".slice") {
+		return &cgroups.Cgroup{Name: unitName}, nil
+	}
+	var service *cgroups.Service
+	name, ok := strings.CutSuffix(unitName, ".scope")
+	if !ok {
+		name, ok = strings.CutSuffix(unitName, ".service")
+		if !ok {
+			return nil, fmt.Errorf("unit %s is not a scope, a service, or a slice", unitName)
+		}
+		// The service is already running, so its settings are not needed.
+		service = &cgroups.Service{}
+	}
+	prefix, name, ok := strings.Cut(name, "-")
+	if !ok || prefix == "" || name == "" {
+		return nil, fmt.Errorf("unit name %s is not in the form PREFIX-NAME.TYPE", unitName)
+	}
+	return &cgroups.Cgroup{ScopePrefix: prefix, Name: name, Service: service}, nil
+}
+
+// unitCgroupPaths returns the host's cgroupfs paths of a unit's cgroup,
+// given its path relative to the cgroup root.
+func unitCgroupPaths(cgPath string) (map[string]string, error) {
+	if cgroups.IsCgroup2UnifiedMode() {
+		path, err := securejoin.SecureJoin(fs2.UnifiedMountpoint, cgPath)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"": path}, nil
+	}
+	slice, unit := filepath.Split(cgPath)
+	return subsystemPaths(slice, unit)
+}
@@ -0,0 +1,165 @@
+package systemd
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+func TestAttachConfig(t *testing.T) {
+	for _, name := range []string{"runc-abc.scope", "cri-containerd-abc-def.scope", "kubepods-besteffort.slice", "app-web.service"} {
+		c, err := attachConfig(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := getUnitName(c); got != name {
+			t.Errorf("%s: unit name round trip mismatch: %s", name, got)
+		}
+	}
+	for _, name := range []string{"abc.scope", "-abc.scope", "abc-.scope", "abc.service", "abc-def.socket"} {
+		if _, err := attachConfig(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAttachUnified(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+	paths := func(cgPath string) (map[string]string, error) {
+		return map[string]string{"": fake.CgroupDir("", cgPath)}, nil
+	}
+
+	// Nothing to attach to yet.
+	if _, err := attach(newBackendConnManager(fake), "test-attach.scope", false, paths); err == nil {
+		t.Fatal("expected an error attaching to a non-existent unit")
+	}
+
+	config := &cgroups.Cgroup{
+		Parent:      "system-test.slice",
+		ScopePrefix: "test",
+		Name:        "attach",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	path := fake.CgroupDir("", "/system.slice/system-test.slice/"+unit)
+	orig, err := NewUnifiedManagerWithBackend(config, path, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orig.Apply(1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := orig.Set(&cgroups.Resources{PidsLimit: 20, CpuWeight: 50}); err != nil {
+		t.Fatal(err)
+	}
+	orig.Close()
+
+	m, err := attach(newBackendConnManager(fake), unit, false, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	um, ok := m.(*UnifiedManager)
+	if !ok {
+		t.Fatalf("expected *UnifiedManager, got %T", m)
+	}
+	if um.Path("") != path {
+		t.Errorf("expected path %q, got %q", path, um.Path(""))
+	}
+	c, err := m.GetCgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Parent != "system-test.slice" || getUnitName(c) != unit {
+		t.Errorf("unexpected config: parent %q, unit %q", c.Parent, getUnitName(c))
+	}
+	if c.Resources.PidsLimit != 20 || c.Resources.CpuWeight != 50 {
+		t.Errorf("expected current resources, got %+v", c.Resources)
+	}
+
+	// Apply adds a process without restarting the unit.
+	if err := m.Apply(2000); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFakeFile(t, path, "cgroup.procs"); got != "2000" {
+		t.Errorf("expected pid 2000 in cgroup.procs, got %q", got)
+	}
+	if _, ok := fake.Unit(unit); !ok {
+		t.Errorf("unit %s is gone after Apply", unit)
+	}
+
+	if err := m.Set(&cgroups.Resources{PidsLimit: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFakeFile(t, path, "pids.max"); got != "30" {
+		t.Errorf("pids.max: expected 30, got %q", got)
+	}
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Unit(unit); ok {
+		t.Errorf("unit %s still exists after Destroy", unit)
+	}
+}
+
+func TestAttachLegacy(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.NewLegacy(t.TempDir())
+	controllers := []string{"cpu", "devices", "freezer", "memory", "pids"}
+	paths := func(cgPath string) (map[string]string, error) {
+		paths := make(map[string]string)
+		for _, c := range controllers {
+			paths[c] = fake.CgroupDir(c, cgPath)
+		}
+		return paths, nil
+	}
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "attach",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	p, _ := paths(filepath.Join("/system.slice", unit))
+	orig, err := NewLegacyManagerWithBackend(config, p, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orig.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := orig.Set(&cgroups.Resources{CpuShares: 256, SkipDevices: true}); err != nil {
+		t.Fatal(err)
+	}
+	orig.Close()
+
+	m, err := attach(newBackendConnManager(fake), unit, false, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, ok := m.(*LegacyManager); !ok {
+		t.Fatalf("expected *LegacyManager, got %T", m)
+	}
+	if !maps.Equal(m.GetPaths(), p) {
+		t.Errorf("expected paths %v, got %v", p, m.GetPaths())
+	}
+	c, err := m.GetCgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Parent != "system.slice" || c.Resources.CpuShares != 256 {
+		t.Errorf("unexpected config: parent %q, resources %+v", c.Parent, c.Resources)
+	}
+	if err := m.Apply(3000); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFakeFile(t, p["pids"], "cgroup.procs"); got != "3000" {
+		t.Errorf("expected pid 3000 in cgroup.procs, got %q", got)
+	}
+}
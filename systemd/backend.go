@@ -0,0 +1,84 @@
+package systemd
+
+import (
+	"context"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+
+	"github.com/opencontainers/cgroups/fs2"
+)
+
+// Backend is the set of systemd D-Bus operations used by the managers in
+// this package. The default implementation uses a D-Bus connection to
+// systemd; an in-memory fake suitable for tests is provided by
+// [github.com/opencontainers/cgroups/systemd/systemdtest].
+//
+// The methods have the same semantics as the corresponding methods of
+// [systemdDbus.Conn] (those with the Context suffix).
+//
+// A backend whose units live in a cgroup v2 hierarchy mounted somewhere
+// other than [fs2.UnifiedMountpoint] may also implement
+//
+//	CgroupRoot() string
+//
+// returning that mountpoint.
+type Backend interface {
+	StartTransientUnit(ctx context.Context, name, mode string, properties []systemdDbus.Property, ch chan<- string) (int, error)
+	StopUnit(ctx context.Context, name, mode string, ch chan<- string) (int, error)
+	SetUnitProperties(ctx context.Context, name string, runtime bool, properties ...systemdDbus.Property) error
+	GetUnitTypeProperty(ctx context.Context, unit, unitType, propertyName string) (*systemdDbus.Property, error)
+	ResetFailedUnit(ctx context.Context, name string) error
+	// GetManagerProperty returns the value of a property of the
+	// systemd manager object, formatted as a D-Bus variant (so
+	// strings are quoted).
+	GetManagerProperty(prop string) (string, error)
+	// Close is called once the backend is no longer used, or when
+	// an operation returned an error wrapping [dbus.ErrClosed].
+	Close()
+}
+
+// cgroupRootBackend is the optional interface described in [Backend].
+type cgroupRootBackend interface {
+	CgroupRoot() string
+}
+
+// cgroupRoot returns the cgroup v2 mountpoint used by b.
+func cgroupRoot(b Backend) string {
+	if rb, ok := b.(cgroupRootBackend); ok {
+		return rb.CgroupRoot()
+	}
+	return fs2.UnifiedMountpoint
+}
+
+// dbusBackend is a Backend using a D-Bus connection to systemd.
+type dbusBackend struct {
+	conn *systemdDbus.Conn
+}
+
+func (b *dbusBackend) StartTransientUnit(ctx context.Context, name, mode string, properties []systemdDbus.Property, ch chan<- string) (int, error) {
+	return b.conn.StartTransientUnitContext(ctx, name, mode, properties, ch)
+}
+
+func (b *dbusBackend) StopUnit(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return b.conn.StopUnitContext(ctx, name, mode, ch)
+}
+
+func (b *dbusBackend) SetUnitProperties(ctx context.Context, name string, runtime bool, properties ...systemdDbus.Property) error {
+	return b.conn.SetUnitPropertiesContext(ctx, name, runtime, properties...)
+}
+
+func (b *dbusBackend) GetUnitTypeProperty(ctx context.Context, unit, unitType, propertyName string) (*systemdDbus.Property, error) {
+	return b.conn.GetUnitTypePropertyContext(ctx, unit, unitType, propertyName)
+}
+
+func (b *dbusBackend) ResetFailedUnit(ctx context.Context, name string) error {
+	return b.conn.ResetFailedUnitContext(ctx, name)
+}
+
+func (b *dbusBackend) GetManagerProperty(prop string) (string, error) {
+	return b.conn.GetManagerProperty(prop)
+}
+
+func (b *dbusBackend) Close() {
+	b.conn.Close()
+}
@@ -0,0 +1,478 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+// setTestMode enables the fake cgroupfs mode for the duration of the test.
+func setTestMode(t *testing.T) {
+	t.Helper()
+	cgroups.TestMode = true
+	t.Cleanup(func() { cgroups.TestMode = false })
+}
+
+func readFakeFile(t *testing.T, dir, file string) string {
+	t.Helper()
+	data, err := cgroups.ReadFile(dir, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(data)
+}
+
+func TestUnifiedManagerWithFakeBackend(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		Parent:      "system-test.slice",
+		ScopePrefix: "test",
+		Name:        "fake",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	path := fake.CgroupDir("", "/system.slice/system-test.slice/"+unit)
+	m, err := NewUnifiedManagerWithBackend(config, path, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Apply(1234); err != nil {
+		t.Fatal(err)
+	}
+	u, ok := fake.Unit(unit)
+	if !ok {
+		t.Fatalf("unit %s not started", unit)
+	}
+	if u.Path != "/system.slice/system-test.slice/"+unit {
+		t.Errorf("unexpected unit cgroup path %q", u.Path)
+	}
+	if procs := readFakeFile(t, path, "cgroup.procs"); procs != "1234" {
+		t.Errorf("expected pid 1234 in cgroup.procs, got %q", procs)
+	}
+
+	// Applying again to an existing unit fails.
+	if err := m.Apply(1234); err == nil {
+		t.Error("expected Apply to fail for an existing unit")
+	}
+
+	quota := int64(50000)
+	r := &cgroups.Resources{
+		Memory:    256 * 1024 * 1024,
+		PidsLimit: 100,
+		CpuWeight: 500,
+		CpuQuota:  quota,
+		CpuPeriod: 100000,
+	}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = fake.Unit(unit)
+	for _, prop := range []string{"MemoryMax", "TasksMax", "CPUWeight", "CPUQuotaPerSecUSec"} {
+		if _, ok := u.Properties[prop]; !ok {
+			t.Errorf("expected unit property %s to be set", prop)
+		}
+	}
+	for file, want := range map[string]string{
+		"memory.max": "268435456",
+		"pids.max":   "100",
+		"cpu.weight": "500",
+		"cpu.max":    "50000 100000",
+	} {
+		if got := readFakeFile(t, path, file); got != want {
+			t.Errorf("%s: expected %q, got %q", file, want, got)
+		}
+	}
+
+	// Unit properties can not be rolled back.
+	r.RollbackOnError = true
+	var ue *cgroups.UnsupportedError
+	if err := m.Set(r); !errors.As(err, &ue) || ue.Field != "RollbackOnError" || ue.Manager != cgroups.ManagerTypeSystemd {
+		t.Errorf("expected UnsupportedError for RollbackOnError, got %v", err)
+	}
+
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Unit(unit); ok {
+		t.Errorf("unit %s still exists after Destroy", unit)
+	}
+	if m.Exists() {
+		t.Errorf("cgroup %s still exists after Destroy", path)
+	}
+}
+
+func TestUnifiedManagerPlan(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "plan",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	path := fake.CgroupDir("", "/system.slice/"+unit)
+	m, err := NewUnifiedManagerWithBackend(config, path, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := fake.Unit(unit)
+	files := map[string]string{"pids.max": "max\n", "cpu.weight": "100\n"}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ops, err := m.Plan(&cgroups.Resources{
+		PidsLimit: 100,
+		CpuWeight: 500,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var props, writes []string
+	for _, op := range ops {
+		if op.Unit != "" {
+			if op.Unit != unit {
+				t.Errorf("unexpected unit in %v", op)
+			}
+			props = append(props, op.Property+"="+op.New)
+		} else {
+			writes = append(writes, op.File+"="+op.Old+"->"+op.New)
+		}
+	}
+	if expected := []string{"CPUWeight=@t 500", "TasksMax=@t 100"}; !reflect.DeepEqual(props, expected) {
+		t.Errorf("expected properties %v, got %v", expected, props)
+	}
+	if expected := []string{"pids.max=max->100", "cpu.weight=100->500"}; !reflect.DeepEqual(writes, expected) {
+		t.Errorf("expected file writes %v, got %v", expected, writes)
+	}
+
+	// Nothing is changed.
+	after, _ := fake.Unit(unit)
+	if !reflect.DeepEqual(before.Properties, after.Properties) {
+		t.Errorf("unit properties changed: %v -> %v", before.Properties, after.Properties)
+	}
+	for name, data := range files {
+		if got, err := cgroups.ReadFile(path, name); err != nil || got != data {
+			t.Errorf("%s: expected %q, got %q (error: %v)", name, data, got, err)
+		}
+	}
+}
+
+func TestLegacyManagerWithFakeBackend(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.NewLegacy(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "fake",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	paths := make(map[string]string)
+	for _, c := range []string{"cpu", "devices", "freezer", "memory", "pids"} {
+		paths[c] = fake.CgroupDir(c, filepath.Join("system.slice", unit))
+	}
+	m, err := NewLegacyManagerWithBackend(config, paths, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Unit(unit); !ok {
+		t.Fatalf("unit %s not started", unit)
+	}
+
+	r := &cgroups.Resources{
+		CpuShares:   512,
+		PidsLimit:   50,
+		SkipDevices: true,
+	}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	for c, want := range map[string]string{"cpu": "512", "pids": "50"} {
+		file := map[string]string{"cpu": "cpu.shares", "pids": "pids.max"}[c]
+		if got := readFakeFile(t, paths[c], file); got != want {
+			t.Errorf("%s: expected %q, got %q", file, want, got)
+		}
+	}
+	if st, err := m.GetFreezerState(); err != nil || st != cgroups.Thawed {
+		t.Errorf("expected container to be thawed after Set, got %v (error: %v)", st, err)
+	}
+
+	// Unit properties can not be rolled back.
+	r.RollbackOnError = true
+	var ue *cgroups.UnsupportedError
+	if err := m.Set(r); !errors.As(err, &ue) || ue.Field != "RollbackOnError" || ue.Manager != cgroups.ManagerTypeSystemdLegacy {
+		t.Errorf("expected UnsupportedError for RollbackOnError, got %v", err)
+	}
+
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Unit(unit); ok {
+		t.Errorf("unit %s still exists after Destroy", unit)
+	}
+}
+
+func TestLegacyManagerPlan(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.NewLegacy(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "plan",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	paths := make(map[string]string)
+	for _, c := range []string{"cpu", "pids"} {
+		paths[c] = fake.CgroupDir(c, filepath.Join("system.slice", unit))
+	}
+	m, err := NewLegacyManagerWithBackend(config, paths, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := fake.Unit(unit)
+	files := map[string]string{"cpu": "cpu.shares", "pids": "pids.max"}
+	data := map[string]string{"cpu": "1024\n", "pids": "max\n"}
+	for c, name := range files {
+		if err := os.WriteFile(filepath.Join(paths[c], name), []byte(data[c]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ops, err := m.Plan(&cgroups.Resources{
+		CpuShares:   512,
+		PidsLimit:   100,
+		SkipDevices: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var props, writes []string
+	for _, op := range ops {
+		if op.Unit != "" {
+			if op.Unit != unit {
+				t.Errorf("unexpected unit in %v", op)
+			}
+			props = append(props, op.Property+"="+op.New)
+		} else {
+			writes = append(writes, op.File+"="+op.Old+"->"+op.New)
+		}
+	}
+	if expected := []string{"CPUShares=@t 512", "TasksMax=@t 100"}; !reflect.DeepEqual(props, expected) {
+		t.Errorf("expected properties %v, got %v", expected, props)
+	}
+	if expected := []string{"cpu.shares=1024->512", "pids.max=max->100"}; !reflect.DeepEqual(writes, expected) {
+		t.Errorf("expected file writes %v, got %v", expected, writes)
+	}
+
+	// Nothing is changed.
+	after, _ := fake.Unit(unit)
+	if !reflect.DeepEqual(before.Properties, after.Properties) {
+		t.Errorf("unit properties changed: %v -> %v", before.Properties, after.Properties)
+	}
+	for c, name := range files {
+		if got, err := cgroups.ReadFile(paths[c], name); err != nil || got != data[c] {
+			t.Errorf("%s: expected %q, got %q (error: %v)", name, data[c], got, err)
+		}
+	}
+}
+
+func TestStartUnitJobError(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	for _, tc := range []struct {
+		name, result string
+		timeout      bool
+	}{
+		{name: "failed", result: "failed"},
+		{name: "dependency", result: "dependency"},
+		{name: "systemd-timeout", result: "timeout", timeout: true},
+		{name: "timeout", result: "", timeout: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &cgroups.Cgroup{
+				ScopePrefix: "test",
+				Name:        "job-" + tc.name,
+				Resources:   &cgroups.Resources{},
+			}
+			unit := getUnitName(config)
+			fake.StartJobResults = map[string]string{unit: tc.result}
+			m, err := NewUnifiedManagerWithBackend(config, fake.CgroupDir("", "/system.slice/"+unit), fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			m.SetJobTimeout(10 * time.Millisecond)
+
+			err = m.Apply(-1)
+			var jobErr *JobError
+			if !errors.As(err, &jobErr) {
+				t.Fatalf("expected *JobError, got %v", err)
+			}
+			if jobErr.Unit != unit || jobErr.Job != "start" || jobErr.Result != tc.result {
+				t.Errorf("unexpected error fields: %+v", jobErr)
+			}
+			if jobErr.Timeout() != tc.timeout {
+				t.Errorf("expected Timeout() to be %v", tc.timeout)
+			}
+			if jobErr.ActiveState != "failed" || jobErr.SubState != "failed" || jobErr.UnitResult != "resources" {
+				t.Errorf("expected unit state in error, got %+v", jobErr)
+			}
+			// The failed unit is reset.
+			if _, ok := fake.Unit(unit); ok {
+				t.Errorf("failed unit %s was not reset", unit)
+			}
+		})
+	}
+}
+
+func TestUnifiedManagerService(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "svc",
+		Resources:   &cgroups.Resources{},
+		Service: &cgroups.Service{
+			ExecStart:   []string{"/bin/sleep", "sleep", "infinity"},
+			Restart:     "on-failure",
+			Environment: []string{"FOO=bar"},
+			User:        "nobody",
+		},
+	}
+	unit := getUnitName(config)
+	if unit != "test-svc.service" {
+		t.Fatalf("unexpected unit name %q", unit)
+	}
+	path := fake.CgroupDir("", "/system.slice/"+unit)
+	m, err := NewUnifiedManagerWithBackend(config, path, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// The process is added to the service's cgroup.
+	if err := m.Apply(4321); err != nil {
+		t.Fatal(err)
+	}
+	u, ok := fake.Unit(unit)
+	if !ok {
+		t.Fatalf("unit %s not started", unit)
+	}
+	if _, ok := u.Properties["PIDs"]; ok {
+		t.Error("unexpected PIDs property for a service")
+	}
+	if procs := readFakeFile(t, path, "cgroup.procs"); procs != "4321" {
+		t.Errorf("expected pid 4321 in cgroup.procs, got %q", procs)
+	}
+	var exec []execStart
+	if err := u.Properties["ExecStart"].Store(&exec); err != nil {
+		t.Fatal(err)
+	}
+	if len(exec) != 1 || exec[0].Path != "/bin/sleep" || len(exec[0].Args) != 3 {
+		t.Errorf("unexpected ExecStart %+v", exec)
+	}
+	for prop, want := range map[string]any{
+		"Restart":     "on-failure",
+		"Environment": []string{"FOO=bar"},
+		"User":        "nobody",
+	} {
+		if got := u.Properties[prop].Value(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", prop, want, got)
+		}
+	}
+
+	// Resources are applied to the service's cgroup.
+	if err := m.Set(&cgroups.Resources{PidsLimit: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFakeFile(t, path, "pids.max"); got != "10" {
+		t.Errorf("pids.max: expected 10, got %q", got)
+	}
+
+	// The service can't be started twice.
+	if err := m.Apply(-1); err == nil {
+		t.Error("expected an error starting an existing service")
+	}
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Service.ExecStart = nil
+	if err := m.Apply(-1); err == nil {
+		t.Error("expected an error for a service with no ExecStart")
+	}
+
+	config.Service.ExecStart = []string{"/bin/true"}
+	config.Name = "svc.slice"
+	if err := m.Apply(-1); err == nil || !strings.Contains(err.Error(), "can't be a slice") {
+		t.Errorf("expected an error for a service named as a slice, got %v", err)
+	}
+}
+
+// closedBackend is a Backend whose connection is always closed.
+type closedBackend struct {
+	*systemdtest.Fake
+	closed int
+}
+
+func (b *closedBackend) ResetFailedUnit(context.Context, string) error {
+	return dbus.ErrClosed
+}
+
+func (b *closedBackend) Close() {
+	b.closed++
+}
+
+func TestBackendClosed(t *testing.T) {
+	b := &closedBackend{Fake: systemdtest.New(t.TempDir())}
+	cm := newBackendConnManager(b)
+	defer cm.close()
+
+	done := make(chan error, 1)
+	go func() { done <- resetFailedUnit(cm, "test.scope") }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, dbus.ErrClosed) {
+			t.Errorf("expected an error wrapping dbus.ErrClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retrying on a closed backend did not stop")
+	}
+	if b.closed != 1 {
+		t.Errorf("expected the backend to be closed once, got %d", b.closed)
+	}
+}
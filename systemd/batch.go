@@ -0,0 +1,71 @@
+package systemd
+
+import (
+	"sync"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// defBatchParallelism is the default number of managers SetBatch
+// updates concurrently.
+const defBatchParallelism = 16
+
+// Update is a request to set resources of a cgroup manager, used by
+// SetBatch.
+type Update struct {
+	Manager   cgroups.Manager
+	Resources *cgroups.Resources
+}
+
+// SetBatch calls Set for each of the updates. Unlike calling Set in a
+// loop, up to parallelism managers (or a default number, if parallelism
+// is not positive) are updated concurrently, so the systemd D-Bus calls
+// are pipelined over the connection, and cgroupfs writes are done in
+// parallel. Updates for the same manager are applied one after another,
+// in the order given.
+//
+// The returned slice has an error (or nil, on success) for every update.
+func SetBatch(updates []Update, parallelism int) []error {
+	errs := make([]error, len(updates))
+	if len(updates) == 0 {
+		return errs
+	}
+	if parallelism <= 0 {
+		parallelism = defBatchParallelism
+	}
+
+	// Group the updates by manager, keeping the order.
+	var groups [][]int
+	seen := make(map[cgroups.Manager]int)
+	for i, u := range updates {
+		g, ok := seen[u.Manager]
+		if !ok {
+			g = len(groups)
+			seen[u.Manager] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	parallelism = min(parallelism, len(groups))
+
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for range parallelism {
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				for _, i := range group {
+					errs[i] = updates[i].Manager.Set(updates[i].Resources)
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		work <- group
+	}
+	close(work)
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,83 @@
+package systemd
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+func TestSetBatch(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	const n = 50
+	managers := make([]*UnifiedManager, n)
+	paths := make([]string, n)
+	for i := range managers {
+		config := &cgroups.Cgroup{
+			ScopePrefix: "test",
+			Name:        fmt.Sprintf("batch%d", i),
+			Resources:   &cgroups.Resources{},
+		}
+		paths[i] = fake.CgroupDir("", "/system.slice/"+getUnitName(config))
+		m, err := NewUnifiedManagerWithBackend(config, paths[i], fake)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+		if err := m.Apply(-1); err != nil {
+			t.Fatal(err)
+		}
+		managers[i] = m
+	}
+
+	var updates []Update
+	for i, m := range managers {
+		updates = append(updates, Update{
+			Manager:   m,
+			Resources: &cgroups.Resources{PidsLimit: int64(100 + i)},
+		})
+	}
+	// The second update of the same manager wins.
+	updates = append(updates, Update{
+		Manager:   managers[0],
+		Resources: &cgroups.Resources{PidsLimit: 7},
+	})
+	// An invalid update only fails for its manager.
+	updates = append(updates, Update{
+		Manager:   managers[1],
+		Resources: &cgroups.Resources{Unified: map[string]string{"pids/max": "1"}},
+	})
+
+	errs := SetBatch(updates, 8)
+	if len(errs) != len(updates) {
+		t.Fatalf("expected %d errors, got %d", len(updates), len(errs))
+	}
+	for i, err := range errs {
+		if i == len(errs)-1 {
+			if err == nil {
+				t.Error("expected an error for an invalid update")
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("update %d: %v", i, err)
+		}
+	}
+	for i, path := range paths {
+		want := strconv.Itoa(100 + i)
+		if i == 0 {
+			want = "7"
+		}
+		if got := readFakeFile(t, path, "pids.max"); got != want {
+			t.Errorf("manager %d: pids.max: expected %s, got %s", i, want, got)
+		}
+	}
+
+	if errs := SetBatch(nil, 0); len(errs) != 0 {
+		t.Errorf("expected no errors for an empty batch, got %v", errs)
+	}
+}
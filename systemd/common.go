@@ -23,12 +23,13 @@ const (
 	// v1: https://www.kernel.org/doc/html/latest/scheduler/sched-bwc.html and
 	// v2: https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
 	defCPUQuotaPeriod = uint64(100000)
+
+	// defJobTimeout is the default time to wait for a systemd job
+	// (to start or stop a unit) to complete.
+	defJobTimeout = 30 * time.Second
 )
 
 var (
-	versionOnce sync.Once
-	version     int
-
 	isRunningSystemdOnce sync.Once
 	isRunningSystemd     bool
 
@@ -38,6 +39,14 @@ var (
 	// package is imported, it is set to nil, so cgroup managers can't
 	// configure devices.
 	GenerateDeviceProps func(r *cgroups.Resources, sdVer int) ([]systemdDbus.Property, error)
+
+	// DevicesUnchangedV1 is a function to check whether the cgroup v1
+	// devices controller at path already has the device rules from r,
+	// used by [LegacyManager.Set] to avoid a disruptive update of the
+	// unit's device properties. Unless
+	// [github.com/opencontainers/cgroups/devices] package is imported,
+	// it is set to nil, and the device properties are always updated.
+	DevicesUnchangedV1 func(path string, r *cgroups.Resources) (bool, error)
 )
 
 // NOTE: This function comes from package github.com/coreos/go-systemd/util
@@ -97,6 +106,9 @@ func newProp(name string, units any) systemdDbus.Property {
 }
 
 func getUnitName(c *cgroups.Cgroup) string {
+	if c.Service != nil {
+		return c.ScopePrefix + "-" + c.Name + ".service"
+	}
 	// by default, we create a scope unless the user explicitly asks for a slice.
 	if !strings.HasSuffix(c.Name, ".slice") {
 		return c.ScopePrefix + "-" + c.Name + ".scope"
@@ -109,9 +121,53 @@ func getUnitType(unitName string) string {
 	if strings.HasSuffix(unitName, ".slice") {
 		return "Slice"
 	}
+	if strings.HasSuffix(unitName, ".service") {
+		return "Service"
+	}
 	return "Scope"
 }
 
+// addServiceProperties adds the properties of a transient service unit
+// running the process described by c.Service.
+func addServiceProperties(props *[]systemdDbus.Property, c *cgroups.Cgroup) error {
+	s := c.Service
+	if strings.HasSuffix(c.Name, ".slice") {
+		return fmt.Errorf("invalid name %q: a service can't be a slice", c.Name)
+	}
+	if len(s.ExecStart) == 0 {
+		return errors.New("service ExecStart is empty")
+	}
+	*props = append(*props,
+		newProp("ExecStart", []execStart{{
+			Path:             s.ExecStart[0],
+			Args:             s.ExecStart,
+			UncleanIsFailure: true,
+		}}))
+	if s.Restart != "" {
+		*props = append(*props, newProp("Restart", s.Restart))
+	}
+	if len(s.Environment) > 0 {
+		*props = append(*props, newProp("Environment", s.Environment))
+	}
+	if s.User != "" {
+		*props = append(*props, newProp("User", s.User))
+	}
+	if s.Group != "" {
+		*props = append(*props, newProp("Group", s.Group))
+	}
+	if s.WorkingDirectory != "" {
+		*props = append(*props, newProp("WorkingDirectory", s.WorkingDirectory))
+	}
+	return nil
+}
+
+// execStart is the dbus type "a(sasb)" of ExecStart property element.
+type execStart struct {
+	Path             string   // the binary path to execute
+	Args             []string // an array with all arguments to pass to the executed command, starting with argument 0
+	UncleanIsFailure bool     // a boolean whether it should be considered a failure if the process exits uncleanly
+}
+
 // isDbusError returns true if the error is a specific dbus error.
 func isDbusError(err error, name string) bool {
 	if err != nil {
@@ -128,13 +184,73 @@ func isUnitExists(err error) bool {
 	return isDbusError(err, "org.freedesktop.systemd1.UnitExists")
 }
 
+// JobError is the error returned when a systemd job to start or stop a
+// unit does not complete successfully.
+type JobError struct {
+	Unit string
+	// Job is the job type, "start" or "stop".
+	Job string
+	// Result is the job result as reported by systemd, e.g. "canceled",
+	// "timeout", "failed", "dependency", or "skipped". It is empty if
+	// the job did not complete within the manager's job timeout.
+	Result string
+	// ActiveState, SubState and UnitResult describe the state of the
+	// unit after the failed job, if known.
+	ActiveState string
+	SubState    string
+	UnitResult  string
+}
+
+func (e *JobError) Error() string {
+	var msg string
+	if e.Result == "" {
+		msg = "timeout waiting for systemd to " + e.Job + " unit " + e.Unit
+	} else {
+		msg = "systemd job to " + e.Job + " unit " + e.Unit + " failed: " + e.Result
+	}
+	if e.ActiveState != "" {
+		msg += " (unit state: " + e.ActiveState + "/" + e.SubState
+		if e.UnitResult != "" {
+			msg += ", result: " + e.UnitResult
+		}
+		msg += ")"
+	}
+	return msg
+}
+
+// Timeout reports whether the job did not complete in time, either
+// within the manager's job timeout (Result is empty), or within the
+// unit's own timeout as enforced by systemd (Result is "timeout").
+func (e *JobError) Timeout() bool {
+	return e.Result == "" || e.Result == "timeout"
+}
+
+// newJobError returns a JobError for a failed job, including the
+// current state of the unit (which is queried on a best-effort basis).
+func newJobError(cm *dbusConnManager, unitName, job, result string) *JobError {
+	e := &JobError{Unit: unitName, Job: job, Result: result}
+	for _, p := range []struct {
+		unitType, name string
+		value          *string
+	}{
+		{"Unit", "ActiveState", &e.ActiveState},
+		{"Unit", "SubState", &e.SubState},
+		{getUnitType(unitName), "Result", &e.UnitResult},
+	} {
+		if prop, err := getUnitTypeProperty(cm, unitName, p.unitType, p.name); err == nil {
+			_ = prop.Value.Store(p.value)
+		}
+	}
+	return e
+}
+
 func startUnit(cm *dbusConnManager, unitName string, properties []systemdDbus.Property, ignoreExist bool) error {
 	statusChan := make(chan string, 1)
 	retry := true
 
 retry:
-	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
-		_, err := c.StartTransientUnitContext(context.TODO(), unitName, "replace", properties, statusChan)
+	err := cm.retryOnDisconnect(func(c Backend) error {
+		_, err := c.StartTransientUnit(context.TODO(), unitName, "replace", properties, statusChan)
 		return err
 	})
 	if err != nil {
@@ -161,7 +277,7 @@ retry:
 		return err
 	}
 
-	timeout := time.NewTimer(30 * time.Second)
+	timeout := time.NewTimer(cm.jobTimeout())
 	defer timeout.Stop()
 
 	select {
@@ -169,12 +285,14 @@ retry:
 		close(statusChan)
 		// Please refer to https://pkg.go.dev/github.com/coreos/go-systemd/v22/dbus#Conn.StartUnit
 		if s != "done" {
+			jobErr := newJobError(cm, unitName, "start", s)
 			_ = resetFailedUnit(cm, unitName)
-			return fmt.Errorf("error creating systemd unit `%s`: got `%s`", unitName, s)
+			return jobErr
 		}
 	case <-timeout.C:
+		jobErr := newJobError(cm, unitName, "start", "")
 		_ = resetFailedUnit(cm, unitName)
-		return errors.New("Timeout waiting for systemd to create " + unitName)
+		return jobErr
 	}
 
 	return nil
@@ -182,12 +300,12 @@ retry:
 
 func stopUnit(cm *dbusConnManager, unitName string) error {
 	statusChan := make(chan string, 1)
-	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
-		_, err := c.StopUnitContext(context.TODO(), unitName, "replace", statusChan)
+	err := cm.retryOnDisconnect(func(c Backend) error {
+		_, err := c.StopUnit(context.TODO(), unitName, "replace", statusChan)
 		return err
 	})
 	if err == nil {
-		timeout := time.NewTimer(30 * time.Second)
+		timeout := time.NewTimer(cm.jobTimeout())
 		defer timeout.Stop()
 
 		select {
@@ -198,7 +316,7 @@ func stopUnit(cm *dbusConnManager, unitName string) error {
 				logrus.Warnf("error removing unit `%s`: got `%s`. Continuing...", unitName, s)
 			}
 		case <-timeout.C:
-			return errors.New("Timed out while waiting for systemd to remove " + unitName)
+			return newJobError(cm, unitName, "stop", "")
 		}
 	}
 
@@ -209,29 +327,59 @@ func stopUnit(cm *dbusConnManager, unitName string) error {
 }
 
 func resetFailedUnit(cm *dbusConnManager, name string) error {
-	return cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
-		return c.ResetFailedUnitContext(context.TODO(), name)
+	return cm.retryOnDisconnect(func(c Backend) error {
+		return c.ResetFailedUnit(context.TODO(), name)
 	})
 }
 
 func getUnitTypeProperty(cm *dbusConnManager, unitName string, unitType string, propertyName string) (*systemdDbus.Property, error) {
 	var prop *systemdDbus.Property
-	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) (Err error) {
-		prop, Err = c.GetUnitTypePropertyContext(context.TODO(), unitName, unitType, propertyName)
+	err := cm.retryOnDisconnect(func(c Backend) (Err error) {
+		prop, Err = c.GetUnitTypeProperty(context.TODO(), unitName, unitType, propertyName)
 		return Err
 	})
 	return prop, err
 }
 
+// checkRollback returns an [*cgroups.UnsupportedError] of manager type
+// typ if r asks to roll back on error, as unit properties can not be
+// rolled back, and rolling back only the cgroup files would leave the
+// cgroup inconsistent.
+func checkRollback(r *cgroups.Resources, typ string) error {
+	if !r.RollbackOnError {
+		return nil
+	}
+	return &cgroups.UnsupportedError{
+		Manager: typ,
+		Field:   "RollbackOnError",
+		Reason:  "unit properties can not be rolled back",
+	}
+}
+
+// planProperties returns the operations setting the properties of the
+// unit, with the current values as the old ones (if they can be obtained).
+func planProperties(cm *dbusConnManager, unitName string, properties []systemdDbus.Property) []cgroups.Operation {
+	unitType := getUnitType(unitName)
+	ops := make([]cgroups.Operation, 0, len(properties))
+	for _, p := range properties {
+		op := cgroups.Operation{Unit: unitName, Property: p.Name, New: p.Value.String()}
+		if old, err := getUnitTypeProperty(cm, unitName, unitType, p.Name); err == nil {
+			op.Old = old.Value.String()
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
 func setUnitProperties(cm *dbusConnManager, name string, properties ...systemdDbus.Property) error {
-	return cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
-		return c.SetUnitPropertiesContext(context.TODO(), name, true, properties...)
+	return cm.retryOnDisconnect(func(c Backend) error {
+		return c.SetUnitProperties(context.TODO(), name, true, properties...)
 	})
 }
 
 func getManagerProperty(cm *dbusConnManager, name string) (string, error) {
 	str := ""
-	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
+	err := cm.retryOnDisconnect(func(c Backend) error {
 		var err error
 		str, err = c.GetManagerProperty(name)
 		return err
@@ -242,20 +390,10 @@ func getManagerProperty(cm *dbusConnManager, name string) (string, error) {
 	return strconv.Unquote(str)
 }
 
+// systemdVersion returns the version of systemd cm is connected to,
+// or -1 if it can not be determined.
 func systemdVersion(cm *dbusConnManager) int {
-	versionOnce.Do(func() {
-		version = -1
-		verStr, err := getManagerProperty(cm, "Version")
-		if err == nil {
-			version, err = systemdVersionAtoi(verStr)
-		}
-
-		if err != nil {
-			logrus.WithError(err).Error("unable to get systemd version")
-		}
-	})
-
-	return version
+	return cm.version()
 }
 
 // systemdVersionAtoi extracts a numeric systemd version from the argument.
@@ -58,3 +58,35 @@ func RangeToBits(str string) ([]byte, error) {
 	}
 	return ret, nil
 }
+
+// bitsToRange is the reverse of RangeToBits. It converts a slice of bytes
+// with CPU (or memory node) bits set, as returned by systemd as the value
+// of AllowedCPUs/AllowedMemoryNodes property, to a text representation
+// of a CPU mask (e.g. "1,3-5"). For no bits set, an empty string is
+// returned.
+func bitsToRange(bits []byte) string {
+	var (
+		ranges []string
+		start  = -1
+	)
+	flush := func(end int) {
+		switch {
+		case start == -1:
+			return
+		case start == end:
+			ranges = append(ranges, strconv.Itoa(start))
+		default:
+			ranges = append(ranges, strconv.Itoa(start)+"-"+strconv.Itoa(end))
+		}
+		start = -1
+	}
+	for i := range len(bits) * 8 {
+		if bits[i/8]&(1<<(i%8)) == 0 {
+			flush(i - 1)
+		} else if start == -1 {
+			start = i
+		}
+	}
+	flush(len(bits)*8 - 1)
+	return strings.Join(ranges, ",")
+}
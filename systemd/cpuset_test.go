@@ -53,3 +53,38 @@ func TestRangeToBits(t *testing.T) {
 		}
 	}
 }
+
+func TestBitsToRange(t *testing.T) {
+	testCases := []struct {
+		in  []byte
+		out string
+	}{
+		{in: nil, out: ""},
+		{in: []byte{0}, out: ""},
+		{in: []byte{1}, out: "0"},
+		{in: []byte{3}, out: "0-1"},
+		{in: []byte{0x0f}, out: "0-3"},
+		{in: []byte{0xea}, out: "1,3,5-7"},
+		{in: []byte{0xff, 0xff}, out: "0-15"},
+		{in: []byte{0, 0, 1}, out: "16"},
+		{in: []byte{0x0f, 0, 0, 0, 3}, out: "0-3,32-33"},
+		{in: []byte{0x80, 0x01}, out: "7-8"},
+	}
+
+	for _, tc := range testCases {
+		out := bitsToRange(tc.in)
+		if out != tc.out {
+			t.Errorf("case %v: expected %q, got %q", tc.in, tc.out, out)
+		}
+		if out == "" {
+			continue
+		}
+		// Check it round-trips.
+		bits, err := RangeToBits(out)
+		if err != nil {
+			t.Errorf("case %v: RangeToBits(%q): %v", tc.in, out, err)
+		} else if bitsToRange(bits) != out {
+			t.Errorf("case %v: round trip mismatch: %v", tc.in, bits)
+		}
+	}
+}
@@ -5,86 +5,203 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	dbus "github.com/godbus/dbus/v5"
+	"github.com/sirupsen/logrus"
 )
 
+// systemBus is the dbusPool key for the system bus.
+const systemBus = "system"
+
 var (
-	dbusC        *systemdDbus.Conn
-	dbusMu       sync.RWMutex
-	dbusInited   bool
-	dbusRootless bool
+	// dbusPool holds systemd dbus connections shared by managers,
+	// keyed by bus (see busKey).
+	dbusPool   = make(map[string]*dbusConn)
+	dbusPoolMu sync.Mutex
 )
 
-type dbusConnManager struct{}
+// dbusConn is a (lazily established) connection to a systemd instance,
+// shared by all managers using the same bus.
+type dbusConn struct {
+	key      string
+	rootless bool
+	refs     int // protected by dbusPoolMu
+
+	// newBackend, if set, is used instead of connecting to systemd.
+	newBackend func() (Backend, error)
+
+	mu   sync.RWMutex
+	conn Backend
+
+	versionOnce sync.Once
+	version     int
+}
+
+// dbusConnManager is a reference to a shared systemd dbus connection.
+type dbusConnManager struct {
+	c *dbusConn
 
-// newDbusConnManager initializes systemd dbus connection manager.
+	closeOnce sync.Once
+
+	// timeout is the time to wait for systemd jobs to complete
+	// (defJobTimeout if zero).
+	timeout atomic.Int64
+}
+
+// busKey returns the key identifying the bus a manager connects to.
+// Rootless managers use the user bus, which is identified by its address.
+func busKey(rootless bool) string {
+	if !rootless {
+		return systemBus
+	}
+	addr, err := DetectUserDbusSessionBusAddress()
+	if err != nil {
+		// The error is reported when connecting.
+		return "user"
+	}
+	return "user:" + addr
+}
+
+// newDbusConnManager returns a reference to systemd dbus connection for
+// either system (if rootless is false) or user bus. The connection is
+// shared with other managers using the same bus, and is established on
+// first use. Use close to release the reference.
 func newDbusConnManager(rootless bool) *dbusConnManager {
-	dbusMu.Lock()
-	defer dbusMu.Unlock()
-	if dbusInited && rootless != dbusRootless {
-		panic("can't have both root and rootless dbus")
+	key := busKey(rootless)
+
+	dbusPoolMu.Lock()
+	defer dbusPoolMu.Unlock()
+	c := dbusPool[key]
+	if c == nil {
+		c = &dbusConn{key: key, rootless: rootless}
+		dbusPool[key] = c
+	}
+	c.refs++
+	return &dbusConnManager{c: c}
+}
+
+// newBackendConnManager returns a dbusConnManager which uses b rather
+// than a connection to systemd. It is not shared with other managers.
+func newBackendConnManager(b Backend) *dbusConnManager {
+	c := &dbusConn{
+		refs: 1,
+		conn: b,
+		// An injected backend can not be reconnected to once it has
+		// been closed by resetConnection, so fail instead of retrying.
+		newBackend: func() (Backend, error) {
+			return nil, fmt.Errorf("systemd backend: %w", dbus.ErrClosed)
+		},
+	}
+	return &dbusConnManager{c: c}
+}
+
+// setJobTimeout sets the time to wait for systemd jobs to complete.
+// A zero or negative value means the default.
+func (d *dbusConnManager) setJobTimeout(timeout time.Duration) {
+	d.timeout.Store(int64(timeout))
+}
+
+func (d *dbusConnManager) jobTimeout() time.Duration {
+	if t := time.Duration(d.timeout.Load()); t > 0 {
+		return t
 	}
-	dbusInited = true
-	dbusRootless = rootless
-	return &dbusConnManager{}
+	return defJobTimeout
+}
+
+// close releases the reference to the connection. The connection is
+// closed once there are no more references to it.
+func (d *dbusConnManager) close() {
+	d.closeOnce.Do(func() {
+		dbusPoolMu.Lock()
+		defer dbusPoolMu.Unlock()
+		c := d.c
+		c.refs--
+		if c.refs > 0 {
+			return
+		}
+		if c.key != "" {
+			delete(dbusPool, c.key)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+	})
 }
 
 // getConnection lazily initializes and returns systemd dbus connection.
-func (d *dbusConnManager) getConnection() (*systemdDbus.Conn, error) {
-	// In the case where dbusC != nil
+func (d *dbusConnManager) getConnection() (Backend, error) {
+	c := d.c
+	// In the case where c.conn != nil
 	// Use the read lock the first time to ensure
 	// that Conn can be acquired at the same time.
-	dbusMu.RLock()
-	if conn := dbusC; conn != nil {
-		dbusMu.RUnlock()
+	c.mu.RLock()
+	if conn := c.conn; conn != nil {
+		c.mu.RUnlock()
 		return conn, nil
 	}
-	dbusMu.RUnlock()
+	c.mu.RUnlock()
 
-	// In the case where dbusC == nil
+	// In the case where c.conn == nil
 	// Use write lock to ensure that only one
 	// will be created
-	dbusMu.Lock()
-	defer dbusMu.Unlock()
-	if conn := dbusC; conn != nil {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn := c.conn; conn != nil {
 		return conn, nil
 	}
 
-	conn, err := d.newConnection()
+	conn, err := c.newConnection()
 	if err != nil {
-		// When dbus-user-session is not installed, we can't detect whether we should try to connect to user dbus or system dbus, so d.dbusRootless is set to false.
-		// This may fail with a cryptic error "read unix @->/run/systemd/private: read: connection reset by peer: unknown."
-		// https://github.com/moby/moby/issues/42793
-		return nil, fmt.Errorf("failed to connect to dbus (hint: for rootless containers, maybe you need to install dbus-user-session package, see https://github.com/opencontainers/runc/blob/master/docs/cgroup-v2.md): %w", err)
+		return nil, err
 	}
-	dbusC = conn
+	c.conn = conn
 	return conn, nil
 }
 
-func (d *dbusConnManager) newConnection() (*systemdDbus.Conn, error) {
-	if dbusRootless {
-		return newUserSystemdDbus()
+func (c *dbusConn) newConnection() (Backend, error) {
+	if c.newBackend != nil {
+		return c.newBackend()
+	}
+	var (
+		conn *systemdDbus.Conn
+		err  error
+	)
+	if c.rootless {
+		conn, err = newUserSystemdDbus()
+	} else {
+		conn, err = systemdDbus.NewWithContext(context.TODO())
+	}
+	if err != nil {
+		// When dbus-user-session is not installed, we can't detect whether we should try to connect to user dbus or system dbus, so c.rootless is set to false.
+		// This may fail with a cryptic error "read unix @->/run/systemd/private: read: connection reset by peer: unknown."
+		// https://github.com/moby/moby/issues/42793
+		return nil, fmt.Errorf("failed to connect to dbus (hint: for rootless containers, maybe you need to install dbus-user-session package, see https://github.com/opencontainers/runc/blob/master/docs/cgroup-v2.md): %w", err)
 	}
-	return systemdDbus.NewWithContext(context.TODO())
+	return &dbusBackend{conn: conn}, nil
 }
 
 // resetConnection resets the connection to its initial state
 // (so it can be reconnected if necessary).
-func (d *dbusConnManager) resetConnection(conn *systemdDbus.Conn) {
-	dbusMu.Lock()
-	defer dbusMu.Unlock()
-	if dbusC != nil && dbusC == conn {
-		dbusC.Close()
-		dbusC = nil
+func (d *dbusConnManager) resetConnection(conn Backend) {
+	c := d.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && c.conn == conn {
+		c.conn.Close()
+		c.conn = nil
 	}
 }
 
 // retryOnDisconnect calls op, and if the error it returns is about closed dbus
 // connection, the connection is re-established and the op is retried. This helps
 // with the situation when dbus is restarted and we have a stale connection.
-func (d *dbusConnManager) retryOnDisconnect(op func(*systemdDbus.Conn) error) error {
+func (d *dbusConnManager) retryOnDisconnect(op func(Backend) error) error {
 	for {
 		conn, err := d.getConnection()
 		if err != nil {
@@ -100,3 +217,22 @@ func (d *dbusConnManager) retryOnDisconnect(op func(*systemdDbus.Conn) error) er
 		d.resetConnection(conn)
 	}
 }
+
+// version returns the version of systemd instance the connection is to,
+// or -1 if it can not be determined. The value is cached.
+func (d *dbusConnManager) version() int {
+	c := d.c
+	c.versionOnce.Do(func() {
+		c.version = -1
+		verStr, err := getManagerProperty(d, "Version")
+		if err == nil {
+			c.version, err = systemdVersionAtoi(verStr)
+		}
+
+		if err != nil {
+			logrus.WithError(err).Error("unable to get systemd version")
+		}
+	})
+
+	return c.version
+}
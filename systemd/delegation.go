@@ -0,0 +1,175 @@
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/fs2"
+)
+
+// delegationDoc is where to read about enabling cgroup delegation.
+const delegationDoc = "https://github.com/opencontainers/runc/blob/main/docs/cgroup-v2.md"
+
+// DelegationError is returned by [UnifiedManager.CheckDelegation] when
+// some of the requested resources can't be applied because the systemd
+// user manager does not have the required controllers delegated to it.
+type DelegationError struct {
+	// ControlGroup is the cgroup of the systemd user manager, relative
+	// to the cgroup root, e.g. "/user.slice/user-1000.slice/user@1000.service".
+	ControlGroup string
+	// Available is the list of controllers available to the user manager.
+	Available []string
+	// Delegated is the user manager unit's DelegateControllers property,
+	// or nil if it can not be obtained.
+	Delegated []string
+	// Missing maps every unavailable controller to the names of the
+	// requested resources which need it.
+	Missing map[string][]string
+}
+
+func (e *DelegationError) Error() string {
+	ctrls := make([]string, 0, len(e.Missing))
+	var res []string
+	for c := range e.Missing {
+		ctrls = append(ctrls, c)
+	}
+	slices.Sort(ctrls)
+	for _, c := range ctrls {
+		res = append(res, e.Missing[c]...)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "controllers [%s] are not delegated to systemd user manager (cgroup %s), so [%s] can't be set",
+		strings.Join(ctrls, " "), e.ControlGroup, strings.Join(res, " "))
+	fmt.Fprintf(&b, "; available controllers: [%s]", strings.Join(e.Available, " "))
+	if e.Delegated != nil {
+		fmt.Fprintf(&b, ", %s has Delegate=%s", filepath.Base(e.ControlGroup), strings.Join(e.Delegated, " "))
+	}
+	fmt.Fprintf(&b, " (hint: add \"Delegate=cpu cpuset io memory pids\" to user@.service, see %s)", delegationDoc)
+	return b.String()
+}
+
+// delegateControllers returns the DelegateControllers property of the
+// given unit of the system instance of systemd.
+var delegateControllers = func(unit string) ([]string, error) {
+	cm := newDbusConnManager(false)
+	defer cm.close()
+	p, err := getUnitTypeProperty(cm, unit, "Service", "DelegateControllers")
+	if err != nil {
+		return nil, err
+	}
+	var ctrls []string
+	if err := p.Value.Store(&ctrls); err != nil {
+		return nil, err
+	}
+	return ctrls, nil
+}
+
+// CheckDelegation checks whether all the controllers needed to set r are
+// available to the systemd user manager, and returns a [*DelegationError]
+// listing the ones which are not, and the resources needing them.
+//
+// It is only meaningful for rootless managers, and returns nil otherwise.
+// Set calls it when a cgroup file is missing, but it can also be used
+// beforehand, to report unsatisfiable resources early.
+func (m *UnifiedManager) CheckDelegation(r *cgroups.Resources) error {
+	if !m.cgroups.Rootless || r == nil {
+		return nil
+	}
+	// managerCG is typically "/user.slice/user-${uid}.slice/user@${uid}.service".
+	managerCG, err := getManagerProperty(m.dbus, "ControlGroup")
+	if err != nil {
+		return err
+	}
+	dir, err := securejoin.SecureJoin(fs2.UnifiedMountpoint, managerCG)
+	if err != nil {
+		return err
+	}
+	return checkDelegation(managerCG, dir, r)
+}
+
+// checkDelegation is the implementation of CheckDelegation, with dir
+// being the cgroupfs path of managerCG.
+func checkDelegation(managerCG, dir string, r *cgroups.Resources) error {
+	data, err := cgroups.ReadFile(dir, "cgroup.controllers")
+	if err != nil {
+		return err
+	}
+	available := strings.Fields(data)
+
+	missing := make(map[string][]string)
+	for ctrl, res := range resourceControllers(r) {
+		if !slices.Contains(available, ctrl) {
+			missing[ctrl] = res
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// The property is only used for diagnostics, so ignore errors.
+	delegated, _ := delegateControllers(filepath.Base(managerCG))
+	return &DelegationError{
+		ControlGroup: managerCG,
+		Available:    available,
+		Delegated:    delegated,
+		Missing:      missing,
+	}
+}
+
+// resourceControllers maps cgroup v2 controllers to the names of the
+// resources in r which need them.
+func resourceControllers(r *cgroups.Resources) map[string][]string {
+	ctrls := make(map[string][]string)
+	add := func(ctrl, name string, set bool) {
+		if set {
+			ctrls[ctrl] = append(ctrls[ctrl], name)
+		}
+	}
+	add("memory", "Memory", r.Memory != 0)
+	add("memory", "MemoryReservation", r.MemoryReservation != 0)
+	add("memory", "MemorySwap", r.MemorySwap != 0)
+	add("memory", "MemorySwapHigh", r.MemorySwapHigh != nil)
+	add("memory", "MemoryZswapMax", r.MemoryZswapMax != nil)
+	add("memory", "MemoryZswapWriteback", r.MemoryZswapWriteback != nil)
+	add("cpu", "CpuShares", r.CpuShares != 0)
+	add("cpu", "CpuWeight", r.CpuWeight != 0)
+	add("cpu", "CpuQuota", r.CpuQuota != 0)
+	add("cpu", "CpuPeriod", r.CpuPeriod != 0)
+	add("cpu", "CpuBurst", r.CpuBurst != nil)
+	add("cpu", "CPUIdle", r.CPUIdle != nil)
+	add("cpuset", "CpusetCpus", r.CpusetCpus != "")
+	add("cpuset", "CpusetMems", r.CpusetMems != "")
+	add("pids", "PidsLimit", r.PidsLimit != 0)
+	add("io", "BlkioWeight", r.BlkioWeight != 0)
+	add("io", "BlkioWeightDevice", len(r.BlkioWeightDevice) > 0)
+	add("io", "BlkioThrottleReadBpsDevice", len(r.BlkioThrottleReadBpsDevice) > 0)
+	add("io", "BlkioThrottleWriteBpsDevice", len(r.BlkioThrottleWriteBpsDevice) > 0)
+	add("io", "BlkioThrottleReadIOPSDevice", len(r.BlkioThrottleReadIOPSDevice) > 0)
+	add("io", "BlkioThrottleWriteIOPSDevice", len(r.BlkioThrottleWriteIOPSDevice) > 0)
+	add("io", "IOWeightDevice", len(r.IOWeightDevice) > 0)
+	add("io", "IOLatencyDevice", len(r.IOLatencyDevice) > 0)
+	add("hugetlb", "HugetlbLimit", len(r.HugetlbLimit) > 0)
+	add("rdma", "Rdma", len(r.Rdma) > 0)
+
+	keys := make([]string, 0, len(r.Unified))
+	for k := range r.Unified {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		// Files of the core (cgroup.*) and PSI (*.pressure) are always
+		// there.
+		ctrl, _, ok := strings.Cut(k, ".")
+		if !ok || ctrl == "cgroup" || strings.HasSuffix(k, ".pressure") {
+			continue
+		}
+		add(ctrl, "unified:"+k, true)
+	}
+	return ctrls
+}
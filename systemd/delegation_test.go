@@ -0,0 +1,98 @@
+package systemd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+)
+
+func TestCheckDelegation(t *testing.T) {
+	setTestMode(t)
+	const managerCG = "/user.slice/user-1000.slice/user@1000.service"
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("memory pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	orig := delegateControllers
+	t.Cleanup(func() { delegateControllers = orig })
+	delegateControllers = func(unit string) ([]string, error) {
+		if unit != "user@1000.service" {
+			t.Errorf("unexpected unit %q", unit)
+		}
+		return []string{"memory", "pids"}, nil
+	}
+
+	// All the needed controllers are available.
+	r := &cgroups.Resources{
+		Memory:    1 << 30,
+		PidsLimit: 100,
+		Unified:   map[string]string{"memory.high": "max", "cgroup.max.depth": "3"},
+	}
+	if err := checkDelegation(managerCG, dir, r); err != nil {
+		t.Fatal(err)
+	}
+
+	r.CpuQuota = 50000
+	r.CpuPeriod = 100000
+	r.CpusetCpus = "0-1"
+	r.Unified["io.weight"] = "100"
+	err := checkDelegation(managerCG, dir, r)
+	var de *DelegationError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected DelegationError, got %v", err)
+	}
+	want := map[string][]string{
+		"cpu":    {"CpuQuota", "CpuPeriod"},
+		"cpuset": {"CpusetCpus"},
+		"io":     {"unified:io.weight"},
+	}
+	if !reflect.DeepEqual(de.Missing, want) {
+		t.Errorf("expected missing %v, got %v", want, de.Missing)
+	}
+	if de.ControlGroup != managerCG || !reflect.DeepEqual(de.Delegated, []string{"memory", "pids"}) {
+		t.Errorf("unexpected error details: %+v", de)
+	}
+	for _, s := range []string{"[cpu cpuset io]", "CpuQuota", "Delegate=memory pids", "Delegate=cpu cpuset io memory pids"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not contain %q", err, s)
+		}
+	}
+}
+
+func TestResourceControllers(t *testing.T) {
+	swapHigh, zswapMax, writeback := int64(0), int64(0), false
+	for _, tc := range []struct {
+		name string
+		r    *cgroups.Resources
+		want map[string][]string
+	}{
+		{
+			name: "IOWeightDevice",
+			r:    &cgroups.Resources{IOWeightDevice: []*cgroups.IOWeightDevice{cgroups.NewIOWeightDevice(8, 0, 200)}},
+			want: map[string][]string{"io": {"IOWeightDevice"}},
+		},
+		{
+			name: "IOLatencyDevice",
+			r:    &cgroups.Resources{IOLatencyDevice: []*cgroups.IOLatencyDevice{cgroups.NewIOLatencyDevice(8, 0, 1000)}},
+			want: map[string][]string{"io": {"IOLatencyDevice"}},
+		},
+		{
+			name: "memory swap and zswap",
+			r: &cgroups.Resources{
+				MemorySwapHigh:       &swapHigh,
+				MemoryZswapMax:       &zswapMax,
+				MemoryZswapWriteback: &writeback,
+			},
+			want: map[string][]string{"memory": {"MemorySwapHigh", "MemoryZswapMax", "MemoryZswapWriteback"}},
+		},
+	} {
+		if got := resourceControllers(tc.r); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
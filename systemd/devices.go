@@ -2,8 +2,11 @@ package systemd
 
 import (
 	"reflect"
+	"slices"
 
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	dbus "github.com/godbus/dbus/v5"
+	"github.com/sirupsen/logrus"
 
 	"github.com/opencontainers/cgroups"
 )
@@ -72,3 +75,32 @@ func (m *LegacyManager) freezeBeforeSet(unitName string, r *cgroups.Resources) (
 	}
 	return
 }
+
+// devicesUnchanged answers whether the device rules in r are the same as
+// the ones currently in effect in the devices cgroup, meaning there is no
+// transition to be made, so the device properties need not be updated.
+// Any error is treated as a change, so the caller falls back to the
+// regular (freezing) update.
+func (m *LegacyManager) devicesUnchanged(r *cgroups.Resources) bool {
+	if r.SkipDevices || DevicesUnchangedV1 == nil {
+		return false
+	}
+	path, ok := m.paths["devices"]
+	if !ok {
+		return false
+	}
+	unchanged, err := DevicesUnchangedV1(path, r)
+	if err != nil {
+		logrus.Debugf("unable to compare device rules, assuming changed: %v", err)
+		return false
+	}
+	return unchanged
+}
+
+// withoutDeviceProperties returns props with the DevicePolicy and
+// DeviceAllow properties removed.
+func withoutDeviceProperties(props []systemdDbus.Property) []systemdDbus.Property {
+	return slices.DeleteFunc(props, func(p systemdDbus.Property) bool {
+		return p.Name == "DevicePolicy" || p.Name == "DeviceAllow"
+	})
+}
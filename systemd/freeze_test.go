@@ -5,132 +5,137 @@ import (
 	"bytes"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
-	"github.com/opencontainers/cgroups"
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"golang.org/x/sys/unix"
-)
 
-func TestFreezeBeforeSet(t *testing.T) {
-	requireV1(t)
+	"github.com/opencontainers/cgroups"
+	devices "github.com/opencontainers/cgroups/devices/config"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
 
-	testCases := []struct {
-		desc string
-		// Test input.
-		cg        *cgroups.Cgroup
-		preFreeze bool
-		// Expected values.
-		// Before unit creation (Apply).
-		freeze0, thaw0 bool
-		// After unit creation.
-		freeze1, thaw1 bool
-	}{
-		{
-			// A slice with SkipDevices.
-			desc: "slice,skip-devices",
-			cg: &cgroups.Cgroup{
-				Name:   "system-runc_test_freeze_1.slice",
-				Parent: "system.slice",
-				Resources: &cgroups.Resources{
-					SkipDevices: true,
-				},
+var freezeBeforeSetTests = []struct {
+	desc string
+	// Test input.
+	cg        *cgroups.Cgroup
+	preFreeze bool
+	// Expected values.
+	// Before unit creation (Apply).
+	freeze0, thaw0 bool
+	// After unit creation.
+	freeze1, thaw1 bool
+}{
+	{
+		// A slice with SkipDevices.
+		desc: "slice,skip-devices",
+		cg: &cgroups.Cgroup{
+			Name:   "system-runc_test_freeze_1.slice",
+			Parent: "system.slice",
+			Resources: &cgroups.Resources{
+				SkipDevices: true,
 			},
-			// Expected.
-			freeze0: false,
-			thaw0:   false,
-			freeze1: false,
-			thaw1:   false,
 		},
-		{
-			// A scope with SkipDevices. Not a realistic scenario with runc
-			// (as container can't have SkipDevices == true), but possible
-			// for a standalone cgroup manager.
-			desc: "scope,skip-devices",
-			cg: &cgroups.Cgroup{
-				ScopePrefix: "test",
-				Name:        "testFreeze2",
-				Parent:      "system.slice",
-				Resources: &cgroups.Resources{
-					SkipDevices: true,
-				},
+		// Expected.
+		freeze0: false,
+		thaw0:   false,
+		freeze1: false,
+		thaw1:   false,
+	},
+	{
+		// A scope with SkipDevices. Not a realistic scenario with runc
+		// (as container can't have SkipDevices == true), but possible
+		// for a standalone cgroup manager.
+		desc: "scope,skip-devices",
+		cg: &cgroups.Cgroup{
+			ScopePrefix: "test",
+			Name:        "testFreeze2",
+			Parent:      "system.slice",
+			Resources: &cgroups.Resources{
+				SkipDevices: true,
 			},
-			// Expected.
-			freeze0: false,
-			thaw0:   false,
-			freeze1: false,
-			thaw1:   false,
 		},
-		{
-			// A slice that is about to be frozen in Set.
-			desc: "slice,will-freeze",
-			cg: &cgroups.Cgroup{
-				Name:   "system-runc_test_freeze_3.slice",
-				Parent: "system.slice",
-				Resources: &cgroups.Resources{
-					Freezer: cgroups.Frozen,
-				},
+		// Expected.
+		freeze0: false,
+		thaw0:   false,
+		freeze1: false,
+		thaw1:   false,
+	},
+	{
+		// A slice that is about to be frozen in Set.
+		desc: "slice,will-freeze",
+		cg: &cgroups.Cgroup{
+			Name:   "system-runc_test_freeze_3.slice",
+			Parent: "system.slice",
+			Resources: &cgroups.Resources{
+				Freezer: cgroups.Frozen,
 			},
-			// Expected.
-			freeze0: true,
-			thaw0:   false,
-			freeze1: true,
-			thaw1:   false,
 		},
-		{
-			// A pre-frozen slice that should stay frozen.
-			desc: "slice,pre-frozen,will-freeze",
-			cg: &cgroups.Cgroup{
-				Name:   "system-runc_test_freeze_4.slice",
-				Parent: "system.slice",
-				Resources: &cgroups.Resources{
-					Freezer: cgroups.Frozen,
-				},
+		// Expected.
+		freeze0: true,
+		thaw0:   false,
+		freeze1: true,
+		thaw1:   false,
+	},
+	{
+		// A pre-frozen slice that should stay frozen.
+		desc: "slice,pre-frozen,will-freeze",
+		cg: &cgroups.Cgroup{
+			Name:   "system-runc_test_freeze_4.slice",
+			Parent: "system.slice",
+			Resources: &cgroups.Resources{
+				Freezer: cgroups.Frozen,
 			},
-			preFreeze: true,
-			// Expected.
-			freeze0: true, // not actually frozen yet.
-			thaw0:   false,
-			freeze1: false,
-			thaw1:   false,
 		},
-		{
-			// A pre-frozen scope with skip devices set.
-			desc: "scope,pre-frozen,skip-devices",
-			cg: &cgroups.Cgroup{
-				ScopePrefix: "test",
-				Name:        "testFreeze5",
-				Parent:      "system.slice",
-				Resources: &cgroups.Resources{
-					SkipDevices: true,
-				},
+		preFreeze: true,
+		// Expected.
+		freeze0: true, // not actually frozen yet.
+		thaw0:   false,
+		freeze1: false,
+		thaw1:   false,
+	},
+	{
+		// A pre-frozen scope with skip devices set.
+		desc: "scope,pre-frozen,skip-devices",
+		cg: &cgroups.Cgroup{
+			ScopePrefix: "test",
+			Name:        "testFreeze5",
+			Parent:      "system.slice",
+			Resources: &cgroups.Resources{
+				SkipDevices: true,
 			},
-			preFreeze: true,
-			// Expected.
-			freeze0: false,
-			thaw0:   false,
-			freeze1: false,
-			thaw1:   false,
 		},
-		{
-			// A pre-frozen scope which will be thawed.
-			desc: "scope,pre-frozen",
-			cg: &cgroups.Cgroup{
-				ScopePrefix: "test",
-				Name:        "testFreeze6",
-				Parent:      "system.slice",
-				Resources:   &cgroups.Resources{},
-			},
-			preFreeze: true,
-			// Expected.
-			freeze0: true, // not actually frozen yet.
-			thaw0:   true,
-			freeze1: false,
-			thaw1:   false,
+		preFreeze: true,
+		// Expected.
+		freeze0: false,
+		thaw0:   false,
+		freeze1: false,
+		thaw1:   false,
+	},
+	{
+		// A pre-frozen scope which will be thawed.
+		desc: "scope,pre-frozen",
+		cg: &cgroups.Cgroup{
+			ScopePrefix: "test",
+			Name:        "testFreeze6",
+			Parent:      "system.slice",
+			Resources:   &cgroups.Resources{},
 		},
-	}
+		preFreeze: true,
+		// Expected.
+		freeze0: true, // not actually frozen yet.
+		thaw0:   true,
+		freeze1: false,
+		thaw1:   false,
+	},
+}
+
+func TestFreezeBeforeSet(t *testing.T) {
+	requireV1(t)
 
-	for _, tc := range testCases {
+	for _, tc := range freezeBeforeSetTests {
 		tc := tc
 		t.Run(tc.desc, func(t *testing.T) {
 			m, err := NewLegacyManager(tc.cg, nil)
@@ -203,6 +208,67 @@ func TestFreezeBeforeSet(t *testing.T) {
 	}
 }
 
+// TestFreezeBeforeSetFake is the same as TestFreezeBeforeSet, but uses
+// a fake systemd, so it works without systemd and root.
+func TestFreezeBeforeSetFake(t *testing.T) {
+	setTestMode(t)
+
+	for _, tc := range freezeBeforeSetTests {
+		t.Run(tc.desc, func(t *testing.T) {
+			fake := systemdtest.NewLegacy(t.TempDir())
+			unitName := getUnitName(tc.cg)
+			// Slice paths are derived from their names.
+			slice, base := unitName, ""
+			if !strings.HasSuffix(unitName, ".slice") {
+				slice, base = tc.cg.Parent, unitName
+			}
+			path, err := ExpandSlice(slice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path = filepath.Join(path, base)
+			paths := map[string]string{
+				"devices": fake.CgroupDir("devices", path),
+				"freezer": fake.CgroupDir("freezer", path),
+			}
+			m, err := NewLegacyManagerWithBackend(tc.cg, paths, fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			freeze, thaw, err := m.freezeBeforeSet(unitName, tc.cg.Resources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if freeze != tc.freeze0 || thaw != tc.thaw0 {
+				t.Errorf("before Apply (non-existent unit): expected freeze: %v, thaw: %v, got freeze: %v, thaw: %v",
+					tc.freeze0, tc.thaw0, freeze, thaw)
+			}
+
+			if err := m.Apply(-1); err != nil {
+				t.Fatal(err)
+			}
+			if tc.preFreeze {
+				if err := m.Freeze(cgroups.Frozen); err != nil {
+					t.Fatal(err)
+				}
+			}
+			freeze, thaw, err = m.freezeBeforeSet(unitName, tc.cg.Resources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if freeze != tc.freeze1 || thaw != tc.thaw1 {
+				t.Errorf("expected freeze: %v, thaw: %v, got freeze: %v, thaw: %v",
+					tc.freeze1, tc.thaw1, freeze, thaw)
+			}
+			if err := m.Destroy(); err != nil {
+				t.Errorf("destroy: %s", err)
+			}
+		})
+	}
+}
+
 // requireV1 skips the test unless a set of requirements (cgroup v1,
 // systemd, root) is met.
 func requireV1(t *testing.T) {
@@ -352,3 +418,72 @@ func TestFreezePodCgroup(t *testing.T) {
 		t.Fatalf("expected %q, got %q", marker, reply)
 	}
 }
+
+// TestLegacySetDevicesUnchanged checks that Set neither freezes the
+// container nor sets device properties when the device rules are not
+// changed.
+func TestLegacySetDevicesUnchanged(t *testing.T) {
+	setTestMode(t)
+
+	// Stub the hooks normally set by the devices package.
+	unchanged := true
+	origGen, origUnchanged, origSet := GenerateDeviceProps, DevicesUnchangedV1, cgroups.DevicesSetV1
+	GenerateDeviceProps = func(*cgroups.Resources, int) ([]systemdDbus.Property, error) {
+		return []systemdDbus.Property{
+			newProp("DevicePolicy", "strict"),
+			newProp("DeviceAllow", []struct{ Path, Perms string }{{"/dev/null", "rwm"}}),
+		}, nil
+	}
+	DevicesUnchangedV1 = func(string, *cgroups.Resources) (bool, error) {
+		return unchanged, nil
+	}
+	cgroups.DevicesSetV1 = func(string, *cgroups.Resources) error { return nil }
+	t.Cleanup(func() {
+		GenerateDeviceProps, DevicesUnchangedV1, cgroups.DevicesSetV1 = origGen, origUnchanged, origSet
+	})
+
+	fake := systemdtest.NewLegacy(t.TempDir())
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "devices-unchanged",
+		Resources:   &cgroups.Resources{},
+	}
+	unitName := getUnitName(config)
+	paths := map[string]string{
+		"devices": fake.CgroupDir("devices", "system.slice/"+unitName),
+		"freezer": fake.CgroupDir("freezer", "system.slice/"+unitName),
+	}
+	m, err := NewLegacyManagerWithBackend(config, paths, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	// Make any attempt to freeze fail.
+	if err := os.RemoveAll(paths["freezer"]); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &cgroups.Resources{
+		Devices:   []*devices.Rule{{Type: devices.CharDevice, Major: 1, Minor: 3, Permissions: "rwm", Allow: true}},
+		PidsLimit: 10,
+	}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := fake.Unit(unitName)
+	if _, ok := u.Properties["DeviceAllow"]; ok {
+		t.Error("DeviceAllow is set while device rules are unchanged")
+	}
+	if _, ok := u.Properties["TasksMax"]; !ok {
+		t.Error("TasksMax is not set")
+	}
+
+	// Changed rules require a freeze, which fails.
+	unchanged = false
+	if err := m.Set(r); err == nil {
+		t.Error("expected freeze error for changed device rules")
+	}
+}
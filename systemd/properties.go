@@ -0,0 +1,131 @@
+package systemd
+
+import (
+	"errors"
+	"fmt"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// knownProperty describes a unit property which can be set via
+// [cgroups.Cgroup.SystemdProperties].
+type knownProperty struct {
+	sig     string // D-Bus signature of the value.
+	version int    // Minimal systemd version supporting it, or 0.
+}
+
+// knownProperties are the properties which can be set via
+// [cgroups.Cgroup.SystemdProperties].
+var knownProperties = map[string]knownProperty{
+	// Unit.
+	"Description":         {sig: "s"},
+	"Documentation":       {sig: "as"},
+	"Wants":               {sig: "as"},
+	"Requires":            {sig: "as"},
+	"BindsTo":             {sig: "as"},
+	"PartOf":              {sig: "as"},
+	"Before":              {sig: "as"},
+	"After":               {sig: "as"},
+	"DefaultDependencies": {sig: "b"},
+	"CollectMode":         {sig: "s", version: 236},
+
+	// Scope, service, and slice.
+	"Slice":           {sig: "s"},
+	"Delegate":        {sig: "b"},
+	"RuntimeMaxUSec":  {sig: "t"},
+	"TimeoutStopUSec": {sig: "t"},
+	"KillMode":        {sig: "s"},
+	"KillSignal":      {sig: "i"},
+	"FinalKillSignal": {sig: "i", version: 243},
+	"SendSIGKILL":     {sig: "b"},
+	"SendSIGHUP":      {sig: "b"},
+	"OOMPolicy":       {sig: "s", version: 243},
+
+	// Resource control.
+	"CPUAccounting":            {sig: "b"},
+	"MemoryAccounting":         {sig: "b"},
+	"IOAccounting":             {sig: "b"},
+	"TasksAccounting":          {sig: "b"},
+	"IPAccounting":             {sig: "b"},
+	"CPUWeight":                {sig: "t"},
+	"StartupCPUWeight":         {sig: "t"},
+	"CPUQuotaPerSecUSec":       {sig: "t"},
+	"CPUQuotaPeriodUSec":       {sig: "t", version: 242},
+	"AllowedCPUs":              {sig: "ay", version: 244},
+	"AllowedMemoryNodes":       {sig: "ay", version: 244},
+	"MemoryMin":                {sig: "t", version: 240},
+	"MemoryLow":                {sig: "t"},
+	"MemoryHigh":               {sig: "t"},
+	"MemoryMax":                {sig: "t"},
+	"MemorySwapMax":            {sig: "t", version: 232},
+	"MemoryZSwapMax":           {sig: "t", version: 253},
+	"MemoryZSwapWriteback":     {sig: "b", version: 256},
+	"TasksMax":                 {sig: "t"},
+	"IOWeight":                 {sig: "t"},
+	"StartupIOWeight":          {sig: "t"},
+	"ManagedOOMSwap":           {sig: "s", version: 247},
+	"ManagedOOMMemoryPressure": {sig: "s", version: 247},
+	"ManagedOOMPreference":     {sig: "s", version: 248},
+
+	// Resource control (cgroup v1).
+	"CPUShares":     {sig: "t"},
+	"MemoryLimit":   {sig: "t"},
+	"BlockIOWeight": {sig: "t"},
+}
+
+// PropertyError describes why a [cgroups.SystemdProperty] can't be used.
+type PropertyError struct {
+	Name   string
+	Reason string
+}
+
+func (e *PropertyError) Error() string {
+	return "systemd property " + e.Name + ": " + e.Reason
+}
+
+// ValidateProperties checks that props are known unit properties, having
+// values of correct types, and supported by the given systemd version
+// (if it is positive). The returned error, if any, wraps a [*PropertyError]
+// for every bad property.
+func ValidateProperties(props []cgroups.SystemdProperty, version int) error {
+	var errs []error
+	for _, p := range props {
+		if err := validateProperty(p, version); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateProperty(p cgroups.SystemdProperty, version int) error {
+	known, ok := knownProperties[p.Name]
+	if !ok {
+		return &PropertyError{Name: p.Name, Reason: "unknown or unsupported property"}
+	}
+	if sig := cgroups.SystemdPropertySignature(p.Value); sig != known.sig {
+		return &PropertyError{Name: p.Name, Reason: fmt.Sprintf("value %v has type %q, expected %q", p.Value, sig, known.sig)}
+	}
+	if version > 0 && version < known.version {
+		return &PropertyError{Name: p.Name, Reason: fmt.Sprintf("requires systemd >= %d (got %d)", known.version, version)}
+	}
+	return nil
+}
+
+// convertProperties validates props (see ValidateProperties) for the
+// version of systemd cm is connected to, and converts them to D-Bus
+// properties.
+func convertProperties(cm *dbusConnManager, props []cgroups.SystemdProperty) ([]systemdDbus.Property, error) {
+	if len(props) == 0 {
+		return nil, nil
+	}
+	if err := ValidateProperties(props, systemdVersion(cm)); err != nil {
+		return nil, err
+	}
+	dbusProps := make([]systemdDbus.Property, 0, len(props))
+	for _, p := range props {
+		dbusProps = append(dbusProps, newProp(p.Name, p.Value))
+	}
+	return dbusProps, nil
+}
@@ -0,0 +1,94 @@
+package systemd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+func TestValidateProperties(t *testing.T) {
+	good := []cgroups.SystemdProperty{
+		{Name: "TasksMax", Value: uint64(100)},
+		{Name: "CollectMode", Value: "inactive-or-failed"},
+		{Name: "MemoryZSwapMax", Value: uint64(0)},
+	}
+	if err := ValidateProperties(good, 256); err != nil {
+		t.Error(err)
+	}
+	// Unknown version.
+	if err := ValidateProperties(good, -1); err != nil {
+		t.Error(err)
+	}
+
+	bad := []cgroups.SystemdProperty{
+		{Name: "TaskMax", Value: uint64(100)},
+		{Name: "TasksMax", Value: "100"},
+		{Name: "MemoryZSwapMax", Value: uint64(0)},
+	}
+	err := ValidateProperties(bad, 250)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var n int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var pe *PropertyError
+		if !errors.As(e, &pe) {
+			t.Errorf("expected PropertyError, got %v", e)
+			continue
+		}
+		if pe.Name != bad[n].Name {
+			t.Errorf("expected error for %s, got %v", bad[n].Name, pe)
+		}
+		n++
+	}
+	if n != len(bad) {
+		t.Errorf("expected %d errors, got %d: %v", len(bad), n, err)
+	}
+}
+
+func TestUnifiedManagerSystemdProperties(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "props",
+		Resources:   &cgroups.Resources{},
+		SystemdProperties: []cgroups.SystemdProperty{
+			{Name: "CollectMode", Value: "inactive-or-failed"},
+			{Name: "TasksMax", Value: uint64(42)},
+		},
+	}
+	unit := getUnitName(config)
+	m, err := NewUnifiedManagerWithBackend(config, fake.CgroupDir("", "/system.slice/"+unit), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// A typo is reported before the unit is started.
+	config.SystemdProperties = append(config.SystemdProperties, cgroups.SystemdProperty{Name: "CollectMod", Value: "inactive"})
+	if err := m.Apply(-1); err == nil {
+		t.Fatal("expected an error for unknown property")
+	}
+	if _, ok := fake.Unit(unit); ok {
+		t.Fatal("unit is started despite bad properties")
+	}
+
+	config.SystemdProperties = config.SystemdProperties[:2]
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	u, ok := fake.Unit(unit)
+	if !ok {
+		t.Fatal("unit is not started")
+	}
+	if v := u.Properties["CollectMode"].Value(); v != "inactive-or-failed" {
+		t.Errorf("unexpected CollectMode %v", v)
+	}
+	if got := readFakeFile(t, m.Path(""), "pids.max"); got != "42" {
+		t.Errorf("expected pids.max 42, got %s", got)
+	}
+}
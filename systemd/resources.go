@@ -0,0 +1,266 @@
+package systemd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	dbus "github.com/godbus/dbus/v5"
+
+	"github.com/opencontainers/cgroups"
+	devices "github.com/opencontainers/cgroups/devices/config"
+)
+
+// ParseDeviceProps is a function to convert systemd DevicePolicy and
+// DeviceAllow unit properties back to device rules, used by
+// GetUnitResources methods. Unless
+// [github.com/opencontainers/cgroups/devices] package is imported, it is
+// set to nil, and device rules are not read back.
+var ParseDeviceProps func(props []systemdDbus.Property) ([]*devices.Rule, error)
+
+// Unit properties read back by GetUnitResources, in addition to those
+// used to set devices.
+var (
+	v2ResourcesProperties = []string{
+		"MemoryMax", "MemoryLow", "MemoryHigh", "MemoryMin", "MemorySwapMax",
+		"CPUWeight", "CPUQuotaPerSecUSec", "CPUQuotaPeriodUSec",
+		"TasksMax", "AllowedCPUs", "AllowedMemoryNodes",
+	}
+	v1ResourcesProperties = []string{
+		"MemoryLimit", "CPUShares", "CPUQuotaPerSecUSec", "CPUQuotaPeriodUSec",
+		"BlockIOWeight", "TasksMax", "AllowedCPUs", "AllowedMemoryNodes",
+	}
+	deviceProperties = []string{"DevicePolicy", "DeviceAllow"}
+)
+
+// getUnitProperties returns the values of the named properties of a unit.
+// Properties unknown to systemd (e.g. because it is too old) are omitted.
+func getUnitProperties(cm *dbusConnManager, unitName string, names []string) (map[string]dbus.Variant, error) {
+	unitType := getUnitType(unitName)
+	props := make(map[string]dbus.Variant, len(names))
+	for _, name := range names {
+		prop, err := getUnitTypeProperty(cm, unitName, unitType, name)
+		if err != nil {
+			if isDbusError(err, "org.freedesktop.DBus.Error.UnknownProperty") {
+				continue
+			}
+			return nil, fmt.Errorf("unable to get unit %s property %s: %w", unitName, name, err)
+		}
+		props[name] = prop.Value
+	}
+	return props, nil
+}
+
+// GetUnitResources queries the current resource properties of the
+// systemd unit and converts them to [cgroups.Resources]. Unlike
+// GetCgroups, which returns the configuration the manager was created
+// with, this reflects changes made by other means (such as
+// "systemctl set-property").
+//
+// Properties which systemd reports as infinity are converted to -1 if
+// the corresponding Resources field supports it, and are left unset
+// otherwise. Device rules are only read if the
+// [github.com/opencontainers/cgroups/devices] package is imported.
+func (m *UnifiedManager) GetUnitResources() (*cgroups.Resources, error) {
+	unitName := getUnitName(m.cgroups)
+	props, err := getUnitProperties(m.dbus, unitName, v2ResourcesProperties)
+	if err != nil {
+		return nil, err
+	}
+	r, err := v2PropsToResources(props)
+	if err != nil {
+		return nil, err
+	}
+	if err := readDeviceProperties(m.dbus, unitName, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetUnitResources queries the current resource properties of the
+// systemd unit and converts them to [cgroups.Resources]. See
+// [UnifiedManager.GetUnitResources] for details.
+func (m *LegacyManager) GetUnitResources() (*cgroups.Resources, error) {
+	unitName := getUnitName(m.cgroups)
+	props, err := getUnitProperties(m.dbus, unitName, v1ResourcesProperties)
+	if err != nil {
+		return nil, err
+	}
+	r, err := v1PropsToResources(props)
+	if err != nil {
+		return nil, err
+	}
+	if err := readDeviceProperties(m.dbus, unitName, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func readDeviceProperties(cm *dbusConnManager, unitName string, r *cgroups.Resources) error {
+	if ParseDeviceProps == nil {
+		return nil
+	}
+	props, err := getUnitProperties(cm, unitName, deviceProperties)
+	if err != nil {
+		return err
+	}
+	var devProps []systemdDbus.Property
+	for _, name := range deviceProperties {
+		if v, ok := props[name]; ok {
+			devProps = append(devProps, systemdDbus.Property{Name: name, Value: v})
+		}
+	}
+	r.Devices, err = ParseDeviceProps(devProps)
+	if err != nil {
+		return fmt.Errorf("unable to convert unit %s device properties: %w", unitName, err)
+	}
+	return nil
+}
+
+// v2PropsToResources is the reverse of genV2ResourcesProperties.
+func v2PropsToResources(props map[string]dbus.Variant) (*cgroups.Resources, error) {
+	r := &cgroups.Resources{}
+	u := propReader{props: props}
+
+	if v, ok := u.uint64("MemoryMax"); ok {
+		r.Memory = int64(v)
+	}
+	if v, ok := u.uint64("MemoryLow"); ok && v != 0 {
+		r.MemoryReservation = int64(v)
+	}
+	if v, ok := u.uint64("MemorySwapMax"); ok {
+		// Resources.MemorySwap is memory+swap, see
+		// cgroups.ConvertMemorySwapToCgroupV2Value.
+		switch {
+		case v == math.MaxUint64:
+			r.MemorySwap = -1
+		case r.Memory == -1:
+			r.MemorySwap = int64(v)
+		case r.Memory > 0:
+			r.MemorySwap = r.Memory + int64(v)
+		}
+	}
+	// These have no Resources fields of their own.
+	for name, file := range map[string]string{"MemoryHigh": "memory.high", "MemoryMin": "memory.min"} {
+		v, ok := u.uint64(name)
+		if !ok || v == 0 || (v == math.MaxUint64 && name == "MemoryHigh") {
+			// Unset.
+			continue
+		}
+		if r.Unified == nil {
+			r.Unified = make(map[string]string)
+		}
+		r.Unified[file] = maxOrUint(v)
+	}
+
+	if v, ok := u.uint64("CPUWeight"); ok {
+		switch v {
+		case math.MaxUint64:
+			// Unset.
+		case 0:
+			idle := int64(1)
+			r.CPUIdle = &idle
+		default:
+			r.CpuWeight = v
+		}
+	}
+	u.cpuQuota(r)
+
+	if v, ok := u.uint64("TasksMax"); ok {
+		r.PidsLimit = int64(v)
+	}
+	u.cpuset(r)
+
+	return r, u.err
+}
+
+// v1PropsToResources is the reverse of genV1ResourcesProperties.
+func v1PropsToResources(props map[string]dbus.Variant) (*cgroups.Resources, error) {
+	r := &cgroups.Resources{}
+	u := propReader{props: props}
+
+	if v, ok := u.uint64("MemoryLimit"); ok {
+		r.Memory = int64(v)
+	}
+	if v, ok := u.uint64("CPUShares"); ok && v != math.MaxUint64 {
+		r.CpuShares = v
+	}
+	u.cpuQuota(r)
+	if v, ok := u.uint64("BlockIOWeight"); ok && v <= math.MaxUint16 {
+		r.BlkioWeight = uint16(v)
+	}
+	if v, ok := u.uint64("TasksMax"); ok {
+		r.PidsLimit = int64(v)
+	}
+	u.cpuset(r)
+
+	return r, u.err
+}
+
+// propReader reads typed unit property values, remembering the first
+// conversion error.
+type propReader struct {
+	props map[string]dbus.Variant
+	err   error
+}
+
+func (u *propReader) store(name string, dst any) bool {
+	v, ok := u.props[name]
+	if !ok || u.err != nil {
+		return false
+	}
+	if err := v.Store(dst); err != nil {
+		u.err = fmt.Errorf("unit property %s=%s: %w", name, v, err)
+		return false
+	}
+	return true
+}
+
+func (u *propReader) uint64(name string) (uint64, bool) {
+	var v uint64
+	ok := u.store(name, &v)
+	return v, ok
+}
+
+// cpuQuota is the reverse of addCPUQuota.
+func (u *propReader) cpuQuota(r *cgroups.Resources) {
+	period, ok := u.uint64("CPUQuotaPeriodUSec")
+	if !ok || period == math.MaxUint64 {
+		// Unset, meaning the default.
+		period = 0
+	}
+	r.CpuPeriod = period
+
+	perSec, ok := u.uint64("CPUQuotaPerSecUSec")
+	if !ok {
+		return
+	}
+	if perSec == math.MaxUint64 {
+		r.CpuQuota = -1
+		return
+	}
+	if period == 0 {
+		period = defCPUQuotaPeriod
+	}
+	r.CpuQuota = int64(perSec * period / 1000000)
+}
+
+// cpuset is the reverse of addCpuset.
+func (u *propReader) cpuset(r *cgroups.Resources) {
+	var bits []byte
+	if u.store("AllowedCPUs", &bits) {
+		r.CpusetCpus = bitsToRange(bits)
+	}
+	bits = nil
+	if u.store("AllowedMemoryNodes", &bits) {
+		r.CpusetMems = bitsToRange(bits)
+	}
+}
+
+func maxOrUint(v uint64) string {
+	if v == math.MaxUint64 {
+		return "max"
+	}
+	return strconv.FormatUint(v, 10)
+}
@@ -0,0 +1,202 @@
+package systemd
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	dbus "github.com/godbus/dbus/v5"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+func TestV2PropsToResources(t *testing.T) {
+	inf := uint64(math.MaxUint64)
+	idle := int64(1)
+	for _, tc := range []struct {
+		name  string
+		props map[string]any
+		want  *cgroups.Resources
+	}{
+		{
+			name:  "empty",
+			props: map[string]any{},
+			want:  &cgroups.Resources{},
+		},
+		{
+			name: "defaults",
+			props: map[string]any{
+				"MemoryMax": inf, "MemoryHigh": inf, "MemorySwapMax": inf,
+				"MemoryLow": uint64(0), "MemoryMin": uint64(0),
+				"CPUWeight": inf, "CPUQuotaPerSecUSec": inf, "CPUQuotaPeriodUSec": inf,
+				"TasksMax": inf, "AllowedCPUs": []byte{},
+			},
+			want: &cgroups.Resources{Memory: -1, MemorySwap: -1, CpuQuota: -1, PidsLimit: -1},
+		},
+		{
+			name: "limits",
+			props: map[string]any{
+				"MemoryMax": uint64(1 << 30), "MemorySwapMax": uint64(1 << 20),
+				"MemoryLow": uint64(1 << 29), "MemoryHigh": uint64(1 << 29), "MemoryMin": inf,
+				"CPUWeight": uint64(200), "CPUQuotaPerSecUSec": uint64(500000), "CPUQuotaPeriodUSec": uint64(50000),
+				"TasksMax": uint64(42), "AllowedCPUs": []byte{0x0f}, "AllowedMemoryNodes": []byte{1},
+			},
+			want: &cgroups.Resources{
+				Memory:            1 << 30,
+				MemorySwap:        1<<30 + 1<<20,
+				MemoryReservation: 1 << 29,
+				CpuWeight:         200,
+				CpuQuota:          25000,
+				CpuPeriod:         50000,
+				PidsLimit:         42,
+				CpusetCpus:        "0-3",
+				CpusetMems:        "0",
+				Unified:           map[string]string{"memory.high": "536870912", "memory.min": "max"},
+			},
+		},
+		{
+			name:  "swap limit only",
+			props: map[string]any{"MemoryMax": inf, "MemorySwapMax": uint64(1 << 20)},
+			want:  &cgroups.Resources{Memory: -1, MemorySwap: 1 << 20},
+		},
+		{
+			name:  "idle",
+			props: map[string]any{"CPUWeight": uint64(0)},
+			want:  &cgroups.Resources{CPUIdle: &idle},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			props := make(map[string]dbus.Variant)
+			for k, v := range tc.props {
+				props[k] = dbus.MakeVariant(v)
+			}
+			got, err := v2PropsToResources(props)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+
+	// A value of a wrong type.
+	if _, err := v2PropsToResources(map[string]dbus.Variant{"TasksMax": dbus.MakeVariant("42")}); err == nil {
+		t.Error("expected an error for a string TasksMax value")
+	}
+}
+
+func TestUnifiedManagerGetUnitResources(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "readback",
+		Resources:   &cgroups.Resources{},
+	}
+	unit := getUnitName(config)
+	path := fake.CgroupDir("", "/system.slice/"+unit)
+	m, err := NewUnifiedManagerWithBackend(config, path, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &cgroups.Resources{
+		Memory:     512 * 1024 * 1024,
+		MemorySwap: 768 * 1024 * 1024,
+		CpuWeight:  300,
+		CpuQuota:   150000,
+		CpuPeriod:  100000,
+		PidsLimit:  64,
+		CpusetCpus: "0-1",
+	}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.GetUnitResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("expected %+v, got %+v", r, got)
+	}
+
+	// Emulate "systemctl set-property" done by someone else.
+	if err := fake.SetUnitProperties(context.Background(), unit, true,
+		newProp("TasksMax", uint64(128)),
+		newProp("MemoryMax", uint64(math.MaxUint64))); err != nil {
+		t.Fatal(err)
+	}
+	got, err = m.GetUnitResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PidsLimit != 128 || got.Memory != -1 {
+		t.Errorf("expected changed PidsLimit and Memory, got %+v", got)
+	}
+}
+
+func TestLegacyManagerGetUnitResources(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.NewLegacy(t.TempDir())
+
+	config := &cgroups.Cgroup{
+		ScopePrefix: "test",
+		Name:        "readback",
+		Resources:   &cgroups.Resources{},
+	}
+	paths := make(map[string]string)
+	for _, c := range []string{"blkio", "cpu", "devices", "freezer", "memory", "pids"} {
+		paths[c] = fake.CgroupDir(c, "system.slice/"+getUnitName(config))
+	}
+	m, err := NewLegacyManagerWithBackend(config, paths, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not set yet.
+	got, err := m.GetUnitResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &cgroups.Resources{Memory: -1, CpuQuota: -1, PidsLimit: -1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	props := []systemdDbus.Property{
+		newProp("MemoryLimit", uint64(1<<30)),
+		newProp("CPUShares", uint64(1024)),
+		newProp("BlockIOWeight", uint64(500)),
+		newProp("CPUQuotaPerSecUSec", uint64(200000)),
+	}
+	if err := fake.SetUnitProperties(context.Background(), getUnitName(config), true, props...); err != nil {
+		t.Fatal(err)
+	}
+	got, err = m.GetUnitResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &cgroups.Resources{
+		Memory:      1 << 30,
+		CpuShares:   1024,
+		BlkioWeight: 500,
+		CpuQuota:    20000,
+		PidsLimit:   -1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,39 @@
+package systemd
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// Restore returns a systemd cgroup manager from its saved state (see
+// [cgroups.State]), which must be of type [cgroups.ManagerTypeSystemd]
+// or [cgroups.ManagerTypeSystemdLegacy]. The unit in the state must be
+// the one of the saved config. A manager restored from the state of an
+// attached manager (see [Attach]) does not start the unit either.
+//
+// Restore does not check the paths, which is done by
+// [github.com/opencontainers/cgroups/manager.Restore], normally used
+// instead.
+func Restore(st *cgroups.State) (Manager, error) {
+	if unit := getUnitName(st.Config); st.Unit != unit {
+		return nil, fmt.Errorf("can't restore %s cgroup manager: unit %q does not match the config (unit %q)", st.Type, st.Unit, unit)
+	}
+	switch st.Type {
+	case cgroups.ManagerTypeSystemd:
+		m, err := NewUnifiedManager(st.Config, st.Paths[""])
+		if err != nil {
+			return nil, err
+		}
+		m.attached = st.Attached
+		return m, nil
+	case cgroups.ManagerTypeSystemdLegacy:
+		m, err := NewLegacyManager(st.Config, st.Paths)
+		if err != nil {
+			return nil, err
+		}
+		m.attached = st.Attached
+		return m, nil
+	}
+	return nil, fmt.Errorf("can't restore %s cgroup manager: not a systemd manager type", st.Type)
+}
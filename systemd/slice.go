@@ -0,0 +1,161 @@
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/cgroups"
+)
+
+// SliceChain is a chain of nested systemd slices, such as a.slice,
+// a-b.slice, and a-b-c.slice, each having its own manager.
+type SliceChain struct {
+	// Managers are the slice managers, from the outermost
+	// (e.g. a.slice) to the innermost (e.g. a-b-c.slice) one.
+	Managers []Manager
+}
+
+// CreateSliceChain creates (or updates, if they already exist) all the
+// slices leading to a nested slice, e.g. a.slice, a-b.slice, and
+// a-b-c.slice for "a-b-c.slice", and sets their resources.
+//
+// Resources, if not empty, must have an element for every slice level,
+// from the outermost to the innermost one; a nil element means no
+// resources are set for that level. As slices are not supposed to
+// restrict devices, SkipDevices is implied unless Devices are given.
+//
+// If rootless is set, the slices are created by the user instance of
+// systemd. Use [SliceChain.Close] to release the managers.
+func CreateSliceChain(slice string, resources []*cgroups.Resources, rootless bool) (*SliceChain, error) {
+	return createSliceChain(slice, resources, rootless, func(c *cgroups.Cgroup) (Manager, error) {
+		if cgroups.IsCgroup2UnifiedMode() {
+			return NewUnifiedManager(c, "")
+		}
+		return NewLegacyManager(c, nil)
+	})
+}
+
+// createSliceChain is the implementation of CreateSliceChain, using
+// newManager to create slice managers.
+func createSliceChain(slice string, resources []*cgroups.Resources, rootless bool, newManager func(*cgroups.Cgroup) (Manager, error)) (_ *SliceChain, Err error) {
+	names, err := sliceChain(slice)
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) != 0 && len(resources) != len(names) {
+		return nil, fmt.Errorf("slice %s has %d levels, but resources are given for %d", slice, len(names), len(resources))
+	}
+
+	chain := &SliceChain{}
+	defer func() {
+		if Err != nil {
+			_ = chain.Close()
+		}
+	}()
+	// The outermost slice is in the root slice.
+	parent := "-.slice"
+	for i, name := range names {
+		r := &cgroups.Resources{}
+		if len(resources) != 0 && resources[i] != nil {
+			rCopy := *resources[i]
+			r = &rCopy
+		}
+		if len(r.Devices) == 0 {
+			r.SkipDevices = true
+		}
+		m, err := newManager(&cgroups.Cgroup{
+			Name:      name,
+			Parent:    parent,
+			Rootless:  rootless,
+			Resources: r,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain.Managers = append(chain.Managers, m)
+		if err := m.Apply(-1); err != nil {
+			return nil, fmt.Errorf("unable to create slice %s: %w", name, err)
+		}
+		if err := m.Set(r); err != nil {
+			return nil, fmt.Errorf("unable to set slice %s resources: %w", name, err)
+		}
+		parent = name
+	}
+
+	return chain, nil
+}
+
+// sliceChain returns the names of all the slices leading to slice,
+// e.g. a.slice, a-b.slice, and a-b-c.slice for a-b-c.slice.
+func sliceChain(slice string) ([]string, error) {
+	if _, err := ExpandSlice(slice); err != nil {
+		return nil, err
+	}
+	if slice == "-.slice" {
+		return nil, errors.New("can't create the root slice")
+	}
+	components := strings.Split(strings.TrimSuffix(slice, ".slice"), "-")
+	names := make([]string, len(components))
+	for i := range components {
+		names[i] = strings.Join(components[:i+1], "-") + ".slice"
+	}
+	return names, nil
+}
+
+// RemoveEmpty removes the slices of the chain which have neither
+// processes nor child cgroups, starting from the innermost one, and
+// stopping at the first slice which is not empty. The managers are
+// not closed.
+func (c *SliceChain) RemoveEmpty() error {
+	for i := len(c.Managers) - 1; i >= 0; i-- {
+		m := c.Managers[i]
+		empty, err := managerEmpty(m)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return nil
+		}
+		if err := m.Destroy(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the managers of the chain.
+func (c *SliceChain) Close() error {
+	for _, m := range c.Managers {
+		_ = m.Close()
+	}
+	return nil
+}
+
+// managerEmpty answers whether all cgroups of m have neither processes
+// nor child cgroups. A cgroup which does not exist is considered empty.
+func managerEmpty(m Manager) (bool, error) {
+	for _, path := range m.GetPaths() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return false, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				return false, nil
+			}
+		}
+		pids, err := cgroups.GetPids(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		if len(pids) > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
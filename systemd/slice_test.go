@@ -0,0 +1,126 @@
+package systemd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
+)
+
+func TestSliceChain(t *testing.T) {
+	for _, tc := range []struct {
+		slice string
+		want  []string
+	}{
+		{"a.slice", []string{"a.slice"}},
+		{"a-b-c.slice", []string{"a.slice", "a-b.slice", "a-b-c.slice"}},
+	} {
+		got, err := sliceChain(tc.slice)
+		if err != nil {
+			t.Errorf("%s: %v", tc.slice, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.slice, tc.want, got)
+		}
+	}
+	for _, slice := range []string{"-.slice", "a--b.slice", "a/b.slice", "a.scope"} {
+		if _, err := sliceChain(slice); err == nil {
+			t.Errorf("%s: expected an error", slice)
+		}
+	}
+}
+
+func TestCreateSliceChain(t *testing.T) {
+	setTestMode(t)
+	fake := systemdtest.New(t.TempDir())
+	newManager := func(c *cgroups.Cgroup) (Manager, error) {
+		parent, err := ExpandSlice(c.Parent)
+		if err != nil {
+			return nil, err
+		}
+		return NewUnifiedManagerWithBackend(c, fake.CgroupDir("", filepath.Join(parent, c.Name)), fake)
+	}
+
+	resources := []*cgroups.Resources{
+		{PidsLimit: 1000},
+		nil,
+		{PidsLimit: 10},
+	}
+	if _, err := createSliceChain("qos-burst-low.slice", resources[:2], false, newManager); err == nil {
+		t.Fatal("expected an error for too few resources")
+	}
+	chain, err := createSliceChain("qos-burst-low.slice", resources, false, newManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	if len(chain.Managers) != 3 {
+		t.Fatalf("expected 3 managers, got %d", len(chain.Managers))
+	}
+	for name, want := range map[string]any{
+		"qos.slice":           uint64(1000),
+		"qos-burst.slice":     nil,
+		"qos-burst-low.slice": uint64(10),
+	} {
+		u, ok := fake.Unit(name)
+		if !ok {
+			t.Fatalf("unit %s not found", name)
+		}
+		var got any
+		if v, ok := u.Properties["TasksMax"]; ok {
+			got = v.Value()
+		}
+		if got != want {
+			t.Errorf("%s: expected TasksMax %v, got %v", name, want, got)
+		}
+	}
+	if resources[0].SkipDevices {
+		t.Error("resources are modified")
+	}
+
+	// The innermost slice has a process, so nothing is removed.
+	inner := chain.Managers[2].Path("")
+	if err := os.WriteFile(filepath.Join(inner, "cgroup.procs"), []byte("123\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.RemoveEmpty(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Unit("qos.slice"); !ok {
+		t.Fatal("non-empty slice chain is removed")
+	}
+
+	// The middle slice has another child cgroup.
+	if err := os.WriteFile(filepath.Join(inner, "cgroup.procs"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(chain.Managers[1].Path(""), "qos-burst-high.slice")
+	if err := os.Mkdir(other, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.RemoveEmpty(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Unit("qos-burst-low.slice"); ok {
+		t.Error("empty slice qos-burst-low.slice is not removed")
+	}
+	if _, ok := fake.Unit("qos-burst.slice"); !ok {
+		t.Error("non-empty slice qos-burst.slice is removed")
+	}
+
+	if err := os.Remove(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.RemoveEmpty(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"qos.slice", "qos-burst.slice"} {
+		if _, ok := fake.Unit(name); ok {
+			t.Errorf("empty slice %s is not removed", name)
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package systemd
 
 import (
+	"math"
 	"os"
 	"reflect"
+	"sort"
 	"testing"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/opencontainers/cgroups"
+	"github.com/opencontainers/cgroups/systemd/systemdtest"
 )
 
 func newManager(t *testing.T, config *cgroups.Cgroup) (m cgroups.Manager) {
@@ -56,6 +59,37 @@ func TestSystemdVersion(t *testing.T) {
 	}
 }
 
+func TestDbusConnManagerPool(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path=/nonexistent/bus")
+
+	// Connections are established lazily, so none of the below
+	// requires systemd or dbus.
+	root1 := newDbusConnManager(false)
+	root2 := newDbusConnManager(false)
+	user := newDbusConnManager(true)
+
+	if root1.c != root2.c {
+		t.Error("expected managers for the system bus to share a connection")
+	}
+	if user.c == root1.c {
+		t.Error("expected managers for system and user bus to use different connections")
+	}
+	if root1.c.refs != 2 || user.c.refs != 1 {
+		t.Errorf("unexpected reference counts: system %d, user %d", root1.c.refs, user.c.refs)
+	}
+
+	root1.close()
+	root1.close() // Should be a no-op.
+	if root2.c.refs != 1 || dbusPool[systemBus] != root2.c {
+		t.Errorf("system bus connection released too early (refs %d)", root2.c.refs)
+	}
+	root2.close()
+	user.close()
+	if len(dbusPool) != 0 {
+		t.Errorf("expected empty connection pool, got %+v", dbusPool)
+	}
+}
+
 func TestValidUnitTypes(t *testing.T) {
 	testCases := []struct {
 		unitName         string
@@ -179,6 +213,229 @@ func TestUnifiedResToSystemdProps(t *testing.T) {
 	}
 }
 
+func TestUnifiedResToSystemdPropsFake(t *testing.T) {
+	inf := uint64(math.MaxUint64)
+	testCases := []struct {
+		name     string
+		version  int
+		res      map[string]string
+		expError bool
+		expProps []systemdDbus.Property
+	}{
+		{
+			name: "io.weight default",
+			res:  map[string]string{"io.weight": "default 200"},
+			expProps: []systemdDbus.Property{
+				newProp("IOWeight", uint64(200)),
+			},
+		},
+		{
+			name: "io.weight per device",
+			res:  map[string]string{"io.weight": "8:0 300\n8:16 400"},
+			expProps: []systemdDbus.Property{
+				newProp("IODeviceWeight", []ioDeviceValue{
+					{"/dev/block/8:0", 300},
+					{"/dev/block/8:16", 400},
+				}),
+			},
+		},
+		{
+			name: "io.max",
+			res:  map[string]string{"io.max": "8:0 rbps=1048576 wiops=max"},
+			expProps: []systemdDbus.Property{
+				newProp("IOReadBandwidthMax", []ioDeviceValue{{"/dev/block/8:0", 1048576}}),
+				newProp("IOWriteIOPSMax", []ioDeviceValue{{"/dev/block/8:0", inf}}),
+			},
+		},
+		{
+			name:     "io.max invalid key",
+			res:      map[string]string{"io.max": "8:0 foo=1"},
+			expError: true,
+		},
+		{
+			name:     "io.max invalid device",
+			res:      map[string]string{"io.max": "sda rbps=1"},
+			expError: true,
+		},
+		{
+			name: "io.latency",
+			res:  map[string]string{"io.latency": "8:0 target=10000"},
+			expProps: []systemdDbus.Property{
+				newProp("IODeviceLatencyTargetUSec", []ioDeviceValue{{"/dev/block/8:0", 10000}}),
+			},
+		},
+		{
+			name:    "io.latency too old",
+			version: 239,
+			res:     map[string]string{"io.latency": "8:0 target=10000"},
+		},
+		{
+			name: "memory.zswap",
+			res:  map[string]string{"memory.zswap.max": "max", "memory.zswap.writeback": "0"},
+			expProps: []systemdDbus.Property{
+				newProp("MemoryZSwapMax", inf),
+				newProp("MemoryZSwapWriteback", false),
+			},
+		},
+		{
+			name:    "memory.zswap.writeback too old",
+			version: 255,
+			res:     map[string]string{"memory.zswap.writeback": "1"},
+		},
+		{
+			name:     "memory.zswap.writeback invalid",
+			res:      map[string]string{"memory.zswap.writeback": "yes"},
+			expError: true,
+		},
+		{
+			name:    "cpuset too old",
+			version: 243,
+			res:     map[string]string{"cpuset.cpus": "0-1"},
+		},
+		{
+			name: "cgroupfs only",
+			res:  map[string]string{"memory.oom.group": "1", "cpu.max.burst": "1000"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := systemdtest.New(t.TempDir())
+			fake.Version = 256
+			if tc.version != 0 {
+				fake.Version = tc.version
+			}
+			cm := newBackendConnManager(fake)
+			defer cm.close()
+
+			props, err := unifiedResToSystemdProps(cm, tc.res)
+			if err != nil && !tc.expError {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if err == nil && tc.expError {
+				t.Fatal("expected error, got nil")
+			}
+			// Properties of different keys come in random order.
+			sort.Slice(props, func(i, j int) bool { return props[i].Name < props[j].Name })
+			sort.Slice(tc.expProps, func(i, j int) bool { return tc.expProps[i].Name < tc.expProps[j].Name })
+			if !reflect.DeepEqual(tc.expProps, props) {
+				t.Errorf("wrong properties (exp %+v, got %+v)", tc.expProps, props)
+			}
+		})
+	}
+}
+
+func TestGenV2IODeviceProperties(t *testing.T) {
+	r := &cgroups.Resources{
+		SkipDevices:     true,
+		IOWeightDevice:  []*cgroups.IOWeightDevice{cgroups.NewIOWeightDevice(8, 0, 300)},
+		IOLatencyDevice: []*cgroups.IOLatencyDevice{cgroups.NewIOLatencyDevice(8, 16, 10000), cgroups.NewIOLatencyDevice(8, 32, 0)},
+	}
+	for _, version := range []int{239, 256} {
+		fake := systemdtest.New(t.TempDir())
+		fake.Version = version
+		cm := newBackendConnManager(fake)
+		defer cm.close()
+
+		props, err := genV2ResourcesProperties(t.TempDir(), r, cm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expProps := []systemdDbus.Property{
+			newProp("IODeviceWeight", []ioDeviceValue{{"/dev/block/8:0", 300}}),
+		}
+		if version >= 240 {
+			expProps = append(expProps, newProp("IODeviceLatencyTargetUSec", []ioDeviceValue{
+				{"/dev/block/8:16", 10000},
+				{"/dev/block/8:32", math.MaxUint64},
+			}))
+		}
+		if !reflect.DeepEqual(expProps, props) {
+			t.Errorf("systemd v%d: wrong properties (exp %+v, got %+v)", version, expProps, props)
+		}
+	}
+}
+
+func TestGenV2ZswapProperties(t *testing.T) {
+	swapHigh, zswapMax, writeback := int64(1<<30), int64(-1), false
+	r := &cgroups.Resources{
+		SkipDevices:          true,
+		MemorySwapHigh:       &swapHigh,
+		MemoryZswapMax:       &zswapMax,
+		MemoryZswapWriteback: &writeback,
+	}
+	for _, tc := range []struct {
+		version  int
+		expProps []systemdDbus.Property
+	}{
+		{version: 252},
+		{
+			version:  253,
+			expProps: []systemdDbus.Property{newProp("MemoryZSwapMax", uint64(math.MaxUint64))},
+		},
+		{
+			version: 256,
+			expProps: []systemdDbus.Property{
+				newProp("MemoryZSwapMax", uint64(math.MaxUint64)),
+				newProp("MemoryZSwapWriteback", false),
+			},
+		},
+	} {
+		fake := systemdtest.New(t.TempDir())
+		fake.Version = tc.version
+		cm := newBackendConnManager(fake)
+		defer cm.close()
+
+		props, err := genV2ResourcesProperties(t.TempDir(), r, cm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tc.expProps, props) {
+			t.Errorf("systemd v%d: wrong properties (exp %+v, got %+v)", tc.version, tc.expProps, props)
+		}
+	}
+}
+
+func TestSplitUnifiedResources(t *testing.T) {
+	res := map[string]string{
+		"cpu.idle":         "0",
+		"cpu.max.burst":    "1000",
+		"cpu.weight":       "100",
+		"io.latency":       "8:0 target=100",
+		"memory.oom.group": "1",
+		"memory.zswap.max": "0",
+		"pids.max":         "10",
+	}
+	for _, tc := range []struct {
+		version                  int
+		persistent, cgroupfsOnly []string
+	}{
+		{
+			version:      256,
+			persistent:   []string{"cpu.weight", "io.latency", "memory.zswap.max", "pids.max"},
+			cgroupfsOnly: []string{"cpu.idle", "cpu.max.burst", "memory.oom.group"},
+		},
+		{
+			version:      239,
+			persistent:   []string{"cpu.weight", "pids.max"},
+			cgroupfsOnly: []string{"cpu.idle", "cpu.max.burst", "io.latency", "memory.oom.group", "memory.zswap.max"},
+		},
+	} {
+		persistent, cgroupfsOnly := splitUnifiedResources(res, tc.version)
+		if !reflect.DeepEqual(persistent, tc.persistent) {
+			t.Errorf("v%d: expected persistent %v, got %v", tc.version, tc.persistent, persistent)
+		}
+		if !reflect.DeepEqual(cgroupfsOnly, tc.cgroupfsOnly) {
+			t.Errorf("v%d: expected cgroupfs-only %v, got %v", tc.version, tc.cgroupfsOnly, cgroupfsOnly)
+		}
+	}
+
+	res["cpu.idle"] = "1"
+	if persistent, _ := splitUnifiedResources(res, 252); persistent[0] != "cpu.idle" {
+		t.Errorf("expected cpu.idle=1 to be persistent, got %v", persistent)
+	}
+}
+
 func TestAddCPUQuota(t *testing.T) {
 	if !IsRunningSystemd() {
 		t.Skip("Test requires systemd.")
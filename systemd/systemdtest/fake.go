@@ -0,0 +1,556 @@
+// Package systemdtest provides an in-memory fake of systemd, for testing
+// the managers in [github.com/opencontainers/cgroups/systemd] without
+// systemd or D-Bus.
+package systemdtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// Fake implements the systemd.Backend interface. It keeps track of
+// transient units and their properties, and emulates systemd by writing
+// the corresponding cgroup files to a fake cgroupfs under Root.
+//
+// Since the fake cgroupfs consists of regular files, cgroups.TestMode
+// should be set when using the managers with a Fake.
+type Fake struct {
+	// Root is the fake cgroupfs mount point.
+	Root string
+	// Legacy is set for cgroup v1 layout, in which every controller
+	// has its own hierarchy (named after the controller) under Root.
+	Legacy bool
+	// Version is the systemd version reported via the Version
+	// manager property.
+	Version int
+	// ControlGroup is the value of the ControlGroup manager property,
+	// i.e. the cgroup of the systemd instance. Non-empty for the user
+	// instance, e.g. "/user.slice/user-1000.slice/user@1000.service".
+	ControlGroup string
+	// StartJobResults, if set, are the results of jobs starting the
+	// named units, reported instead of "done". A unit whose start job
+	// result is not "done" is left in the failed state. An empty result
+	// means the job never completes.
+	StartJobResults map[string]string
+
+	mu    sync.Mutex
+	units map[string]*Unit
+}
+
+// Unit is the state of a unit known to Fake.
+type Unit struct {
+	Name string
+	// Path is the unit's cgroup path, relative to Root (and, for
+	// cgroup v1, to the controller hierarchy).
+	Path string
+	// Properties are the unit properties, as set by StartTransientUnit
+	// and SetUnitProperties.
+	Properties map[string]dbus.Variant
+	// ActiveState, SubState and Result are the unit's state.
+	ActiveState string
+	SubState    string
+	Result      string
+}
+
+// v1Controllers are the controller hierarchies created by Fake in legacy mode.
+var v1Controllers = []string{"blkio", "cpu", "cpuacct", "cpuset", "devices", "freezer", "memory", "pids"}
+
+// New returns a Fake for cgroup v2 with its cgroupfs under root.
+func New(root string) *Fake {
+	return &Fake{Root: root, Version: 255, units: make(map[string]*Unit)}
+}
+
+// NewLegacy returns a Fake for cgroup v1 with its cgroupfs under root.
+func NewLegacy(root string) *Fake {
+	f := New(root)
+	f.Legacy = true
+	return f
+}
+
+// Unit returns a copy of the state of the named unit.
+func (f *Fake) Unit(name string) (*Unit, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.units[name]
+	if !ok {
+		return nil, false
+	}
+	cp := *u
+	cp.Properties = make(map[string]dbus.Variant, len(u.Properties))
+	for k, v := range u.Properties {
+		cp.Properties[k] = v
+	}
+	return &cp, true
+}
+
+// CgroupDir returns the directory of the given cgroup path in the fake
+// cgroupfs. For cgroup v1, controller is the hierarchy name; it is
+// ignored for cgroup v2.
+func (f *Fake) CgroupDir(controller, path string) string {
+	if f.Legacy {
+		return filepath.Join(f.Root, controller, path)
+	}
+	return filepath.Join(f.Root, path)
+}
+
+// CgroupRoot returns the fake cgroup v2 mountpoint, that is, Root.
+func (f *Fake) CgroupRoot() string {
+	return f.Root
+}
+
+func (f *Fake) StartTransientUnit(_ context.Context, name, _ string, properties []systemdDbus.Property, ch chan<- string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if u, ok := f.units[name]; ok && u.ActiveState != "failed" {
+		return 0, unitError("org.freedesktop.systemd1.UnitExists", "Unit %s already exists.", name)
+	}
+	u := &Unit{
+		Name:        name,
+		Properties:  make(map[string]dbus.Variant),
+		ActiveState: "active",
+		SubState:    "running",
+		Result:      "success",
+	}
+	for _, p := range properties {
+		u.Properties[p.Name] = p.Value
+	}
+	path, err := f.unitPath(u)
+	if err != nil {
+		return 0, err
+	}
+	u.Path = path
+	if err := f.createCgroup(u); err != nil {
+		return 0, err
+	}
+	if err := f.applyProperties(u, properties); err != nil {
+		return 0, err
+	}
+	f.units[name] = u
+
+	result := "done"
+	if r, ok := f.StartJobResults[name]; ok {
+		result = r
+	}
+	if result != "done" {
+		u.ActiveState, u.SubState, u.Result = "failed", "failed", "resources"
+	}
+	if result != "" {
+		f.done(ch, result)
+	}
+	return 1, nil
+}
+
+func (f *Fake) StopUnit(_ context.Context, name, _ string, ch chan<- string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.units[name]
+	if !ok {
+		return 0, unitError("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not loaded.", name)
+	}
+	delete(f.units, name)
+	for _, dir := range f.cgroupDirs(u.Path) {
+		_ = os.RemoveAll(dir)
+	}
+	f.done(ch, "done")
+	return 1, nil
+}
+
+func (f *Fake) SetUnitProperties(_ context.Context, name string, _ bool, properties ...systemdDbus.Property) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.units[name]
+	if !ok {
+		return unitError("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not loaded.", name)
+	}
+	for _, p := range properties {
+		u.Properties[p.Name] = p.Value
+	}
+	return f.applyProperties(u, properties)
+}
+
+// defaultProperties are the values returned for properties of a unit
+// which were never set (or of a non-existent unit). As in systemd,
+// unset limits are infinity (math.MaxUint64).
+var defaultProperties = map[string]any{
+	"DevicePolicy":       "auto",
+	"DeviceAllow":        []struct{ Path, Perms string }{},
+	"MemoryMax":          uint64(math.MaxUint64),
+	"MemoryHigh":         uint64(math.MaxUint64),
+	"MemorySwapMax":      uint64(math.MaxUint64),
+	"MemoryLimit":        uint64(math.MaxUint64),
+	"MemoryLow":          uint64(0),
+	"MemoryMin":          uint64(0),
+	"CPUWeight":          uint64(math.MaxUint64),
+	"CPUShares":          uint64(math.MaxUint64),
+	"CPUQuotaPerSecUSec": uint64(math.MaxUint64),
+	"CPUQuotaPeriodUSec": uint64(math.MaxUint64),
+	"BlockIOWeight":      uint64(math.MaxUint64),
+	"IOWeight":           uint64(math.MaxUint64),
+	"TasksMax":           uint64(math.MaxUint64),
+	"AllowedCPUs":        []byte{},
+	"AllowedMemoryNodes": []byte{},
+}
+
+func (f *Fake) GetUnitTypeProperty(_ context.Context, unit, unitType, propertyName string) (*systemdDbus.Property, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.units[unit]
+	if unitType == "Unit" {
+		state := [3]string{"inactive", "dead", ""}
+		if ok {
+			state = [3]string{u.ActiveState, u.SubState, u.Result}
+		}
+		switch propertyName {
+		case "ActiveState":
+			return prop(propertyName, state[0]), nil
+		case "SubState":
+			return prop(propertyName, state[1]), nil
+		}
+	}
+	if ok {
+		if propertyName == "ControlGroup" {
+			return prop(propertyName, u.Path), nil
+		}
+		if v, ok := u.Properties[propertyName]; ok {
+			return &systemdDbus.Property{Name: propertyName, Value: v}, nil
+		}
+		switch propertyName {
+		case "Result":
+			return prop(propertyName, u.Result), nil
+		case "Slice":
+			// The slice the unit's cgroup is in.
+			slice := filepath.Base(filepath.Dir(u.Path))
+			if !strings.HasSuffix(slice, ".slice") {
+				slice = "-.slice"
+			}
+			return prop(propertyName, slice), nil
+		}
+	}
+	if v, ok := defaultProperties[propertyName]; ok {
+		return prop(propertyName, v), nil
+	}
+	return nil, unitError("org.freedesktop.DBus.Error.UnknownProperty", "Unknown property %s.", propertyName)
+}
+
+func (f *Fake) ResetFailedUnit(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.units[name]
+	if !ok {
+		return unitError("org.freedesktop.systemd1.NoSuchUnit", "Unit %s not loaded.", name)
+	}
+	if u.ActiveState == "failed" {
+		delete(f.units, name)
+	}
+	return nil
+}
+
+func (f *Fake) GetManagerProperty(name string) (string, error) {
+	var v any
+	switch name {
+	case "Version":
+		v = strconv.Itoa(f.Version)
+	case "ControlGroup":
+		v = f.ControlGroup
+	default:
+		return "", unitError("org.freedesktop.DBus.Error.UnknownProperty", "Unknown property %s.", name)
+	}
+	return dbus.MakeVariant(v).String(), nil
+}
+
+// Close does nothing, so a Fake can be used by multiple managers.
+func (f *Fake) Close() {}
+
+// done reports the job result to ch, asynchronously (as systemd does).
+func (f *Fake) done(ch chan<- string, result string) {
+	if ch != nil {
+		go func() { ch <- result }()
+	}
+}
+
+func prop(name string, v any) *systemdDbus.Property {
+	return &systemdDbus.Property{Name: name, Value: dbus.MakeVariant(v)}
+}
+
+func unitError(name, format string, args ...any) error {
+	return dbus.Error{Name: name, Body: []any{fmt.Sprintf(format, args...)}}
+}
+
+// unitPath returns the cgroup path of a unit, which is the path of its
+// slice followed by the unit name (for slices, the parent slice is
+// inferred from the name).
+func (f *Fake) unitPath(u *Unit) (string, error) {
+	slice := u.Name
+	if !strings.HasSuffix(u.Name, ".slice") {
+		slice = "system.slice"
+		if v, ok := u.Properties["Slice"]; ok {
+			if err := v.Store(&slice); err != nil {
+				return "", err
+			}
+		}
+	}
+	path, err := expandSlice(slice)
+	if err != nil {
+		return "", err
+	}
+	if slice != u.Name {
+		path = filepath.Join(path, u.Name)
+	}
+	return filepath.Join("/", f.ControlGroup, path), nil
+}
+
+// expandSlice is the same as systemd.ExpandSlice.
+func expandSlice(slice string) (string, error) {
+	name, ok := strings.CutSuffix(slice, ".slice")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid slice name: %s", slice)
+	}
+	if name == "-" {
+		return "/", nil
+	}
+	var path, prefix string
+	for _, component := range strings.Split(name, "-") {
+		if component == "" {
+			return "", fmt.Errorf("invalid slice name: %s", slice)
+		}
+		path += "/" + prefix + component + ".slice"
+		prefix += component + "-"
+	}
+	return path, nil
+}
+
+func (f *Fake) cgroupDirs(path string) []string {
+	if !f.Legacy {
+		return []string{f.CgroupDir("", path)}
+	}
+	dirs := make([]string, 0, len(v1Controllers))
+	for _, c := range v1Controllers {
+		dirs = append(dirs, f.CgroupDir(c, path))
+	}
+	return dirs
+}
+
+// createCgroup creates the unit's cgroup with its initial files, and
+// moves the unit's PIDs into it.
+func (f *Fake) createCgroup(u *Unit) error {
+	var pids []uint32
+	if v, ok := u.Properties["PIDs"]; ok {
+		if err := v.Store(&pids); err != nil {
+			return err
+		}
+	}
+	procs := ""
+	for _, pid := range pids {
+		procs += strconv.FormatUint(uint64(pid), 10) + "\n"
+	}
+
+	const controllers = "cpuset cpu io memory hugetlb pids rdma misc\n"
+	files := map[string]string{"cgroup.procs": procs}
+	if f.Legacy {
+		files["freezer.state"] = "THAWED\n"
+	} else {
+		files["cgroup.controllers"] = controllers
+		files["cgroup.freeze"] = "0\n"
+		// Like the real cgroupfs, the root has the controllers list.
+		if err := os.MkdirAll(f.Root, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(f.Root, "cgroup.controllers"), []byte(controllers), 0o644); err != nil {
+			return err
+		}
+	}
+	for _, dir := range f.cgroupDirs(u.Path) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyProperties writes the cgroup files corresponding to properties.
+// Properties which have no effect on cgroup files are ignored.
+func (f *Fake) applyProperties(u *Unit, properties []systemdDbus.Property) error {
+	for _, p := range properties {
+		var err error
+		if f.Legacy {
+			err = f.applyV1(u, p)
+		} else {
+			err = f.applyV2(u, p)
+		}
+		if err != nil {
+			return fmt.Errorf("property %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (f *Fake) write(u *Unit, controller, file, data string) error {
+	return os.WriteFile(filepath.Join(f.CgroupDir(controller, u.Path), file), []byte(data+"\n"), 0o644)
+}
+
+func (f *Fake) applyV2(u *Unit, p systemdDbus.Property) error {
+	switch p.Name {
+	case "MemoryMax", "MemoryLow", "MemoryHigh", "MemoryMin", "MemorySwapMax", "TasksMax":
+		files := map[string]string{
+			"MemoryMax":     "memory.max",
+			"MemoryLow":     "memory.low",
+			"MemoryHigh":    "memory.high",
+			"MemoryMin":     "memory.min",
+			"MemorySwapMax": "memory.swap.max",
+			"TasksMax":      "pids.max",
+		}
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		return f.write(u, "", files[p.Name], maxOrNum(v, "max"))
+	case "CPUWeight":
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		if v == 0 {
+			// CPUWeight=idle.
+			return f.write(u, "", "cpu.idle", "1")
+		}
+		return f.write(u, "", "cpu.weight", strconv.FormatUint(v, 10))
+	case "CPUQuotaPerSecUSec", "CPUQuotaPeriodUSec":
+		quota, period := f.cpuQuota(u)
+		return f.write(u, "", "cpu.max", maxOrNum(quota, "max")+" "+strconv.FormatUint(period, 10))
+	case "AllowedCPUs", "AllowedMemoryNodes":
+		file := map[string]string{"AllowedCPUs": "cpuset.cpus", "AllowedMemoryNodes": "cpuset.mems"}[p.Name]
+		var b []byte
+		if err := p.Value.Store(&b); err != nil {
+			return err
+		}
+		return f.write(u, "", file, bitsToRange(b))
+	case "IOWeight":
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		return f.write(u, "", "io.weight", "default "+strconv.FormatUint(v, 10))
+	}
+	return nil
+}
+
+func (f *Fake) applyV1(u *Unit, p systemdDbus.Property) error {
+	switch p.Name {
+	case "MemoryLimit":
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		return f.write(u, "memory", "memory.limit_in_bytes", maxOrNum(v, "-1"))
+	case "CPUShares":
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		return f.write(u, "cpu", "cpu.shares", strconv.FormatUint(v, 10))
+	case "CPUQuotaPerSecUSec", "CPUQuotaPeriodUSec":
+		quota, period := f.cpuQuota(u)
+		if err := f.write(u, "cpu", "cpu.cfs_period_us", strconv.FormatUint(period, 10)); err != nil {
+			return err
+		}
+		return f.write(u, "cpu", "cpu.cfs_quota_us", maxOrNum(quota, "-1"))
+	case "BlockIOWeight":
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		return f.write(u, "blkio", "blkio.weight", strconv.FormatUint(v, 10))
+	case "TasksMax":
+		v, err := uint64Value(p)
+		if err != nil {
+			return err
+		}
+		return f.write(u, "pids", "pids.max", maxOrNum(v, "max"))
+	case "AllowedCPUs", "AllowedMemoryNodes":
+		file := map[string]string{"AllowedCPUs": "cpuset.cpus", "AllowedMemoryNodes": "cpuset.mems"}[p.Name]
+		var b []byte
+		if err := p.Value.Store(&b); err != nil {
+			return err
+		}
+		return f.write(u, "cpuset", file, bitsToRange(b))
+	}
+	return nil
+}
+
+// cpuQuota returns the CPU quota (math.MaxUint64 if unlimited) and
+// period, in microseconds, according to the unit's properties.
+func (f *Fake) cpuQuota(u *Unit) (quota, period uint64) {
+	perSec, period := uint64(math.MaxUint64), uint64(100000)
+	if v, ok := u.Properties["CPUQuotaPerSecUSec"]; ok {
+		_ = v.Store(&perSec)
+	}
+	if v, ok := u.Properties["CPUQuotaPeriodUSec"]; ok {
+		_ = v.Store(&period)
+	}
+	if perSec == math.MaxUint64 {
+		return perSec, period
+	}
+	return perSec * period / 1000000, period
+}
+
+func uint64Value(p systemdDbus.Property) (uint64, error) {
+	var v uint64
+	err := p.Value.Store(&v)
+	return v, err
+}
+
+func maxOrNum(v uint64, max string) string {
+	if v == math.MaxUint64 {
+		return max
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// bitsToRange is the reverse of systemd.RangeToBits.
+func bitsToRange(b []byte) string {
+	var (
+		ranges []string
+		start  = -1
+	)
+	flush := func(end int) {
+		if start == -1 {
+			return
+		}
+		if start == end {
+			ranges = append(ranges, strconv.Itoa(start))
+		} else {
+			ranges = append(ranges, strconv.Itoa(start)+"-"+strconv.Itoa(end))
+		}
+		start = -1
+	}
+	for i := range len(b) * 8 {
+		if b[i/8]&(1<<(i%8)) != 0 {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		flush(i - 1)
+	}
+	flush(len(b)*8 - 1)
+	return strings.Join(ranges, ",")
+}
@@ -6,12 +6,14 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/sirupsen/logrus"
 
 	"github.com/opencontainers/cgroups"
 	"github.com/opencontainers/cgroups/fs"
+	"github.com/opencontainers/cgroups/fscommon"
 )
 
 type LegacyManager struct {
@@ -19,26 +21,42 @@ type LegacyManager struct {
 	cgroups *cgroups.Cgroup
 	paths   map[string]string
 	dbus    *dbusConnManager
+	// attached is set for a manager of an existing unit (see Attach).
+	attached bool
 }
 
 func NewLegacyManager(cg *cgroups.Cgroup, paths map[string]string) (*LegacyManager, error) {
+	return newLegacyManager(cg, paths, newDbusConnManager(false))
+}
+
+// NewLegacyManagerWithBackend is like [NewLegacyManager], but the manager
+// uses b rather than a D-Bus connection to systemd. The backend is closed
+// by [LegacyManager.Close].
+func NewLegacyManagerWithBackend(cg *cgroups.Cgroup, paths map[string]string, b Backend) (*LegacyManager, error) {
+	return newLegacyManager(cg, paths, newBackendConnManager(b))
+}
+
+func newLegacyManager(cg *cgroups.Cgroup, paths map[string]string, cm *dbusConnManager) (*LegacyManager, error) {
 	if cg.Rootless {
+		cm.close()
 		return nil, errors.New("cannot use rootless systemd cgroups manager on cgroup v1")
 	}
 	if cg.Resources != nil && cg.Resources.Unified != nil {
+		cm.close()
 		return nil, cgroups.ErrV1NoUnified
 	}
 	if paths == nil {
 		var err error
 		paths, err = initPaths(cg)
 		if err != nil {
+			cm.close()
 			return nil, err
 		}
 	}
 	return &LegacyManager{
 		cgroups: cg,
 		paths:   paths,
-		dbus:    newDbusConnManager(false),
+		dbus:    cm,
 	}, nil
 }
 
@@ -49,6 +67,8 @@ type subsystem interface {
 	GetStats(path string, stats *cgroups.Stats) error
 	// Set sets cgroup resource limits.
 	Set(path string, r *cgroups.Resources) error
+	// SetWith is like Set, but the cgroup files are written via w.
+	SetWith(w fscommon.Writer, path string, r *cgroups.Resources) error
 }
 
 var errSubsystemDoesNotExist = errors.New("cgroup: subsystem does not exist")
@@ -121,8 +141,12 @@ func initPaths(c *cgroups.Cgroup) (map[string]string, error) {
 		}
 	}
 
-	unit := getUnitName(c)
+	return subsystemPaths(slice, getUnitName(c))
+}
 
+// subsystemPaths returns paths to cgroups of a unit in a slice,
+// for every cgroup v1 subsystem which is available.
+func subsystemPaths(slice, unit string) (map[string]string, error) {
 	paths := make(map[string]string)
 	for _, s := range legacySubsystems {
 		subsystemPath, err := getSubsystemPath(slice, unit, s.Name())
@@ -168,6 +192,18 @@ func (m *LegacyManager) Apply(pid int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.attached {
+		// The unit is already started, so just add the process
+		// to its cgroups (including the systemd one).
+		if err := m.joinCgroups(pid); err != nil {
+			return err
+		}
+		if path, ok := m.paths["name=systemd"]; ok {
+			return cgroups.WriteCgroupProc(path, pid)
+		}
+		return nil
+	}
+
 	if c.Parent != "" {
 		slice = c.Parent
 	}
@@ -178,14 +214,21 @@ func (m *LegacyManager) Apply(pid int) error {
 		// If we create a slice, the parent is defined via a Wants=.
 		properties = append(properties, systemdDbus.PropWants(slice))
 	} else {
-		// Otherwise it's a scope, which we put into a Slice=.
+		// Otherwise it's a scope or a service, which we put into a Slice=.
 		properties = append(properties, systemdDbus.PropSlice(slice))
-		// Assume scopes always support delegation (supported since systemd v218).
+		// Assume scopes and services always support delegation
+		// (supported since systemd v218).
 		properties = append(properties, newProp("Delegate", true))
 	}
 
-	// only add pid if its valid, -1 is used w/ general slice creation.
-	if pid != -1 {
+	if c.Service != nil {
+		// systemd starts the service process; any other
+		// process is added to the cgroup once it is created.
+		if err := addServiceProperties(&properties, c); err != nil {
+			return err
+		}
+	} else if pid != -1 {
+		// only add pid if its valid, -1 is used w/ general slice creation.
 		properties = append(properties, newProp("PIDs", []uint32{uint32(pid)}))
 	}
 
@@ -203,8 +246,13 @@ func (m *LegacyManager) Apply(pid int) error {
 		newProp("DefaultDependencies", false))
 
 	properties = append(properties, c.SystemdProps...)
+	extraProps, err := convertProperties(m.dbus, c.SystemdProperties)
+	if err != nil {
+		return err
+	}
+	properties = append(properties, extraProps...)
 
-	if err := startUnit(m.dbus, unitName, properties, pid == -1); err != nil {
+	if err := startUnit(m.dbus, unitName, properties, pid == -1 && c.Service == nil); err != nil {
 		return err
 	}
 
@@ -231,6 +279,19 @@ func (m *LegacyManager) Destroy() error {
 	return stopErr
 }
 
+// Close releases the systemd dbus connection used by m. It does not
+// affect the unit or the cgroups. The manager must not be used after Close.
+func (m *LegacyManager) Close() error {
+	m.dbus.close()
+	return nil
+}
+
+// SetJobTimeout sets the time to wait for systemd to start or stop the
+// unit (30 seconds by default). A zero value means the default.
+func (m *LegacyManager) SetJobTimeout(timeout time.Duration) {
+	m.dbus.setJobTimeout(timeout)
+}
+
 func (m *LegacyManager) Path(subsys string) string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -334,6 +395,13 @@ func (m *LegacyManager) Set(r *cgroups.Resources) error {
 	if r.Unified != nil {
 		return cgroups.ErrV1NoUnified
 	}
+	if err := cgroups.CheckResourcesV1(r, cgroups.ManagerTypeSystemdLegacy); err != nil {
+		return err
+	}
+	if err := checkRollback(r, cgroups.ManagerTypeSystemdLegacy); err != nil {
+		return err
+	}
+	orig := r
 	// Use a copy since CpuQuota in r may be modified.
 	rCopy := *r
 	r = &rCopy
@@ -343,9 +411,16 @@ func (m *LegacyManager) Set(r *cgroups.Resources) error {
 	}
 
 	unitName := getUnitName(m.cgroups)
-	needsFreeze, needsThaw, err := m.freezeBeforeSet(unitName, r)
-	if err != nil {
-		return err
+	var needsFreeze, needsThaw bool
+	if m.devicesUnchanged(r) {
+		// The device rules are already in place, so there is no need
+		// to set (and thus to freeze for) the device properties.
+		properties = withoutDeviceProperties(properties)
+	} else {
+		needsFreeze, needsThaw, err = m.freezeBeforeSet(unitName, r)
+		if err != nil {
+			return err
+		}
 	}
 
 	if needsFreeze {
@@ -373,20 +448,72 @@ func (m *LegacyManager) Set(r *cgroups.Resources) error {
 		return setErr
 	}
 
+	if err := m.setSubsystems(fscommon.FileWriter{}, r); err != nil {
+		return err
+	}
+	m.cgroups.Resources = orig
+
+	return nil
+}
+
+// setSubsystems sets r in the subsystems' cgroups, writing the files
+// via w.
+func (m *LegacyManager) setSubsystems(w fscommon.Writer, r *cgroups.Resources) error {
 	for _, sys := range legacySubsystems {
 		// Get the subsystem path, but don't error out for not found cgroups.
 		path, ok := m.paths[sys.Name()]
 		if !ok {
 			continue
 		}
-		if err := sys.Set(path, r); err != nil {
+		if err := sys.SetWith(w, path, r); err != nil {
+			// The fs subsystems report themselves as the manager.
+			var ue *cgroups.UnsupportedError
+			if errors.As(err, &ue) {
+				ue.Manager = cgroups.ManagerTypeSystemdLegacy
+			}
 			return err
 		}
 	}
-
 	return nil
 }
 
+// Plan returns the unit property changes and the file writes Set would
+// perform to apply r, in order, without changing anything (see also
+// [fs.Manager.Plan]). Property values are in the D-Bus text format.
+// Freezing the container around the device property changes is not
+// included.
+func (m *LegacyManager) Plan(r *cgroups.Resources) ([]cgroups.Operation, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if r.Unified != nil {
+		return nil, cgroups.ErrV1NoUnified
+	}
+	if err := cgroups.CheckResourcesV1(r, cgroups.ManagerTypeSystemdLegacy); err != nil {
+		return nil, err
+	}
+	if err := checkRollback(r, cgroups.ManagerTypeSystemdLegacy); err != nil {
+		return nil, err
+	}
+	// Use a copy since CpuQuota in r may be modified.
+	rCopy := *r
+	r = &rCopy
+	properties, err := genV1ResourcesProperties(r, m.dbus)
+	if err != nil {
+		return nil, err
+	}
+	if m.devicesUnchanged(r) {
+		properties = withoutDeviceProperties(properties)
+	}
+
+	ops := planProperties(m.dbus, getUnitName(m.cgroups), properties)
+	rec := &fscommon.Recorder{}
+	if err := m.setSubsystems(rec, r); err != nil {
+		return nil, err
+	}
+	return append(ops, rec.Ops...), nil
+}
+
 func (m *LegacyManager) GetPaths() map[string]string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -397,6 +524,20 @@ func (m *LegacyManager) GetCgroups() (*cgroups.Cgroup, error) {
 	return m.cgroups, nil
 }
 
+// MarshalState returns the serialized state of m, from which the manager
+// can be restored (see [cgroups.State]).
+func (m *LegacyManager) MarshalState() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cgroups.MarshalState(cgroups.State{
+		Type:     cgroups.ManagerTypeSystemdLegacy,
+		Unit:     getUnitName(m.cgroups),
+		Paths:    m.paths,
+		Config:   m.cgroups,
+		Attached: m.attached,
+	})
+}
+
 func (m *LegacyManager) GetFreezerState() (cgroups.FreezerState, error) {
 	path, ok := m.paths["freezer"]
 	if !ok {
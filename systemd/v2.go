@@ -7,9 +7,11 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	securejoin "github.com/cyphar/filepath-securejoin"
@@ -30,20 +32,38 @@ type UnifiedManager struct {
 	path  string
 	dbus  *dbusConnManager
 	fsMgr cgroups.Manager
+	// attached is set for a manager of an existing unit (see Attach).
+	attached bool
+	// root is the cgroup v2 mountpoint, normally fs2.UnifiedMountpoint.
+	root string
 }
 
 func NewUnifiedManager(config *cgroups.Cgroup, path string) (*UnifiedManager, error) {
+	return newUnifiedManager(config, path, newDbusConnManager(config.Rootless), fs2.UnifiedMountpoint)
+}
+
+// NewUnifiedManagerWithBackend is like [NewUnifiedManager], but the
+// manager uses b rather than a D-Bus connection to systemd. The backend
+// is closed by [UnifiedManager.Close].
+func NewUnifiedManagerWithBackend(config *cgroups.Cgroup, path string, b Backend) (*UnifiedManager, error) {
+	return newUnifiedManager(config, path, newBackendConnManager(b), cgroupRoot(b))
+}
+
+func newUnifiedManager(config *cgroups.Cgroup, path string, cm *dbusConnManager, root string) (*UnifiedManager, error) {
 	m := &UnifiedManager{
 		cgroups: config,
 		path:    path,
-		dbus:    newDbusConnManager(config.Rootless),
+		dbus:    cm,
+		root:    root,
 	}
 	if err := m.initPath(); err != nil {
+		m.dbus.close()
 		return nil, err
 	}
 
-	fsMgr, err := fs2.NewManager(config, m.path)
+	fsMgr, err := fs2.NewManagerWithType(config, m.path, cgroups.ManagerTypeSystemd)
 	if err != nil {
+		m.dbus.close()
 		return nil, err
 	}
 	m.fsMgr = fsMgr
@@ -63,7 +83,8 @@ func shouldSetCPUIdle(cm *dbusConnManager, v string) bool {
 // key/value map (where key is cgroupfs file name) to systemd unit properties.
 // This is on a best-effort basis, so the properties that are not known
 // (to this function and/or systemd) are ignored (but logged with "debug"
-// log level).
+// log level). The keys which are converted, and the systemd versions
+// required, are listed in unifiedSystemdVersion.
 //
 // For the list of keys, see https://www.kernel.org/doc/Documentation/cgroup-v2.txt
 //
@@ -71,6 +92,10 @@ func shouldSetCPUIdle(cm *dbusConnManager, v string) bool {
 func unifiedResToSystemdProps(cm *dbusConnManager, res map[string]string) (props []systemdDbus.Property, _ error) {
 	var err error
 
+	// Per-device io properties, gathered from all the lines of
+	// io.* values.
+	ioProps := make(map[string][]ioDeviceValue)
+
 	for k, v := range res {
 		if strings.Contains(k, "/") {
 			return nil, fmt.Errorf("unified resource %q must be a file name (no slashes)", k)
@@ -78,6 +103,13 @@ func unifiedResToSystemdProps(cm *dbusConnManager, res map[string]string) (props
 		if strings.IndexByte(k, '.') <= 0 {
 			return nil, fmt.Errorf("unified resource %q must be in the form CONTROLLER.PARAMETER", k)
 		}
+		if minVer := unifiedSystemdVersion[k]; minVer > 0 {
+			if sdVer := systemdVersion(cm); sdVer < minVer {
+				logrus.Debugf("systemd v%d is too old to support unified resource %q"+
+					" (setting will still be applied to cgroupfs)", sdVer, k)
+				continue
+			}
+		}
 		// Kernel is quite forgiving to extra whitespace
 		// around the value, and so should we.
 		v = strings.TrimSpace(v)
@@ -138,15 +170,74 @@ func unifiedResToSystemdProps(cm *dbusConnManager, res map[string]string) (props
 				"cpuset.cpus": "AllowedCPUs",
 				"cpuset.mems": "AllowedMemoryNodes",
 			}
-			// systemd only supports these properties since v244
-			sdVer := systemdVersion(cm)
-			if sdVer >= 244 {
-				props = append(props,
-					newProp(m[k], bits))
-			} else {
-				logrus.Debugf("systemd v%d is too old to support %s"+
-					" (setting will still be applied to cgroupfs)",
-					sdVer, m[k])
+			props = append(props,
+				newProp(m[k], bits))
+
+		case "io.latency":
+			// value: MAJ:MIN target=USEC, one device per line
+			for _, line := range strings.Split(v, "\n") {
+				dev, params, err := parseIODeviceLine(line)
+				if err != nil {
+					return nil, fmt.Errorf("unified resource %q value invalid: %w", k, err)
+				}
+				if dev == "" {
+					continue
+				}
+				target, ok := params["target"]
+				if !ok || len(params) != 1 {
+					return nil, fmt.Errorf("unified resource %q value invalid: %q", k, line)
+				}
+				ioProps["IODeviceLatencyTargetUSec"] = append(ioProps["IODeviceLatencyTargetUSec"],
+					ioDeviceValue{Path: dev, Value: target})
+			}
+
+		case "io.max":
+			// value: MAJ:MIN [rbps=N] [wbps=N] [riops=N] [wiops=N], one device per line
+			m := map[string]string{
+				"rbps":  "IOReadBandwidthMax",
+				"wbps":  "IOWriteBandwidthMax",
+				"riops": "IOReadIOPSMax",
+				"wiops": "IOWriteIOPSMax",
+			}
+			for _, line := range strings.Split(v, "\n") {
+				dev, params, err := parseIODeviceLine(line)
+				if err != nil {
+					return nil, fmt.Errorf("unified resource %q value invalid: %w", k, err)
+				}
+				for key, num := range params {
+					name, ok := m[key]
+					if !ok {
+						return nil, fmt.Errorf("unified resource %q value invalid: unknown key %q", k, key)
+					}
+					ioProps[name] = append(ioProps[name], ioDeviceValue{Path: dev, Value: num})
+				}
+			}
+
+		case "io.weight":
+			// value: [default] WEIGHT, or MAJ:MIN WEIGHT, one per line
+			for _, line := range strings.Split(v, "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					continue
+				}
+				if len(fields) > 2 {
+					return nil, fmt.Errorf("unified resource %q value invalid: %q", k, line)
+				}
+				num, err := strconv.ParseUint(fields[len(fields)-1], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("unified resource %q value conversion error: %w", k, err)
+				}
+				if len(fields) == 1 || fields[0] == "default" {
+					props = append(props,
+						newProp("IOWeight", num))
+					continue
+				}
+				dev, err := blockDevicePath(fields[0])
+				if err != nil {
+					return nil, fmt.Errorf("unified resource %q value invalid: %w", k, err)
+				}
+				ioProps["IODeviceWeight"] = append(ioProps["IODeviceWeight"],
+					ioDeviceValue{Path: dev, Value: num})
 			}
 
 		case "memory.high", "memory.low", "memory.min", "memory.max", "memory.swap.max":
@@ -167,6 +258,29 @@ func unifiedResToSystemdProps(cm *dbusConnManager, res map[string]string) (props
 			props = append(props,
 				newProp(m[k], num))
 
+		case "memory.zswap.max":
+			num := uint64(math.MaxUint64)
+			if v != "max" {
+				num, err = strconv.ParseUint(v, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("unified resource %q value conversion error: %w", k, err)
+				}
+			}
+			props = append(props,
+				newProp("MemoryZSwapMax", num))
+
+		case "memory.zswap.writeback":
+			var wb bool
+			switch v {
+			case "0":
+			case "1":
+				wb = true
+			default:
+				return nil, fmt.Errorf("unified resource %q value invalid: %q", k, v)
+			}
+			props = append(props,
+				newProp("MemoryZSwapWriteback", wb))
+
 		case "pids.max":
 			num := uint64(math.MaxUint64)
 			if v != "max" {
@@ -195,9 +309,135 @@ func unifiedResToSystemdProps(cm *dbusConnManager, res map[string]string) (props
 		}
 	}
 
+	for _, name := range ioDeviceProperties {
+		if list, ok := ioProps[name]; ok {
+			props = append(props,
+				newProp(name, list))
+		}
+	}
+
 	return props, nil
 }
 
+// unifiedSystemdVersion lists the unified resources which
+// unifiedResToSystemdProps converts to systemd unit properties, along
+// with the minimum systemd version supporting the properties (0 if the
+// properties are supported by all systemd versions with cgroup v2
+// support). Resources which are not listed are only set in cgroupfs.
+var unifiedSystemdVersion = map[string]int{
+	"cpu.idle":               cpuIdleSupportedVersion,
+	"cpu.max":                0,
+	"cpu.weight":             0,
+	"cpuset.cpus":            244,
+	"cpuset.mems":            244,
+	"io.latency":             240,
+	"io.max":                 0,
+	"io.weight":              0,
+	"memory.high":            0,
+	"memory.low":             0,
+	"memory.max":             0,
+	"memory.min":             240,
+	"memory.swap.max":        0,
+	"memory.zswap.max":       253,
+	"memory.zswap.writeback": 256,
+	"pids.max":               0,
+}
+
+// ioDeviceProperties are the per-device io unit properties, in the order
+// they are set.
+var ioDeviceProperties = []string{
+	"IODeviceWeight",
+	"IOReadBandwidthMax",
+	"IOWriteBandwidthMax",
+	"IOReadIOPSMax",
+	"IOWriteIOPSMax",
+	"IODeviceLatencyTargetUSec",
+}
+
+// ioDeviceValue is the element of a per-device io property, which is of
+// dbus type "a(st)".
+type ioDeviceValue struct {
+	Path  string
+	Value uint64
+}
+
+// blockDevicePath converts a MAJ:MIN device number to a device path
+// systemd accepts.
+func blockDevicePath(majMin string) (string, error) {
+	maj, min, ok := strings.Cut(majMin, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid device number %q", majMin)
+	}
+	for _, n := range []string{maj, min} {
+		if _, err := strconv.ParseUint(n, 10, 32); err != nil {
+			return "", fmt.Errorf("invalid device number %q", majMin)
+		}
+	}
+	return "/dev/block/" + majMin, nil
+}
+
+// blockDevicePathFor is like blockDevicePath, for a device number given
+// as major and minor numbers.
+func blockDevicePathFor(major, minor int64) string {
+	return fmt.Sprintf("/dev/block/%d:%d", major, minor)
+}
+
+// parseIODeviceLine parses a line of io.max or io.latency value, which
+// is in the form "MAJ:MIN KEY=VALUE...", into the device path and the
+// key/value pairs, with "max" values converted to math.MaxUint64.
+// For an empty line, an empty device path is returned.
+func parseIODeviceLine(line string) (string, map[string]uint64, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil, nil
+	}
+	dev, err := blockDevicePath(fields[0])
+	if err != nil {
+		return "", nil, err
+	}
+	params := make(map[string]uint64, len(fields)-1)
+	for _, f := range fields[1:] {
+		key, val, ok := strings.Cut(f, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("invalid parameter %q", f)
+		}
+		num := uint64(math.MaxUint64)
+		if val != "max" {
+			num, err = strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid parameter %q: %w", f, err)
+			}
+		}
+		params[key] = num
+	}
+	return dev, params, nil
+}
+
+// SplitUnifiedResources divides the keys of res (in the format of
+// [cgroups.Resources.Unified]) into the ones which Set translates to
+// systemd unit properties, and thus persist across systemd daemon-reload,
+// and the ones which are only written to cgroupfs (and can be reverted
+// by systemd). The result depends on the systemd version. Both returned
+// lists are sorted.
+func (m *UnifiedManager) SplitUnifiedResources(res map[string]string) (persistent, cgroupfsOnly []string) {
+	return splitUnifiedResources(res, systemdVersion(m.dbus))
+}
+
+func splitUnifiedResources(res map[string]string, sdVer int) (persistent, cgroupfsOnly []string) {
+	for k, v := range res {
+		minVer, ok := unifiedSystemdVersion[k]
+		// cpu.idle can only be set to 1 via systemd, see shouldSetCPUIdle.
+		if ok && (minVer == 0 || sdVer >= minVer) && (k != "cpu.idle" || strings.TrimSpace(v) == "1") {
+			persistent = append(persistent, k)
+		} else {
+			cgroupfsOnly = append(cgroupfsOnly, k)
+		}
+	}
+	sort.Strings(persistent)
+	sort.Strings(cgroupfsOnly)
+	return persistent, cgroupfsOnly
+}
+
 func genV2ResourcesProperties(dirPath string, r *cgroups.Resources, cm *dbusConnManager) ([]systemdDbus.Property, error) {
 	// We need this check before setting systemd properties, otherwise
 	// the container is OOM-killed and the systemd unit is removed
@@ -237,6 +477,17 @@ func genV2ResourcesProperties(dirPath string, r *cgroups.Resources, cm *dbusConn
 			newProp("MemorySwapMax", uint64(swap)))
 	}
 
+	// There is no systemd property for memory.swap.high, so it is only
+	// set by fsMgr.Set. Same for zswap settings for older systemd.
+	if r.MemoryZswapMax != nil && systemdVersion(cm) >= unifiedSystemdVersion["memory.zswap.max"] {
+		properties = append(properties,
+			newProp("MemoryZSwapMax", uint64(*r.MemoryZswapMax)))
+	}
+	if r.MemoryZswapWriteback != nil && systemdVersion(cm) >= unifiedSystemdVersion["memory.zswap.writeback"] {
+		properties = append(properties,
+			newProp("MemoryZSwapWriteback", *r.MemoryZswapWriteback))
+	}
+
 	idleSet := false
 	// The logic here is the same as in shouldSetCPUIdle.
 	if r.CPUIdle != nil && *r.CPUIdle == 1 && systemdVersion(cm) >= cpuIdleSupportedVersion {
@@ -266,6 +517,33 @@ func genV2ResourcesProperties(dirPath string, r *cgroups.Resources, cm *dbusConn
 		return nil, err
 	}
 
+	if len(r.IOWeightDevice) > 0 {
+		weights := make([]ioDeviceValue, 0, len(r.IOWeightDevice))
+		for _, wd := range r.IOWeightDevice {
+			weights = append(weights, ioDeviceValue{
+				Path:  blockDevicePathFor(wd.Major, wd.Minor),
+				Value: wd.Weight,
+			})
+		}
+		properties = append(properties,
+			newProp("IODeviceWeight", weights))
+	}
+	if len(r.IOLatencyDevice) > 0 && systemdVersion(cm) >= unifiedSystemdVersion["io.latency"] {
+		targets := make([]ioDeviceValue, 0, len(r.IOLatencyDevice))
+		for _, ld := range r.IOLatencyDevice {
+			target := ld.Target
+			if target == 0 {
+				target = math.MaxUint64
+			}
+			targets = append(targets, ioDeviceValue{
+				Path:  blockDevicePathFor(ld.Major, ld.Minor),
+				Value: target,
+			})
+		}
+		properties = append(properties,
+			newProp("IODeviceLatencyTargetUSec", targets))
+	}
+
 	// ignore r.KernelMemory
 
 	// convert Resources.Unified map to systemd properties
@@ -287,6 +565,11 @@ func (m *UnifiedManager) Apply(pid int) error {
 		properties []systemdDbus.Property
 	)
 
+	if m.attached {
+		// The unit is already started, so just add the process to it.
+		return cgroups.WriteCgroupProc(m.path, pid)
+	}
+
 	slice := "system.slice"
 	if m.cgroups.Rootless {
 		slice = "user.slice"
@@ -301,14 +584,21 @@ func (m *UnifiedManager) Apply(pid int) error {
 		// If we create a slice, the parent is defined via a Wants=.
 		properties = append(properties, systemdDbus.PropWants(slice))
 	} else {
-		// Otherwise it's a scope, which we put into a Slice=.
+		// Otherwise it's a scope or a service, which we put into a Slice=.
 		properties = append(properties, systemdDbus.PropSlice(slice))
-		// Assume scopes always support delegation (supported since systemd v218).
+		// Assume scopes and services always support delegation
+		// (supported since systemd v218).
 		properties = append(properties, newProp("Delegate", true))
 	}
 
-	// only add pid if its valid, -1 is used w/ general slice creation.
-	if pid != -1 {
+	if c.Service != nil {
+		// systemd starts the service process; any other
+		// process is added to the cgroup once it is created.
+		if err := addServiceProperties(&properties, c); err != nil {
+			return err
+		}
+	} else if pid != -1 {
+		// only add pid if its valid, -1 is used w/ general slice creation.
 		properties = append(properties, newProp("PIDs", []uint32{uint32(pid)}))
 	}
 
@@ -326,15 +616,26 @@ func (m *UnifiedManager) Apply(pid int) error {
 		newProp("DefaultDependencies", false))
 
 	properties = append(properties, c.SystemdProps...)
+	extraProps, err := convertProperties(m.dbus, c.SystemdProperties)
+	if err != nil {
+		return err
+	}
+	properties = append(properties, extraProps...)
 
-	if err := startUnit(m.dbus, unitName, properties, pid == -1); err != nil {
+	if err := startUnit(m.dbus, unitName, properties, pid == -1 && c.Service == nil); err != nil {
 		return fmt.Errorf("unable to start unit %q (properties %+v): %w", unitName, properties, err)
 	}
 
-	if err := fs2.CreateCgroupPath(m.path, m.cgroups); err != nil {
+	if err := fs2.CreateCgroupPathAt(m.root, m.path, m.cgroups); err != nil {
 		return err
 	}
 
+	if c.Service != nil {
+		if err := cgroups.WriteCgroupProc(m.path, pid); err != nil {
+			return err
+		}
+	}
+
 	if c.OwnerUID != nil {
 		// The directory itself must be chowned.
 		err := os.Chown(m.path, *c.OwnerUID, -1)
@@ -402,6 +703,19 @@ func (m *UnifiedManager) Destroy() error {
 	return nil
 }
 
+// Close releases the systemd dbus connection used by m. It does not
+// affect the unit or the cgroup. The manager must not be used after Close.
+func (m *UnifiedManager) Close() error {
+	m.dbus.close()
+	return nil
+}
+
+// SetJobTimeout sets the time to wait for systemd to start or stop the
+// unit (30 seconds by default). A zero value means the default.
+func (m *UnifiedManager) SetJobTimeout(timeout time.Duration) {
+	m.dbus.setJobTimeout(timeout)
+}
+
 func (m *UnifiedManager) Path(_ string) string {
 	return m.path
 }
@@ -448,7 +762,7 @@ func (m *UnifiedManager) initPath() error {
 
 	c := m.cgroups
 	path := filepath.Join(sliceFull, getUnitName(c))
-	path, err = securejoin.SecureJoin(fs2.UnifiedMountpoint, path)
+	path, err = securejoin.SecureJoin(m.root, path)
 	if err != nil {
 		return err
 	}
@@ -480,6 +794,12 @@ func (m *UnifiedManager) Set(r *cgroups.Resources) error {
 	if r == nil {
 		return nil
 	}
+	if err := cgroups.CheckResourcesV2(r, cgroups.ManagerTypeSystemd); err != nil {
+		return err
+	}
+	if err := checkRollback(r, cgroups.ManagerTypeSystemd); err != nil {
+		return err
+	}
 	// Use a copy since CpuQuota in r may be modified.
 	rCopy := *r
 	r = &rCopy
@@ -492,7 +812,52 @@ func (m *UnifiedManager) Set(r *cgroups.Resources) error {
 		return fmt.Errorf("unable to set unit properties: %w", err)
 	}
 
-	return m.fsMgr.Set(r)
+	err = m.fsMgr.Set(r)
+	if err != nil && m.cgroups.Rootless && errors.Is(err, os.ErrNotExist) {
+		// Most probably, some controllers are not delegated;
+		// if so, report which ones instead of a missing file.
+		if dErr := m.CheckDelegation(r); dErr != nil {
+			var de *DelegationError
+			if errors.As(dErr, &de) {
+				return dErr
+			}
+		}
+	}
+	return err
+}
+
+// Plan returns the unit property changes and the file writes Set would
+// perform to apply r, in order, without changing anything (see also
+// [fs2.Manager.Plan]). Property values are in the D-Bus text format.
+func (m *UnifiedManager) Plan(r *cgroups.Resources) ([]cgroups.Operation, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if err := cgroups.CheckResourcesV2(r, cgroups.ManagerTypeSystemd); err != nil {
+		return nil, err
+	}
+	if err := checkRollback(r, cgroups.ManagerTypeSystemd); err != nil {
+		return nil, err
+	}
+	// Use a copy since CpuQuota in r may be modified.
+	rCopy := *r
+	r = &rCopy
+	properties, err := genV2ResourcesProperties(m.fsMgr.Path(""), r, m.dbus)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := planProperties(m.dbus, getUnitName(m.cgroups), properties)
+
+	fsMgr, ok := m.fsMgr.(*fs2.Manager)
+	if !ok {
+		return nil, errors.New("can't plan cgroup file writes")
+	}
+	fsOps, err := fsMgr.Plan(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(ops, fsOps...), nil
 }
 
 func (m *UnifiedManager) GetPaths() map[string]string {
@@ -505,6 +870,18 @@ func (m *UnifiedManager) GetCgroups() (*cgroups.Cgroup, error) {
 	return m.cgroups, nil
 }
 
+// MarshalState returns the serialized state of m, from which the manager
+// can be restored (see [cgroups.State]).
+func (m *UnifiedManager) MarshalState() ([]byte, error) {
+	return cgroups.MarshalState(cgroups.State{
+		Type:     cgroups.ManagerTypeSystemd,
+		Unit:     getUnitName(m.cgroups),
+		Paths:    m.GetPaths(),
+		Config:   m.cgroups,
+		Attached: m.attached,
+	})
+}
+
 func (m *UnifiedManager) GetFreezerState() (cgroups.FreezerState, error) {
 	return m.fsMgr.GetFreezerState()
 }
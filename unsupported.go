@@ -0,0 +1,108 @@
+package cgroups
+
+import (
+	"errors"
+	"slices"
+)
+
+// UnsupportedError is returned by cgroup managers' Set method when a
+// [Resources] field is set which can not be applied by the manager, or
+// by a method the manager does not implement. It matches
+// [errors.ErrUnsupported].
+type UnsupportedError struct {
+	// Manager is the cgroup manager type (one of ManagerType* constants).
+	Manager string
+	// Field is the name of the Resources field, or empty if the
+	// operation itself is not supported.
+	Field string
+	// Reason optionally explains why the field is not supported (e.g.
+	// the kernel is too old).
+	Reason string
+}
+
+func (e *UnsupportedError) Error() string {
+	what := "cgroup resource " + e.Field
+	if e.Field == "" {
+		what = "operation"
+	}
+	msg := what + " is not supported by " + e.Manager + " cgroup manager"
+	if e.Reason != "" {
+		msg += " (" + e.Reason + ")"
+	}
+	return msg
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return errors.ErrUnsupported
+}
+
+// CheckResourcesV1 returns an [*UnsupportedError] if r has a field set
+// which can not be applied on cgroup v1 by a manager of type typ. Note
+// that r.Unified is reported as [ErrV1NoUnified] by the managers, and
+// CpuWeight is ignored if CpuShares is set.
+func CheckResourcesV1(r *Resources, typ string) error {
+	if fields := unsupportedV1(r); len(fields) > 0 {
+		return &UnsupportedError{Manager: typ, Field: fields[0]}
+	}
+	return nil
+}
+
+// CheckResourcesV2 returns an [*UnsupportedError] if r has a field set
+// which can not be applied on cgroup v2 by a manager of type typ. Note
+// that CpuShares is ignored if CpuWeight is set (see
+// [ConvertCPUSharesToCgroupV2Value]).
+func CheckResourcesV2(r *Resources, typ string) error {
+	if fields := unsupportedV2(r); len(fields) > 0 {
+		return &UnsupportedError{Manager: typ, Field: fields[0]}
+	}
+	return nil
+}
+
+// unsupportedV1 returns the names of fields set in r which can not be
+// applied on cgroup v1 (except Unified).
+func unsupportedV1(r *Resources) []string {
+	var fields []string
+	if r.CpuWeight != 0 && r.CpuShares == 0 {
+		fields = append(fields, "CpuWeight")
+	}
+	if len(r.IOWeightDevice) > 0 {
+		fields = append(fields, "IOWeightDevice")
+	}
+	if len(r.IOLatencyDevice) > 0 {
+		fields = append(fields, "IOLatencyDevice")
+	}
+	if r.MemorySwapHigh != nil {
+		fields = append(fields, "MemorySwapHigh")
+	}
+	if r.MemoryZswapMax != nil {
+		fields = append(fields, "MemoryZswapMax")
+	}
+	if r.MemoryZswapWriteback != nil {
+		fields = append(fields, "MemoryZswapWriteback")
+	}
+	return fields
+}
+
+// unsupportedV2 returns the names of fields set in r which can not be
+// applied on cgroup v2.
+func unsupportedV2(r *Resources) []string {
+	var fields []string
+	add := func(name string, set bool) {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	add("CpuShares", r.CpuShares != 0 && r.CpuWeight == 0)
+	add("CpuRtPeriod", r.CpuRtPeriod != 0)
+	add("CpuRtRuntime", r.CpuRtRuntime != 0)
+	add("BlkioLeafWeight", r.BlkioLeafWeight != 0)
+	// Per-device leaf weights are only supported by CFQ on cgroup v1.
+	add("BlkioWeightDevice", slices.ContainsFunc(r.BlkioWeightDevice, func(wd *WeightDevice) bool {
+		return wd.LeafWeight != 0
+	}))
+	add("OomKillDisable", r.OomKillDisable)
+	add("MemorySwappiness", r.MemorySwappiness != nil && int64(*r.MemorySwappiness) != -1)
+	add("NetClsClassid", r.NetClsClassid != 0)
+	add("NetPrioIfpriomap", len(r.NetPrioIfpriomap) > 0)
+	return fields
+}
@@ -471,6 +471,25 @@ func ConvertMemorySwapToCgroupV2Value(memorySwap, memory int64) (int64, error) {
 	return memorySwap - memory, nil
 }
 
+// ConvertIOWeightToBFQWeight converts the cgroup v2 io.weight value
+// ([1-10000], 100 is the default) to io.bfq.weight value ([1-1000], 100
+// is the default), the same way systemd does it: the values below and
+// above the default are scaled linearly, so the default is preserved.
+func ConvertIOWeightToBFQWeight(weight uint64) uint64 {
+	const (
+		defWeight = 100
+		minWeight = 1
+		maxWeight = 10000
+		bfqMin    = 1
+		bfqMax    = 1000
+	)
+	weight = min(max(weight, minWeight), maxWeight)
+	if weight <= defWeight {
+		return defWeight - (defWeight-weight)*(defWeight-bfqMin)/(defWeight-minWeight)
+	}
+	return defWeight + (weight-defWeight)*(bfqMax-defWeight)/(maxWeight-defWeight)
+}
+
 // Since the OCI spec is designed for cgroup v1, in some cases
 // there is need to convert from the cgroup v1 configuration to cgroup v2
 // the formula for BlkIOWeight to IOWeight is y = (1 + (x - 10) * 9999 / 990)
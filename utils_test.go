@@ -698,3 +698,21 @@ func TestRemovePathReadOnly(t *testing.T) {
 		t.Fatalf("expected the error of removing a non-existent dir %s in a ro mount point with RemovePath to be nil, but got: %v", nonExistentDir, err)
 	}
 }
+
+func TestConvertIOWeightToBFQWeight(t *testing.T) {
+	cases := map[uint64]uint64{
+		0:     1, // Below the minimum (out of range).
+		1:     1,
+		50:    50,
+		100:   100,
+		5050:  550,
+		10000: 1000,
+		20000: 1000, // Above the maximum (out of range).
+	}
+	for i, expected := range cases {
+		got := ConvertIOWeightToBFQWeight(i)
+		if got != expected {
+			t.Errorf("expected ConvertIOWeightToBFQWeight(%d) to be %d, got %d", i, expected, got)
+		}
+	}
+}
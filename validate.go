@@ -0,0 +1,248 @@
+package cgroups
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HostInfo describes the host properties against which [ValidateResources]
+// checks resources.
+type HostInfo struct {
+	// Unified tells whether cgroup v2 unified hierarchy is used.
+	Unified bool
+	// OnlineCPUs and OnlineMems are online CPUs and memory nodes, in
+	// the cpuset list format (e.g. "0-3,8"). If empty, CpusetCpus and
+	// CpusetMems are not checked against them.
+	OnlineCPUs string
+	OnlineMems string
+	// HugePageSizes are the huge page sizes supported by the host (see
+	// [HugePageSizes]). If nil, HugetlbLimit page sizes are not checked.
+	HugePageSizes []string
+}
+
+// GetHostInfo returns the information about the current host, for use
+// with [ValidateResources]. Fields which can not be obtained are left
+// empty, so the corresponding checks are skipped.
+func GetHostInfo() *HostInfo {
+	h := &HostInfo{
+		Unified:       IsCgroup2UnifiedMode(),
+		HugePageSizes: HugePageSizes(),
+	}
+	if data, err := os.ReadFile("/sys/devices/system/cpu/online"); err == nil {
+		h.OnlineCPUs = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile("/sys/devices/system/node/online"); err == nil {
+		h.OnlineMems = strings.TrimSpace(string(data))
+	}
+	return h
+}
+
+// ResourceError describes an invalid [Resources] field value.
+type ResourceError struct {
+	// Field is the name of the Resources field, e.g. "CpuWeight",
+	// or "Unified[cpu.max]" for a Unified key.
+	Field string
+	// Reason explains what is wrong with the value.
+	Reason string
+}
+
+func (e *ResourceError) Error() string {
+	return "invalid " + e.Field + ": " + e.Reason
+}
+
+// ValidateResources checks r for invalid values (out of range or
+// malformed), inconsistent fields, values not matching the host (as
+// described by host), and fields not supported by the cgroup version
+// used, without applying anything. This allows to catch errors which
+// otherwise only happen in the middle of [Manager.Set], when some of
+// the resources are already applied.
+//
+// The returned error, if any, wraps a [*ResourceError] for every problem
+// found (see [errors.Join]).
+func ValidateResources(r *Resources, host *HostInfo) error {
+	if r == nil {
+		return nil
+	}
+	if host == nil {
+		host = &HostInfo{}
+	}
+
+	var errs []error
+	report := func(field, format string, args ...any) {
+		errs = append(errs, &ResourceError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+	limit := func(field string, v int64) {
+		if v < -1 {
+			report(field, "%d is negative (use -1 for unlimited)", v)
+		}
+	}
+	inRange := func(field string, v, lo, hi uint64) {
+		if v != 0 && (v < lo || v > hi) {
+			report(field, "%d is out of range [%d-%d]", v, lo, hi)
+		}
+	}
+
+	// Memory.
+	limit("Memory", r.Memory)
+	limit("MemoryReservation", r.MemoryReservation)
+	limit("MemorySwap", r.MemorySwap)
+	if _, err := ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory); err != nil && r.Memory >= -1 {
+		report("MemorySwap", "%v", err)
+	}
+	if r.MemorySwappiness != nil && int64(*r.MemorySwappiness) != -1 && *r.MemorySwappiness > 100 {
+		report("MemorySwappiness", "%d is out of range [0-100]", *r.MemorySwappiness)
+	}
+
+	// CPU.
+	inRange("CpuShares", r.CpuShares, 2, 262144)
+	inRange("CpuWeight", r.CpuWeight, 1, 10000)
+	if r.CpuQuota < -1 || (r.CpuQuota > 0 && r.CpuQuota < 1000) {
+		report("CpuQuota", "%d is out of range (must be -1, or at least 1000)", r.CpuQuota)
+	}
+	inRange("CpuPeriod", r.CpuPeriod, 1000, 1000000)
+	if r.CpuBurst != nil && r.CpuQuota > 0 && *r.CpuBurst > uint64(r.CpuQuota) {
+		report("CpuBurst", "%d is greater than CpuQuota %d", *r.CpuBurst, r.CpuQuota)
+	}
+	if r.CpuRtRuntime > 0 && r.CpuRtPeriod != 0 && uint64(r.CpuRtRuntime) > r.CpuRtPeriod {
+		report("CpuRtRuntime", "%d is greater than CpuRtPeriod %d", r.CpuRtRuntime, r.CpuRtPeriod)
+	}
+	if r.CPUIdle != nil && *r.CPUIdle != 0 && *r.CPUIdle != 1 {
+		report("CPUIdle", "%d is not 0 or 1", *r.CPUIdle)
+	}
+
+	// Cpuset.
+	for _, c := range []struct{ field, value, online string }{
+		{"CpusetCpus", r.CpusetCpus, host.OnlineCPUs},
+		{"CpusetMems", r.CpusetMems, host.OnlineMems},
+	} {
+		if c.value == "" {
+			continue
+		}
+		ranges, err := parseListRanges(c.value)
+		if err != nil {
+			report(c.field, "%q: %v", c.value, err)
+			continue
+		}
+		if c.online == "" {
+			continue
+		}
+		online, err := parseListRanges(c.online)
+		if err != nil {
+			continue
+		}
+		if !rangesContain(online, ranges) {
+			report(c.field, "%q is not a subset of online %q", c.value, c.online)
+		}
+	}
+
+	// Pids.
+	limit("PidsLimit", r.PidsLimit)
+
+	// Block IO.
+	inRange("BlkioWeight", uint64(r.BlkioWeight), 10, 1000)
+	inRange("BlkioLeafWeight", uint64(r.BlkioLeafWeight), 10, 1000)
+	for _, wd := range r.BlkioWeightDevice {
+		inRange("BlkioWeightDevice", uint64(wd.Weight), 10, 1000)
+		inRange("BlkioWeightDevice", uint64(wd.LeafWeight), 10, 1000)
+	}
+	for _, wd := range r.IOWeightDevice {
+		inRange("IOWeightDevice", wd.Weight, 1, 10000)
+	}
+
+	// RDMA.
+	for _, dev := range slices.Sorted(maps.Keys(r.Rdma)) {
+		l := r.Rdma[dev]
+		for _, v := range []*uint32{l.HcaHandles, l.HcaObjects} {
+			if v != nil && *v > math.MaxInt32 && *v != RdmaUnlimited {
+				report("Rdma["+dev+"]", "%d is out of range (must be at most %d, or RdmaUnlimited)", *v, math.MaxInt32)
+			}
+		}
+	}
+
+	// Hugetlb.
+	for _, l := range r.HugetlbLimit {
+		if host.HugePageSizes != nil && !slices.Contains(host.HugePageSizes, l.Pagesize) {
+			report("HugetlbLimit", "page size %q is not supported (supported: %s)", l.Pagesize, strings.Join(host.HugePageSizes, ", "))
+		}
+	}
+
+	// Unified.
+	for _, k := range slices.Sorted(maps.Keys(r.Unified)) {
+		field := "Unified[" + k + "]"
+		if strings.Contains(k, "/") {
+			report(field, "key contains a slash")
+		} else if !strings.Contains(k, ".") || strings.HasPrefix(k, ".") || strings.HasSuffix(k, ".") {
+			report(field, "key is not a cgroup file name (controller.file)")
+		}
+	}
+
+	// Cgroup version specific fields.
+	if host.Unified {
+		for _, f := range unsupportedV2(r) {
+			report(f, "not supported on cgroup v2")
+		}
+	} else {
+		for _, f := range unsupportedV1(r) {
+			report(f, "not supported on cgroup v1")
+		}
+		if r.Unified != nil {
+			report("Unified", "not supported on cgroup v1")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseListRanges parses a list in the cpuset format (e.g. "0-3,8")
+// into a list of ranges.
+func parseListRanges(list string) ([][2]uint64, error) {
+	var ranges [][2]uint64
+	for _, s := range strings.Split(strings.TrimSpace(list), ",") {
+		fromStr, toStr, isRange := strings.Cut(s, "-")
+		from, err := strconv.ParseUint(fromStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad element %q", s)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.ParseUint(toStr, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad element %q", s)
+			}
+			if from > to {
+				return nil, fmt.Errorf("bad range %q (start > end)", s)
+			}
+		}
+		ranges = append(ranges, [2]uint64{from, to})
+	}
+	return ranges, nil
+}
+
+// rangesContain answers whether every range in sub is within set.
+func rangesContain(set, sub [][2]uint64) bool {
+	// Once adjacent and overlapping ranges are merged,
+	// every range of sub must be within a single range of set.
+	set = slices.Clone(set)
+	slices.SortFunc(set, func(a, b [2]uint64) int { return cmp.Compare(a[0], b[0]) })
+	merged := set[:0]
+	for _, r := range set {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			merged[n-1][1] = max(merged[n-1][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	for _, r := range sub {
+		if !slices.ContainsFunc(merged, func(s [2]uint64) bool { return s[0] <= r[0] && r[1] <= s[1] }) {
+			return false
+		}
+	}
+	return true
+}
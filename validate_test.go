@@ -0,0 +1,138 @@
+package cgroups
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateResources(t *testing.T) {
+	host := &HostInfo{
+		Unified:       true,
+		OnlineCPUs:    "0-3,4-7,16",
+		OnlineMems:    "0",
+		HugePageSizes: []string{"2MB", "1GB"},
+	}
+	burst := uint64(200000)
+	idle := int64(2)
+	swappiness := uint64(60)
+	rdmaBad, rdmaMax := uint32(1<<31), RdmaUnlimited
+
+	for _, tc := range []struct {
+		name   string
+		r      *Resources
+		host   *HostInfo
+		fields []string
+	}{
+		{name: "nil", r: nil},
+		{
+			name: "valid",
+			r: &Resources{
+				Memory: 1 << 30, MemorySwap: 2 << 30, PidsLimit: -1,
+				CpuWeight: 100, CpuQuota: 50000, CpuPeriod: 100000,
+				CpusetCpus: "0-7,16", CpusetMems: "0",
+				HugetlbLimit: []*HugepageLimit{{Pagesize: "2MB", Limit: 1 << 21}},
+				Unified:      map[string]string{"memory.high": "max"},
+			},
+		},
+		{
+			name: "ranges",
+			r: &Resources{
+				Memory: -2, PidsLimit: -5, CpuWeight: 10001, CpuQuota: 500, CpuPeriod: 100,
+				BlkioWeight: 5, CPUIdle: &idle,
+			},
+			fields: []string{"Memory", "CpuWeight", "CpuQuota", "CpuPeriod", "CPUIdle", "PidsLimit", "BlkioWeight"},
+		},
+		{
+			name:   "cross-field",
+			r:      &Resources{Memory: 2 << 30, MemorySwap: 1 << 30, CpuQuota: 100000, CpuBurst: &burst},
+			fields: []string{"MemorySwap", "CpuBurst"},
+		},
+		{
+			name:   "swap without memory",
+			r:      &Resources{MemorySwap: 1 << 30},
+			fields: []string{"MemorySwap"},
+		},
+		{
+			name:   "cpuset",
+			r:      &Resources{CpusetCpus: "0-3,8", CpusetMems: "1-0"},
+			fields: []string{"CpusetCpus", "CpusetMems"},
+		},
+		{
+			name:   "cpuset malformed",
+			r:      &Resources{CpusetCpus: "0,,1"},
+			host:   &HostInfo{Unified: true},
+			fields: []string{"CpusetCpus"},
+		},
+		{
+			name:   "hugetlb",
+			r:      &Resources{HugetlbLimit: []*HugepageLimit{{Pagesize: "4MB"}, {Pagesize: "1GB"}}},
+			fields: []string{"HugetlbLimit"},
+		},
+		{
+			name: "rdma",
+			r: &Resources{Rdma: map[string]LinuxRdma{
+				"mlx5_0": {HcaHandles: &rdmaMax},
+				"mlx5_1": {HcaObjects: &rdmaBad},
+			}},
+			fields: []string{"Rdma[mlx5_1]"},
+		},
+		{
+			name:   "unified keys",
+			r:      &Resources{Unified: map[string]string{"../cpu.max": "1", "cpumax": "1", "io.max": "x"}},
+			fields: []string{"Unified[../cpu.max]", "Unified[cpumax]"},
+		},
+		{
+			name:   "v2-only fields on v2",
+			r:      &Resources{CpuShares: 1024, MemorySwappiness: &swappiness, OomKillDisable: true},
+			fields: []string{"CpuShares", "OomKillDisable", "MemorySwappiness"},
+		},
+		{
+			name:   "v1",
+			r:      &Resources{CpuWeight: 100, CpuShares: 1, Unified: map[string]string{"memory.high": "1"}},
+			host:   &HostInfo{},
+			fields: []string{"CpuShares", "Unified"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := host
+			if tc.host != nil {
+				h = tc.host
+			}
+			err := ValidateResources(tc.r, h)
+			var fields []string
+			if err != nil {
+				for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+					var re *ResourceError
+					if !errors.As(e, &re) {
+						t.Fatalf("expected ResourceError, got %v", e)
+					}
+					fields = append(fields, re.Field)
+				}
+			}
+			if !reflect.DeepEqual(fields, tc.fields) {
+				t.Errorf("expected errors for %v, got %v", tc.fields, err)
+			}
+		})
+	}
+}
+
+func TestRangesContain(t *testing.T) {
+	set, _ := parseListRanges("0-3,4-5,8,10-11")
+	for list, want := range map[string]bool{
+		"0-5":   true,
+		"2,8":   true,
+		"5-8":   false,
+		"10,11": true,
+		"9":     false,
+		"11-12": false,
+	} {
+		sub, err := parseListRanges(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rangesContain(set, sub); got != want {
+			t.Errorf("%s: expected %v, got %v", list, want, got)
+		}
+	}
+}